@@ -0,0 +1,427 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/db/postgres/sqlc"
+	"zillow-commenter.com/m/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// Default and maximum number of rows returned by the admin list endpoints
+	defaultAdminListLimit = 50
+	maxAdminListLimit     = 500
+)
+
+// Actions recorded in the admin audit log
+const (
+	auditActionListComments        = "list_comments"
+	auditActionHideComment         = "hide_comment"
+	auditActionUnhideComment       = "unhide_comment"
+	auditActionDeleteComment       = "delete_comment"
+	auditActionListBlacklist       = "list_blacklist"
+	auditActionAddBlacklist        = "add_blacklist"
+	auditActionRemoveBlacklist     = "remove_blacklist"
+	auditActionListReports         = "list_reports"
+	auditActionResolveReport       = "resolve_report"
+	auditActionDismissReport       = "dismiss_report"
+	auditActionListWebhooks        = "list_webhooks"
+	auditActionAddWebhook          = "add_webhook"
+	auditActionRemoveWebhook       = "remove_webhook"
+	auditActionListWebhookAttempts = "list_webhook_attempts"
+)
+
+// errAdminTargetNotFound is returned by audited actions whose target row does not exist.
+var errAdminTargetNotFound = errors.New("admin action target not found")
+
+// AdminListRecentComments lists the most recent comments across all listings, including hidden ones.
+//
+// GET api/admin/comments
+//
+// Input:
+//   - limit (query, optional): The maximum number of comments to return. Defaults to 50, capped at 500.
+//
+// Output:
+//   - 200: A JSON array of comments, including user_ip, user_id and hidden. Structure defined in models package.
+//   - 400: If the limit is invalid.
+//   - 401: If the admin key is missing or wrong.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminListRecentComments(c *gin.Context) {
+	limit, ok := getAdminListLimit(c)
+	if !ok {
+		return
+	}
+
+	var comments []models.AdminComment
+	err := server.withAuditedTx(c, auditActionListComments, "", fmt.Sprintf("limit=%d", limit), func(queries *sqlc.Queries) error {
+		rows, err := queries.GetRecentComments(c.Request.Context(), limit)
+		if err != nil {
+			return err
+		}
+		comments, err = models.RecentCommentRowsToAdminComments(rows)
+		return err
+	})
+	if err != nil {
+		getLogger(c).Error("failed to list recent comments", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, comments)
+}
+
+// AdminHideComment hides a comment from GetListingComments without deleting it.
+//
+// POST api/admin/comments/:comment_id/hide
+//
+// Output:
+//   - 204: The comment was hidden.
+//   - 400: If the comment ID is not a valid UUID.
+//   - 401: If the admin key is missing or wrong.
+//   - 404: If the comment does not exist.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminHideComment(c *gin.Context) {
+	server.setCommentHidden(c, true)
+}
+
+// AdminUnhideComment makes a hidden comment visible again.
+//
+// POST api/admin/comments/:comment_id/unhide
+//
+// Output:
+//   - 204: The comment was unhidden.
+//   - 400: If the comment ID is not a valid UUID.
+//   - 401: If the admin key is missing or wrong.
+//   - 404: If the comment does not exist.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminUnhideComment(c *gin.Context) {
+	server.setCommentHidden(c, false)
+}
+
+// setCommentHidden sets the hidden flag of the comment named in the URL and records the action.
+func (server *Server) setCommentHidden(c *gin.Context, hidden bool) {
+	commentID, ok := getUUIDParam(c, "comment_id")
+	if !ok {
+		return
+	}
+
+	action := auditActionHideComment
+	if !hidden {
+		action = auditActionUnhideComment
+	}
+
+	err := server.withAuditedTx(c, action, c.Param("comment_id"), "", func(queries *sqlc.Queries) error {
+		rowsAffected, err := queries.SetCommentHidden(c.Request.Context(), sqlc.SetCommentHiddenParams{
+			CommentID: commentID,
+			Hidden:    hidden,
+		})
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return errAdminTargetNotFound
+		}
+		return nil
+	})
+	respondAdminAction(c, err)
+}
+
+// AdminDeleteComment soft-deletes a comment, like its author can. It is kept as a tombstone if it has replies,
+// until the retention job purges it.
+//
+// DELETE api/admin/comments/:comment_id
+//
+// Output:
+//   - 204: The comment was deleted.
+//   - 400: If the comment ID is not a valid UUID.
+//   - 401: If the admin key is missing or wrong.
+//   - 404: If the comment does not exist or was already deleted.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminDeleteComment(c *gin.Context) {
+	commentID, ok := getUUIDParam(c, "comment_id")
+	if !ok {
+		return
+	}
+
+	err := server.withAuditedTx(c, auditActionDeleteComment, c.Param("comment_id"), "", func(queries *sqlc.Queries) error {
+		rowsAffected, err := queries.SoftDeleteComment(c.Request.Context(), sqlc.SoftDeleteCommentParams{
+			CommentID: commentID,
+			DeletedBy: pgtype.Text{String: models.DeletedByAdmin, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return errAdminTargetNotFound
+		}
+		return nil
+	})
+	respondAdminAction(c, err)
+}
+
+// AdminListBlacklist lists every blacklist entry, newest first.
+//
+// GET api/admin/blacklist
+//
+// Output:
+//   - 200: A JSON array of blacklist entries. Structure defined in models package.
+//   - 401: If the admin key is missing or wrong.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminListBlacklist(c *gin.Context) {
+	var entries []models.BlacklistEntry
+	err := server.withAuditedTx(c, auditActionListBlacklist, "", "", func(queries *sqlc.Queries) error {
+		rows, err := queries.ListBlacklist(c.Request.Context())
+		if err != nil {
+			return err
+		}
+		entries, err = models.BlacklistRowsToEntries(rows)
+		return err
+	})
+	if err != nil {
+		getLogger(c).Error("failed to list blacklist", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// AdminAddBlacklistEntry adds a new blacklist entry.
+//
+// POST api/admin/blacklist
+//
+// Input:
+//
+//	Post form or JSON body containing the following fields:
+//	- cause: Why the entry is being added.
+//	- user_ip (optional): The IP address to block.
+//	- user_id (optional): The user ID to block.
+//	- username (optional): The username to block.
+//	At least one of user_ip, user_id and username is required.
+//
+// Output:
+//   - 201: A JSON object representing the created blacklist entry.
+//   - 400: If the input data is invalid.
+//   - 401: If the admin key is missing or wrong.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminAddBlacklistEntry(c *gin.Context) {
+	// Validate input data against the blacklist table's column sizes
+	var request models.AddBlacklistEntryRequest
+	if err := bindBody(c, &request); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	cause := request.Cause
+	userIP := request.UserIP
+	userID := request.UserID
+	username := request.Username
+	if userIP == "" && userID == "" && username == "" {
+		detail := "At least one of user_ip, user_id, and username is required"
+		respondProblem(c, http.StatusBadRequest, codeMissingField, detail,
+			models.FieldError{Field: "user_ip", Code: codeMissingField, Detail: detail},
+			models.FieldError{Field: "user_id", Code: codeMissingField, Detail: detail},
+			models.FieldError{Field: "username", Code: codeMissingField, Detail: detail},
+		)
+		return
+	}
+
+	blacklistID, err := uuid.NewV7()
+	if err != nil {
+		getLogger(c).Error("failed to generate new blacklist UUID", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	var entry *models.BlacklistEntry
+	err = server.withAuditedTx(c, auditActionAddBlacklist, blacklistID.String(), cause, func(queries *sqlc.Queries) error {
+		row, err := queries.CreateBlacklistEntry(c.Request.Context(), sqlc.CreateBlacklistEntryParams{
+			BlacklistID: pgtype.UUID{Bytes: [16]byte(blacklistID), Valid: true},
+			Cause:       cause,
+			UserIp:      userIP,
+			UserID:      pgtype.Text{String: userID, Valid: userID != ""},
+			Username:    pgtype.Text{String: username, Valid: username != ""},
+		})
+		if err != nil {
+			return err
+		}
+		entry, err = models.BlacklistRowToEntry(row)
+		return err
+	})
+	if err != nil {
+		getLogger(c).Error("failed to add blacklist entry", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// AdminRemoveBlacklistEntry removes a blacklist entry.
+//
+// DELETE api/admin/blacklist/:blacklist_id
+//
+// Output:
+//   - 204: The entry was removed.
+//   - 400: If the blacklist ID is not a valid UUID.
+//   - 401: If the admin key is missing or wrong.
+//   - 404: If the entry does not exist.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminRemoveBlacklistEntry(c *gin.Context) {
+	blacklistID, ok := getUUIDParam(c, "blacklist_id")
+	if !ok {
+		return
+	}
+
+	err := server.withAuditedTx(c, auditActionRemoveBlacklist, c.Param("blacklist_id"), "", func(queries *sqlc.Queries) error {
+		rowsAffected, err := queries.DeleteBlacklistEntry(c.Request.Context(), blacklistID)
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return errAdminTargetNotFound
+		}
+		return nil
+	})
+	respondAdminAction(c, err)
+}
+
+// AdminListAuditLog lists the most recent actions taken through the admin API.
+//
+// GET api/admin/audit
+//
+// Input:
+//   - limit (query, optional): The maximum number of entries to return. Defaults to 50, capped at 500.
+//
+// Output:
+//   - 200: A JSON array of audit log entries. Structure defined in models package.
+//   - 400: If the limit is invalid.
+//   - 401: If the admin key is missing or wrong.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminListAuditLog(c *gin.Context) {
+	limit, ok := getAdminListLimit(c)
+	if !ok {
+		return
+	}
+
+	// Acquire a Postgres connection from the pool
+	postgresPool, err := server.GetPostgresPool().Acquire(c.Request.Context())
+	if err != nil {
+		getLogger(c).Error("failed to acquire Postgres connection", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	defer postgresPool.Release()
+	postgresQueryClient := sqlc.New(postgresPool)
+
+	rows, err := postgresQueryClient.ListAuditLog(c.Request.Context(), limit)
+	if err != nil {
+		getLogger(c).Error("failed to list audit log", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	entries, err := models.AuditLogRowsToEntries(rows)
+	if err != nil {
+		getLogger(c).Error("failed to convert audit log rows", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// withAuditedTx runs an admin action inside a transaction and records it in the audit log.
+// The audit entry is only committed if the action succeeds.
+//
+// Input:
+//   - c: The request context, used for the admin's IP address.
+//   - action: The audit action name.
+//   - targetID: The ID of the row the action applies to, if any.
+//   - detail: Free-form detail to store alongside the action.
+//   - fn: The action to run with queries bound to the transaction.
+//
+// Output:
+//   - An error if the action or the audit entry fails. errAdminTargetNotFound is passed through from fn.
+func (server *Server) withAuditedTx(c *gin.Context, action, targetID, detail string, fn func(queries *sqlc.Queries) error) error {
+	ctx := c.Request.Context()
+
+	auditID, err := uuid.NewV7()
+	if err != nil {
+		return errors.Join(err, errors.New("failed to generate audit UUID"))
+	}
+
+	tx, err := server.GetPostgresPool().Begin(ctx)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to begin transaction"))
+	}
+	// Rollback has no effect once the transaction is committed
+	defer tx.Rollback(context.Background())
+
+	queries := sqlc.New(tx)
+	if err := fn(queries); err != nil {
+		return err
+	}
+
+	err = queries.CreateAuditLogEntry(ctx, sqlc.CreateAuditLogEntryParams{
+		AuditID:  pgtype.UUID{Bytes: [16]byte(auditID), Valid: true},
+		Action:   action,
+		TargetID: targetID,
+		Detail:   detail,
+		AdminIp:  clientIP(c),
+	})
+	if err != nil {
+		return errors.Join(err, errors.New("failed to write audit log entry"))
+	}
+
+	return tx.Commit(ctx)
+}
+
+// respondAdminAction writes the response for an admin action that has no response body.
+func respondAdminAction(c *gin.Context, err error) {
+	switch {
+	case err == nil:
+		c.Status(http.StatusNoContent)
+	case errors.Is(err, errAdminTargetNotFound):
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Not found")
+	default:
+		getLogger(c).Error("failed to perform admin action", logging.Error(err))
+		respondInternalError(c)
+	}
+}
+
+// getUUIDParam parses the named URL parameter as a UUID, responding with a 400 if it is not one.
+func getUUIDParam(c *gin.Context, name string) (pgtype.UUID, bool) {
+	id, err := uuid.Parse(c.Param(name))
+	if err != nil {
+		respondInvalidField(c, name, codeInvalidField, fmt.Sprintf("Invalid %s", name))
+		return pgtype.UUID{}, false
+	}
+	return pgtype.UUID{Bytes: [16]byte(id), Valid: true}, true
+}
+
+// getAdminListLimit reads the limit query parameter of the admin list endpoints, responding with a 400 if it is invalid.
+func getAdminListLimit(c *gin.Context) (int32, bool) {
+	limitParam := c.Query("limit")
+	if limitParam == "" {
+		return defaultAdminListLimit, true
+	}
+
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil || limit < 1 {
+		respondInvalidField(c, "limit", codeInvalidField, "Invalid limit")
+		return 0, false
+	}
+	if limit > maxAdminListLimit {
+		limit = maxAdminListLimit
+	}
+	return int32(limit), true
+}
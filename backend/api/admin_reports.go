@@ -0,0 +1,226 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/db/postgres/sqlc"
+	"zillow-commenter.com/m/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Who a dismissed report can get blacklisted
+const (
+	dismissBlacklistReporter = "reporter"
+	dismissBlacklistAuthor   = "author"
+)
+
+// errFilterReporter is returned when dismissing a report filed by the comment filters would blacklist its reporter,
+// which is no user.
+var errFilterReporter = errors.New("report filed by the comment filters")
+
+// errAuthorScrubbed is returned when dismissing a report would blacklist the author of a comment whose user ID was
+// already scrubbed by the retention job.
+var errAuthorScrubbed = errors.New("author of the reported comment was scrubbed")
+
+// AdminListReports lists the report queue, oldest first, with the reported comments.
+//
+// GET api/admin/reports
+//
+// Input:
+//   - status (query, optional): open (the default), resolved or dismissed.
+//   - limit (query, optional): The maximum number of reports to return. Defaults to 50, capped at 500.
+//
+// Output:
+//   - 200: A JSON array of reports, each with the reported comment, including user_ip and user_id, and how many
+//     open reports it has. Structure defined in models package.
+//   - 400: If the status or the limit is invalid.
+//   - 401: If the admin key is missing or wrong.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminListReports(c *gin.Context) {
+	limit, ok := getAdminListLimit(c)
+	if !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", models.ReportStatusOpen)
+	if status != models.ReportStatusOpen && status != models.ReportStatusResolved && status != models.ReportStatusDismissed {
+		respondInvalidField(c, "status", codeInvalidValue, "Invalid status, must be open, resolved or dismissed")
+		return
+	}
+
+	var reports []models.AdminReport
+	err := server.withAuditedTx(c, auditActionListReports, "", fmt.Sprintf("status=%s limit=%d", status, limit), func(queries *sqlc.Queries) error {
+		rows, err := queries.ListReports(c.Request.Context(), sqlc.ListReportsParams{
+			Status: status,
+			Limit:  limit,
+		})
+		if err != nil {
+			return err
+		}
+		reports, err = models.ReportRowsToAdminReports(rows)
+		return err
+	})
+	if err != nil {
+		getLogger(c).Error("failed to list reports", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, reports)
+}
+
+// AdminResolveReport upholds a report: the reported comment is hidden, and every open report of it is resolved.
+//
+// POST api/admin/reports/:report_id/resolve
+//
+// Output:
+//   - 204: The reports were resolved.
+//   - 400: If the report ID is not a valid UUID.
+//   - 401: If the admin key is missing or wrong.
+//   - 404: If the report does not exist or is already closed.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminResolveReport(c *gin.Context) {
+	reportID, ok := getUUIDParam(c, "report_id")
+	if !ok {
+		return
+	}
+
+	err := server.withAuditedTx(c, auditActionResolveReport, c.Param("report_id"), "", func(queries *sqlc.Queries) error {
+		report, err := closeReport(c, queries, reportID, models.ReportStatusResolved)
+		if err != nil {
+			return err
+		}
+
+		// The comment was abusive, so close the other reports of it and keep it hidden for good
+		_, err = queries.CloseCommentReports(c.Request.Context(), sqlc.CloseCommentReportsParams{
+			Status:    models.ReportStatusResolved,
+			CommentID: report.CommentID,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = queries.SetCommentHidden(c.Request.Context(), sqlc.SetCommentHiddenParams{
+			CommentID: report.CommentID,
+			Hidden:    true,
+		})
+		return err
+	})
+	respondAdminAction(c, err)
+}
+
+// AdminDismissReport rejects a report. If the comment was hidden because of its reports and no longer has enough
+// open reports, it is shown again. Dismissing a report can also blacklist the reporter, e.g. for abusing reports,
+// or the comment's author.
+//
+// POST api/admin/reports/:report_id/dismiss
+//
+// Input:
+//
+//	Post form or JSON body containing the following fields:
+//	- blacklist (optional): reporter or author, to add that user ID to the blacklist.
+//	- cause (optional): Why the user is blacklisted. Defaults to a cause naming the report.
+//
+// Output:
+//   - 204: The report was dismissed.
+//   - 400: If the report ID, blacklist, or cause is invalid, if blacklist is reporter for a report filed by the
+//     comment filters, or if blacklist is author for a comment whose author was scrubbed.
+//   - 401: If the admin key is missing or wrong.
+//   - 404: If the report does not exist or is already closed.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminDismissReport(c *gin.Context) {
+	reportID, ok := getUUIDParam(c, "report_id")
+	if !ok {
+		return
+	}
+
+	var request models.DismissReportRequest
+	if err := bindBody(c, &request); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	blacklist := request.Blacklist
+	cause := request.Cause
+	if cause == "" {
+		cause = fmt.Sprintf("%s of dismissed report %s", blacklist, c.Param("report_id"))
+	}
+
+	blacklistID, err := uuid.NewV7()
+	if err != nil {
+		getLogger(c).Error("failed to generate new blacklist UUID", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	detail := ""
+	if blacklist != "" {
+		detail = fmt.Sprintf("blacklist=%s blacklist_id=%s", blacklist, blacklistID)
+	}
+	err = server.withAuditedTx(c, auditActionDismissReport, c.Param("report_id"), detail, func(queries *sqlc.Queries) error {
+		report, err := closeReport(c, queries, reportID, models.ReportStatusDismissed)
+		if err != nil {
+			return err
+		}
+
+		// Show the comment again if its reports were what hid it. Without a threshold, reports no longer hide
+		// comments, so the comment is shown once it has no open reports left.
+		_, err = queries.UnhideReportedComment(c.Request.Context(), sqlc.UnhideReportedCommentParams{
+			CommentID:     report.CommentID,
+			HideThreshold: int64(max(server.reportHideThreshold, 1)),
+		})
+		if err != nil {
+			return err
+		}
+
+		if blacklist == "" {
+			return nil
+		}
+		userID := report.ReporterID
+		// Rolling back leaves the report open
+		if blacklist == dismissBlacklistAuthor {
+			userID = report.AuthorID
+			if userID == "" {
+				return errAuthorScrubbed
+			}
+		} else if userID == models.FilterReporterID {
+			return errFilterReporter
+		}
+		_, err = queries.CreateBlacklistEntry(c.Request.Context(), sqlc.CreateBlacklistEntryParams{
+			BlacklistID: pgtype.UUID{Bytes: [16]byte(blacklistID), Valid: true},
+			Cause:       cause,
+			UserID:      pgtype.Text{String: userID, Valid: userID != ""},
+		})
+		return err
+	})
+	if errors.Is(err, errFilterReporter) {
+		respondInvalidField(c, "blacklist", codeInvalidValue, "Invalid blacklist, the report was filed by the comment filters rather than a user")
+		return
+	}
+	if errors.Is(err, errAuthorScrubbed) {
+		respondInvalidField(c, "blacklist", codeInvalidValue, "Invalid blacklist, the author of the comment is no longer known")
+		return
+	}
+	respondAdminAction(c, err)
+}
+
+// closeReport closes an open report with the given status, returning errAdminTargetNotFound if there is no such
+// open report.
+func closeReport(c *gin.Context, queries *sqlc.Queries, reportID pgtype.UUID, status string) (*sqlc.CloseReportRow, error) {
+	report, err := queries.CloseReport(c.Request.Context(), sqlc.CloseReportParams{
+		Status:   status,
+		ReportID: reportID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errAdminTargetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
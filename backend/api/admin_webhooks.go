@@ -0,0 +1,219 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/db/postgres/sqlc"
+	"zillow-commenter.com/m/listing"
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// maxWebhookURLLength is the longest target URL a webhook can have, matching the webhooks table
+const maxWebhookURLLength = 2048
+
+// maxWebhookHostLength is the longest host, with its port, a webhook's target URL can have. DNS names are no longer
+// than 253 characters.
+const maxWebhookHostLength = 253 + len(":65535")
+
+// AdminListWebhooks lists every webhook, newest first, without their secrets.
+//
+// GET api/admin/webhooks
+//
+// Output:
+//   - 200: A JSON array of webhooks. Structure defined in models package.
+//   - 401: If the admin key is missing or wrong.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminListWebhooks(c *gin.Context) {
+	var webhooks []models.Webhook
+	err := server.withAuditedTx(c, auditActionListWebhooks, "", "", func(queries *sqlc.Queries) error {
+		rows, err := queries.ListWebhooks(c.Request.Context())
+		if err != nil {
+			return err
+		}
+		webhooks, err = models.WebhookRowsToWebhooks(rows)
+		return err
+	})
+	if err != nil {
+		getLogger(c).Error("failed to list webhooks", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// AdminAddWebhook registers a new webhook, with a new signing secret.
+//
+// POST api/admin/webhooks
+//
+// Input:
+//
+//	Post form or JSON body containing the following fields:
+//	- target_url: The http or https URL to post the events to.
+//	- listing_id (optional): The listing whose events to send, as a listing key (e.g. "zillow:12345") or a bare
+//	  Zillow listing ID. The events of every listing are sent if it is left out.
+//	- event_type (optional): An event type to send, e.g. "comment.created". Repeat the field for several types, or
+//	  send them as the event_types array of a JSON body. Every type is sent if it is left out.
+//
+// Output:
+//   - 201: A JSON object representing the created webhook, including its secret, which isn't shown again.
+//   - 400: If the input data is invalid.
+//   - 401: If the admin key is missing or wrong.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminAddWebhook(c *gin.Context) {
+	var request models.AddWebhookRequest
+	if err := bindBody(c, &request); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	targetURL := request.TargetURL
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" || len(parsedURL.Host) > maxWebhookHostLength || len(targetURL) > maxWebhookURLLength {
+		respondInvalidField(c, "target_url", codeInvalidField, "Invalid target_url, must be an http or https URL")
+		return
+	}
+
+	var listingID pgtype.Text
+	if request.ListingID != "" {
+		listingKey, err := listing.Parse(request.ListingID)
+		if err != nil {
+			respondInvalidField(c, "listing_id", codeInvalidListing, err.Error())
+			return
+		}
+		listingID = pgtype.Text{String: listingKey.String(), Valid: true}
+	}
+
+	eventTypes := request.EventTypes
+	if len(eventTypes) == 0 {
+		eventTypes = webhook.EventTypes()
+	}
+	for _, eventType := range eventTypes {
+		if !webhook.IsEventType(eventType) {
+			respondInvalidField(c, "event_types", codeInvalidValue, fmt.Sprintf("Unknown event type %q", eventType))
+			return
+		}
+	}
+	slices.Sort(eventTypes)
+	eventTypes = slices.Compact(eventTypes)
+
+	webhookID, err := uuid.NewV7()
+	if err != nil {
+		getLogger(c).Error("failed to generate new webhook UUID", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	secret, err := webhook.GenerateSecret()
+	if err != nil {
+		getLogger(c).Error("failed to generate webhook secret", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	// Only the host is audited: the whole URL can be longer than the audit log's detail, and for some services,
+	// e.g. Slack, its path is the secret
+	detail := fmt.Sprintf("target_host=%s", parsedURL.Host)
+	var created *models.Webhook
+	err = server.withAuditedTx(c, auditActionAddWebhook, webhookID.String(), detail, func(queries *sqlc.Queries) error {
+		row, err := queries.CreateWebhook(c.Request.Context(), sqlc.CreateWebhookParams{
+			WebhookID:  pgtype.UUID{Bytes: [16]byte(webhookID), Valid: true},
+			ListingID:  listingID,
+			TargetUrl:  targetURL,
+			Secret:     secret,
+			EventTypes: eventTypes,
+		})
+		if err != nil {
+			return err
+		}
+		created, err = models.WebhookRowToWebhook(row)
+		return err
+	})
+	if err != nil {
+		getLogger(c).Error("failed to add webhook", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// AdminRemoveWebhook removes a webhook, along with its pending deliveries.
+//
+// DELETE api/admin/webhooks/:webhook_id
+//
+// Output:
+//   - 204: The webhook was removed.
+//   - 400: If the webhook ID is not a valid UUID.
+//   - 401: If the admin key is missing or wrong.
+//   - 404: If the webhook does not exist.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminRemoveWebhook(c *gin.Context) {
+	webhookID, ok := getUUIDParam(c, "webhook_id")
+	if !ok {
+		return
+	}
+
+	err := server.withAuditedTx(c, auditActionRemoveWebhook, c.Param("webhook_id"), "", func(queries *sqlc.Queries) error {
+		rowsAffected, err := queries.DeleteWebhook(c.Request.Context(), webhookID)
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return errAdminTargetNotFound
+		}
+		return nil
+	})
+	respondAdminAction(c, err)
+}
+
+// AdminListWebhookAttempts lists the latest delivery attempts of a webhook, newest first.
+//
+// GET api/admin/webhooks/:webhook_id/attempts
+//
+// Input:
+//   - limit (query, optional): The maximum number of attempts to return. Defaults to 50, capped at 500.
+//
+// Output:
+//   - 200: A JSON array of attempts, each with the status of its delivery. Structure defined in models package.
+//   - 400: If the webhook ID or the limit is invalid.
+//   - 401: If the admin key is missing or wrong.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) AdminListWebhookAttempts(c *gin.Context) {
+	webhookID, ok := getUUIDParam(c, "webhook_id")
+	if !ok {
+		return
+	}
+	limit, ok := getAdminListLimit(c)
+	if !ok {
+		return
+	}
+
+	var attempts []models.WebhookAttempt
+	err := server.withAuditedTx(c, auditActionListWebhookAttempts, c.Param("webhook_id"), fmt.Sprintf("limit=%d", limit), func(queries *sqlc.Queries) error {
+		rows, err := queries.ListWebhookAttempts(c.Request.Context(), sqlc.ListWebhookAttemptsParams{
+			WebhookID: webhookID,
+			Limit:     limit,
+		})
+		if err != nil {
+			return err
+		}
+		attempts, err = models.WebhookAttemptRowsToAttempts(rows)
+		return err
+	})
+	if err != nil {
+		getLogger(c).Error("failed to list webhook attempts", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, attempts)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable reasons returned to the client when a blacklisted user is refused.
+const (
+	blacklistReasonIP       = "blacklisted_ip"
+	blacklistReasonUserID   = "blacklisted_user_id"
+	blacklistReasonUsername = "blacklisted_username"
+)
+
+// checkBlacklist looks up the blacklist for an entry matching the given IP, user ID, or username.
+//
+// Input:
+//   - userIP: The IP address of the client.
+//   - userID: The user ID taken from the client's token.
+//   - username: The username the client is posting as.
+//
+// Output:
+//   - The machine-readable reason the client is blacklisted, or "" if it is not.
+//   - An error if the blacklist could not be queried.
+func (server *Server) checkBlacklist(ctx context.Context, userIP, userID, username string) (string, error) {
+	entry, err := server.store.FindBlacklistEntry(ctx, userIP, userID, username)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", nil
+	}
+
+	// Report the most specific identifier that matched
+	switch {
+	case userID != "" && entry.UserID == userID:
+		return blacklistReasonUserID, nil
+	case username != "" && strings.EqualFold(entry.Username, username):
+		return blacklistReasonUsername, nil
+	default:
+		return blacklistReasonIP, nil
+	}
+}
+
+// respondBlacklisted tells the client that it has been refused because of a blacklist entry.
+func respondBlacklisted(c *gin.Context, reason string) {
+	getLogger(c).Info("refused blacklisted client", slog.String("reason", reason))
+	problem := newProblem(c, http.StatusForbidden, reason, "You have been blocked from posting comments")
+	problem.Reason = reason
+	writeProblem(c, problem)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"zillow-commenter.com/m/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsExposedHeaders are the response headers the scripts of allowed origins may read
+var corsExposedHeaders = []string{requestIDHeaderKey, "Retry-After", "Deprecation", "Link"}
+
+// CORSPolicy is which browser origins may call the API, and what their requests may carry.
+type CORSPolicy struct {
+	// AllowedOrigins are the origins allowed to call the API, e.g. "chrome-extension://<id>". A "*" matches any part
+	// of an origin but a slash, e.g. "https://*.example.com", and on its own every origin. No origin is allowed if it
+	// is empty.
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders are what preflight requests may ask for
+	AllowedMethods []string
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies and client certificates along
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the answer to a preflight request
+	MaxAge time.Duration
+}
+
+// allowsOrigin reports whether the policy allows an origin.
+func (policy CORSPolicy) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range policy.AllowedOrigins {
+		if pattern == config.AnyOrigin {
+			return true
+		}
+		if matched, _ := path.Match(strings.ToLower(pattern), origin); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// corsMiddleware applies the server's CORS policy. Allowed origins get the CORS headers, and their preflight requests
+// are answered right away. Unknown origins are refused with a 403 on preflight and mutating requests, while their
+// other requests go through without CORS headers, so that browsers keep their scripts from reading the response.
+func (server *Server) corsMiddleware() gin.HandlerFunc {
+	policy := server.cors
+	allowedMethods := strings.Join(policy.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(policy.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(corsExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(policy.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			// Not a request from a browser script
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		if isSameOrigin(c.Request, origin) {
+			c.Next()
+			return
+		}
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if !policy.allowsOrigin(origin) {
+			if preflight || isMutatingMethod(c.Request.Method) {
+				getLogger(c).Info("refused cross-origin request", slog.String("origin", origin))
+				abortWithProblem(c, http.StatusForbidden, codeOriginNotAllowed, "Origin not allowed")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if policy.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			c.Header("Access-Control-Allow-Methods", allowedMethods)
+			c.Header("Access-Control-Allow-Headers", allowedHeaders)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Header("Access-Control-Expose-Headers", exposedHeaders)
+		c.Next()
+	}
+}
+
+// isSameOrigin reports whether an origin is the API's own, such as when a page it served posts a form. Browsers send
+// an Origin header with those requests, but they aren't cross-origin. Schemes aren't compared, since the one of the
+// request is lost behind a proxy terminating TLS.
+func isSameOrigin(request *http.Request, origin string) bool {
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host != "" && strings.EqualFold(parsed.Host, request.Host)
+}
+
+// isMutatingMethod reports whether requests of a method can change something on the server.
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/config"
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/notify"
+	"zillow-commenter.com/m/token"
+)
+
+const (
+	// digestMaxComments is how many comments a digest holds at most. The rest go in the next one.
+	digestMaxComments = 50
+
+	// digestPageSize is how many pending subscriptions the digest job fetches at once
+	digestPageSize = 100
+)
+
+// newNotifier returns an SMTP notifier for the email settings, or nil if no SMTP host is set.
+func newNotifier(email config.EmailConfig) (notify.Notifier, error) {
+	if email.SMTPHost == "" {
+		return nil, nil
+	}
+
+	notifier, err := notify.NewSMTPNotifier(notify.SMTPConfig{
+		Host:     email.SMTPHost,
+		Port:     email.SMTPPort,
+		Username: email.SMTPUsername,
+		Password: email.SMTPPassword,
+		From:     email.SMTPFrom,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP settings: %w", err)
+	}
+	return notifier, nil
+}
+
+// publicURL returns the public URL of an API path, with a token as its query.
+func (server *Server) publicURL(path, token string) string {
+	return server.publicBaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// SendDigests notifies every subscriber of the comments posted on their listing since they were last notified,
+// and returns how many digests were emailed. A digest that fails to send is logged and sent again at the next run.
+func (server *Server) SendDigests(ctx context.Context) (int, error) {
+	if server.notifier == nil {
+		return 0, errors.New("notifications are not configured, set SMTP_HOST")
+	}
+
+	sent := 0
+	afterListingID, afterUserID := "", ""
+	for {
+		subscriptions, err := server.store.GetPendingSubscriptions(ctx, afterListingID, afterUserID, digestPageSize, server.hideBlacklistedComments)
+		if err != nil {
+			return sent, err
+		}
+
+		for _, subscription := range subscriptions {
+			afterListingID, afterUserID = subscription.ListingID, subscription.UserID
+
+			ok, err := server.sendDigest(ctx, subscription)
+			if err != nil {
+				slog.Error("failed to send digest", slog.String("listing_id", subscription.ListingID), logging.UserID(subscription.UserID), logging.Error(err))
+				continue
+			}
+			if ok {
+				sent++
+			}
+		}
+
+		if len(subscriptions) < digestPageSize {
+			return sent, nil
+		}
+	}
+}
+
+// sendDigest notifies a subscriber of the new comments by others on their listing, and moves the subscription past
+// them. It reports whether a digest was emailed, which takes new comments and a verified email.
+func (server *Server) sendDigest(ctx context.Context, subscription models.Subscription) (bool, error) {
+	comments, err := server.store.GetCommentsSince(ctx, subscription.ListingID, subscription.LastCommentID, digestMaxComments, server.hideBlacklistedComments)
+	if err != nil {
+		return false, err
+	}
+	if len(comments) == 0 {
+		return false, nil
+	}
+
+	// Subscribers aren't notified of their own comments, but are moved past them
+	var others []models.Comment
+	for _, comment := range comments {
+		if comment.UserID != subscription.UserID {
+			others = append(others, comment)
+		}
+	}
+
+	if len(others) > 0 {
+		unsubscribeToken, err := server.maker.CreateSubscriptionToken(token.PurposeUnsubscribe, subscription.ListingID, subscription.UserID, "", server.unsubscribeTokenDuration)
+		if err != nil {
+			return false, errors.Join(err, errors.New("failed to create unsubscribe token"))
+		}
+
+		digest := notify.Digest{
+			ListingID:      subscription.ListingID,
+			UserID:         subscription.UserID,
+			Comments:       others,
+			UnsubscribeURL: server.publicURL("/api/v1/listings/unsubscribe", unsubscribeToken),
+		}
+		if subscription.EmailVerified {
+			digest.Email = subscription.Email
+		}
+		err = server.notifier.SendDigest(ctx, digest)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = server.store.MarkSubscriptionNotified(ctx, subscription.ListingID, subscription.UserID, comments[len(comments)-1].CommentID)
+	if err != nil {
+		return false, err
+	}
+	return len(others) > 0 && subscription.EmailVerified, nil
+}
+
+// RunDigestJob sends the digests right away, then every digest interval until the context is done. It does nothing
+// if notifications are not configured. Failures are logged and retried at the next run.
+func (server *Server) RunDigestJob(ctx context.Context) {
+	if server.notifier == nil {
+		return
+	}
+
+	ticker := time.NewTicker(server.digestInterval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := server.SendDigests(ctx)
+		if err != nil {
+			slog.Error("failed to send digests", logging.Error(err))
+		} else {
+			slog.Info("sent digests", slog.Int("sent", sent))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
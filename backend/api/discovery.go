@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/buildinfo"
+	"zillow-commenter.com/m/filter"
+	"zillow-commenter.com/m/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiName = "zillow-commenter"
+
+	// apiVersion1 is the only version of the API so far, and the current one
+	apiVersion1     = "v1"
+	apiVersion1Path = "/api/v1"
+
+	// versionStatusCurrent is the status of the version clients should use
+	versionStatusCurrent = "current"
+)
+
+// deprecatedEndpoint is an endpoint that still works but is due to go away, and the one to use instead
+type deprecatedEndpoint struct {
+	method          string
+	path            string
+	successorMethod string
+	successor       string
+}
+
+// deprecatedEndpoints are marked as such in the discovery document, and their responses carry the Deprecation header
+var deprecatedEndpoints = []deprecatedEndpoint{
+	// User IDs without a session token can't be used to post anymore
+	{
+		method:          http.MethodGet,
+		path:            apiVersion1Path + "/user/user_id",
+		successorMethod: http.MethodPost,
+		successor:       apiVersion1Path + "/user/token",
+	},
+}
+
+// GetAPIIndex gives information about the API in general, particularly about how to switch between versions.
+//
+// GET /api
+//
+// Output:
+//   - 200: A JSON object listing the versions of the API, which one is current, and the build of the server.
+//     Structure defined in models package.
+func (server *Server) GetAPIIndex(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIIndex{
+		Name:           apiName,
+		CurrentVersion: apiVersion1,
+		Versions: []models.APIVersionLink{
+			{Version: apiVersion1, URL: apiVersion1Path, Status: versionStatusCurrent},
+		},
+		Build: buildinfo.Get(),
+	})
+}
+
+// GetAPIVersion gives information about the first version of the API: its endpoints, what in it is deprecated, the
+// limits the server enforces, and which optional features are enabled.
+//
+// GET /api/v1
+//
+// Output:
+//   - 200: A JSON object describing the version. Structure defined in models package.
+func (server *Server) GetAPIVersion(c *gin.Context) {
+	deprecations := make([]models.Deprecation, 0, len(deprecatedEndpoints)+1)
+	for _, endpoint := range deprecatedEndpoints {
+		deprecations = append(deprecations, models.Deprecation{
+			Feature:     endpoint.method + " " + endpoint.path,
+			Replacement: endpoint.successorMethod + " " + endpoint.successor,
+		})
+	}
+	// Bare Zillow listing IDs are still accepted from the clients that predate listing keys
+	deprecations = append(deprecations, models.Deprecation{
+		Feature:     "Bare Zillow listing IDs (e.g. \"12345\")",
+		Replacement: "Listing keys (e.g. \"zillow:12345\")",
+	})
+
+	c.JSON(http.StatusOK, models.APIVersion{
+		Version:      apiVersion1,
+		Status:       versionStatusCurrent,
+		Endpoints:    server.endpoints(apiVersion1Path),
+		Deprecations: deprecations,
+		Limits:       server.limits(),
+		Features: models.APIFeatures{
+			CommentStreams:     server.streaming.Load(),
+			EmailNotifications: server.notifier != nil,
+			Webhooks:           server.webhooks != nil,
+			Admin:              server.pool != nil && server.adminKey != "",
+		},
+	})
+}
+
+// endpoints lists the routes mounted under the given prefix, sorted by path then method.
+func (server *Server) endpoints(prefix string) []models.APIEndpoint {
+	endpoints := []models.APIEndpoint{}
+	for _, route := range server.Router.Routes() {
+		if route.Path != prefix && !strings.HasPrefix(route.Path, prefix+"/") {
+			continue
+		}
+		endpoint := models.APIEndpoint{Method: route.Method, Path: route.Path}
+		for _, deprecated := range deprecatedEndpoints {
+			if deprecated.method == route.Method && deprecated.path == route.Path {
+				endpoint.Deprecated = true
+			}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints
+}
+
+// limits returns the limits the server enforces. The length limits are the ones of the comment filters, or of the
+// comments table if the pipeline doesn't check lengths.
+func (server *Server) limits() models.APILimits {
+	limits := models.APILimits{
+		MaxCommentLength:         filter.DefaultMaxCommentLength,
+		MaxUsernameLength:        filter.DefaultMaxUsernameLength,
+		MaxReplyDepth:            server.maxReplyDepth,
+		MaxCommentPageSize:       maxCommentPageSize,
+		MaxCountedListings:       maxCountedListings,
+		MaxReportDetailLength:    maxReportDetailLength,
+		MaxEmailLength:           maxEmailLength,
+		CommentEditWindowSeconds: int64(server.commentEditWindow.Seconds()),
+		RateLimits:               map[string]models.RateLimit{},
+	}
+	for _, stage := range server.commentFilters {
+		if lengthFilter, ok := stage.(filter.LengthFilter); ok {
+			limits.MaxCommentLength = lengthFilter.MaxCommentLength
+			limits.MaxUsernameLength = lengthFilter.MaxUsernameLength
+		}
+	}
+
+	for name, limit := range map[string]ratelimit.Limit{
+		"ip":      server.rateLimits.PerIP,
+		"user":    server.rateLimits.PerUser,
+		"listing": server.rateLimits.PerListing,
+	} {
+		if limit.Enabled() {
+			limits.RateLimits[name] = models.RateLimit{Burst: limit.Burst, PeriodSeconds: int64(limit.Period.Seconds())}
+		}
+	}
+	return limits
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/config"
+	"zillow-commenter.com/m/filter"
+	"zillow-commenter.com/m/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// newCommentFilterConfig returns the settings of the comment filters. The words of the wordlist file, if any, are
+// added to the built-in wordlist.
+func newCommentFilterConfig(comments config.CommentsConfig) (filter.Config, error) {
+	filterConfig := filter.Config{
+		MaxCommentLength:   comments.MaxCommentLength,
+		MaxUsernameLength:  comments.MaxUsernameLength,
+		Wordlist:           filter.DefaultWordlist(),
+		WordlistAction:     comments.WordlistAction,
+		LinkAction:         comments.LinkAction,
+		AllowedLinkDomains: comments.AllowedLinkDomains,
+	}
+
+	if comments.WordlistFile != "" {
+		words, err := filter.ReadWordlistFile(comments.WordlistFile)
+		if err != nil {
+			return filter.Config{}, fmt.Errorf("invalid COMMENT_WORDLIST_FILE: %w", err)
+		}
+		filterConfig.Wordlist = append(filterConfig.Wordlist, words...)
+	}
+
+	return filterConfig, nil
+}
+
+// filterComment runs a comment through the server's filters. If they reject it, the rejection is logged and
+// answered with a 400, and ok is false. Otherwise the comment to store is in the result.
+func (server *Server) filterComment(c *gin.Context, logger *slog.Logger, comment filter.Comment) (result filter.Result, ok bool) {
+	result = server.commentFilters.Run(comment)
+	if result.Rejected {
+		logger.Info("rejected comment", slog.String("reason", result.Reason))
+		respondProblem(c, http.StatusBadRequest, result.Reason, result.Message, rejectedFields(result)...)
+		return result, false
+	}
+	if len(result.Masks) > 0 {
+		logger.Info("masked comment", slog.String("reasons", strings.Join(result.Masks, ",")))
+	}
+	return result, true
+}
+
+// rejectedFields tells the client which fields of a comment the filters rejected, when it's down to specific ones.
+// The reason of the rejection is the code of each field.
+func rejectedFields(result filter.Result) []models.FieldError {
+	switch result.Reason {
+	case "missing_field":
+		// Normalization can leave a field empty, e.g. if it was only whitespace
+		var fieldErrors []models.FieldError
+		if result.Comment.Username == "" {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "username", Code: result.Reason, Detail: "username is required"})
+		}
+		if result.Comment.CommentText == "" {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "comment_text", Code: result.Reason, Detail: "comment_text is required"})
+		}
+		return fieldErrors
+	case "comment_too_long":
+		return []models.FieldError{{Field: "comment_text", Code: result.Reason, Detail: result.Message}}
+	case "username_too_long":
+		return []models.FieldError{{Field: "username", Code: result.Reason, Detail: result.Message}}
+	default:
+		return nil
+	}
+}
+
+// flagComment files a report for the comment filters, so that a moderator reviews a comment they flagged.
+// The comment is already stored, so failing to report it is only logged.
+func (server *Server) flagComment(ctx context.Context, logger *slog.Logger, commentID uuid.UUID, flags []string) {
+	if len(flags) == 0 {
+		return
+	}
+
+	reportID, err := uuid.NewV7()
+	if err != nil {
+		logger.Error("failed to generate report UUID", logging.Error(err))
+		return
+	}
+
+	// Flagging a comment never hides it by itself, only reports from users do
+	_, err = server.store.ReportComment(ctx, models.Report{
+		ReportID:   reportID,
+		CommentID:  commentID,
+		ReporterID: models.FilterReporterID,
+		Reason:     models.ReportReasonFlagged,
+		Detail:     strings.Join(flags, ", "),
+	}, 0)
+	if err != nil {
+		logger.Error("failed to report flagged comment", logging.Error(err))
+		return
+	}
+	logger.Info("flagged comment", slog.String("reasons", strings.Join(flags, ",")))
+}
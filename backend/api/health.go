@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/buildinfo"
+	"zillow-commenter.com/m/db/postgres/sqlc"
+	"zillow-commenter.com/m/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// readinessTimeout bounds the checks of Readyz, so that a hung database fails the check instead of the probe
+	readinessTimeout = 2 * time.Second
+
+	// readinessTokenUserID is the user ID of the throwaway token Readyz issues to check the token key
+	readinessTokenUserID = "readiness-check"
+)
+
+// Outcomes of the readiness checks
+const (
+	checkOK      = "ok"
+	checkSkipped = "skipped"
+	checkFailed  = "failed"
+)
+
+// Healthz tells that the server is up. It doesn't check its dependencies, so that a database outage doesn't get
+// every instance restarted.
+//
+// GET /healthz
+//
+// Output:
+//   - 200: A JSON object with the status "ok".
+func (server *Server) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthStatus{Status: checkOK})
+}
+
+// Readyz tells whether the server can handle requests: the database answers, the comments and blacklist tables are
+// reachable, and the token key can issue and verify tokens. The database checks are skipped when comments are kept
+// in memory.
+//
+// GET /readyz
+//
+// Output:
+//   - 200: A JSON object with the status "ready" and the outcome of each check.
+//   - 503: A JSON object with the status "not_ready" and the outcome of each check. The errors are only logged.
+func (server *Server) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+	logger := getLogger(c)
+
+	checks := map[string]string{}
+	ready := true
+	check := func(name string, err error) {
+		if err != nil {
+			logger.Error("readiness check failed", slog.String("check", name), logging.Error(err))
+			checks[name] = checkFailed
+			ready = false
+			return
+		}
+		checks[name] = checkOK
+	}
+
+	check("token_key", server.checkTokenKey())
+
+	if server.pool == nil {
+		checks["database"] = checkSkipped
+		checks["comments_table"] = checkSkipped
+		checks["blacklist_table"] = checkSkipped
+	} else {
+		check("database", server.pool.Ping(ctx))
+		queries := sqlc.New(server.pool)
+		check("comments_table", queries.CheckCommentsTable(ctx))
+		check("blacklist_table", queries.CheckBlacklistTable(ctx))
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, models.HealthStatus{Status: "not_ready", Checks: checks})
+		return
+	}
+	c.JSON(http.StatusOK, models.HealthStatus{Status: "ready", Checks: checks})
+}
+
+// checkTokenKey issues a short-lived token and verifies it, which fails if the token key can't be used.
+func (server *Server) checkTokenKey() error {
+	token, _, err := server.maker.CreateToken(readinessTokenUserID, time.Minute)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to create token"))
+	}
+	payload, err := server.maker.VerifyToken(token)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to verify token"))
+	}
+	if payload.UserID != readinessTokenUserID {
+		return errors.New("verified token carries the wrong user ID")
+	}
+	return nil
+}
+
+// Version returns the build of the running server.
+//
+// GET /version
+//
+// Output:
+//   - 200: A JSON object containing the git commit and the time the server was built from, and its Go version.
+func (server *Server) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, buildinfo.Get())
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"errors"
+
+	"zillow-commenter.com/m/listing"
+)
+
+// parseListing canonicalizes the listing a request is about, given either as a listing ID (a listing key or a bare
+// Zillow ID) or as the URL of the listing page.
+func parseListing(listingID, listingURL string) (listing.Key, error) {
+	switch {
+	case listingID != "" && listingURL != "":
+		return listing.Key{}, errors.New("listing_id and url can't be used together")
+	case listingURL != "":
+		return listing.ParseURL(listingURL)
+	case listingID != "":
+		return listing.Parse(listingID)
+	default:
+		return listing.Key{}, errors.New("missing listing_id or url")
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+
+	"zillow-commenter.com/m/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeaderKey = "X-Request-ID"
+	requestIDKey       = "request_id"
+	requestLoggerKey   = "request_logger"
+)
+
+// validRequestID matches the request IDs accepted from clients. Anything else is replaced by a new ID,
+// so that clients can't inject arbitrary text into the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestLoggingMiddleware gives every request an ID and a logger carrying its request-scoped fields, and logs
+// the request once it has been handled. Personal data (IPs, user IDs) is hashed before being logged.
+//
+// The request ID is taken from the X-Request-ID header if the client sent a valid one, and is echoed back in the
+// X-Request-ID response header.
+func (server *Server) requestLoggingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(requestIDHeaderKey)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Header(requestIDHeaderKey, requestID)
+
+		// Unmatched requests have no route, so fall back to their path
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		logger := slog.Default().With(
+			slog.String("request_id", requestID),
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+		)
+		c.Set(requestIDKey, requestID)
+		c.Set(requestLoggerKey, logger)
+
+		c.Next()
+
+		attrs := []slog.Attr{
+			slog.Int("status", c.Writer.Status()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			logging.IP(clientIP(c)),
+		}
+		if payload := getAuthPayload(c); payload != nil {
+			attrs = append(attrs, logging.UserID(payload.UserID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// getLogger returns the logger of the request, set by requestLoggingMiddleware, or the default logger.
+func getLogger(c *gin.Context) *slog.Logger {
+	value, ok := c.Get(requestLoggerKey)
+	if !ok {
+		return slog.Default()
+	}
+	logger, ok := value.(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+	return logger
+}
+
+// getRequestID returns the ID given to the request by requestLoggingMiddleware, or "" if it has none.
+func getRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"io"
+	"time"
+
+	"zillow-commenter.com/m/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels the metrics of requests that matched no route, so that scanners can't create a series per
+// path they try
+const unmatchedRoute = "unmatched"
+
+// metricsMiddleware records the count and latency of every request, by route and status.
+func (server *Server) metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		server.metrics.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// ServePrometheusMetrics records the server's metrics, including the statistics of its Postgres pool, and serves
+// them to Prometheus at GET /metrics. Like the admin API, it takes the admin key, since the metrics reveal which
+// listings draw comments and how busy the server is. It is meant for the standalone server, and must be called
+// before serving.
+func (server *Server) ServePrometheusMetrics() {
+	recorder := metrics.NewPrometheus()
+	if server.pool != nil {
+		recorder.RegisterPool(server.pool)
+	}
+	server.metrics = recorder
+	server.Router.GET("/metrics", server.adminAuthMiddleware(), gin.WrapH(recorder.Handler()))
+}
+
+// WriteEMFMetrics writes the server's metrics to w as CloudWatch Embedded Metric Format lines, under the given
+// namespace. It is meant for Lambda, whose logs CloudWatch reads the metrics from, and must be called before serving.
+func (server *Server) WriteEMFMetrics(w io.Writer, namespace string) {
+	recorder := metrics.NewEMF(w, namespace)
+	if server.pool != nil {
+		recorder.RegisterPool(server.pool)
+	}
+	server.metrics = recorder
+}
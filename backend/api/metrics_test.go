@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"zillow-commenter.com/m/api/models"
+)
+
+func TestPrometheusMetricsTakeAdminKey(t *testing.T) {
+	server, _ := newTestServer(t, ServerOptions{AdminKey: "secret"})
+	server.ServePrometheusMetrics()
+
+	do(t, server, http.MethodGet, "/metrics", "", nil, http.StatusUnauthorized)
+	request := newTestRequest(t, http.MethodGet, "/metrics", "", nil)
+	request.Header.Set(adminKeyHeaderKey, "secret")
+	if recorder := serve(server, request); recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "http_requests_total") {
+		t.Errorf("GET /metrics with the admin key answered %d: %s, want the metrics", recorder.Code, recorder.Body)
+	}
+
+	// The discovery document only lists the API
+	version := decode[models.APIVersion](t, do(t, server, http.MethodGet, "/api/v1", "", nil, http.StatusOK))
+	for _, endpoint := range version.Endpoints {
+		if endpoint.Path == "/metrics" {
+			t.Errorf("discovery lists %s %s", endpoint.Method, endpoint.Path)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/token"
+
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	authorizationHeaderKey  = "Authorization"
+	authorizationTypeBearer = "bearer"
+	authorizationPayloadKey = "authorization_payload"
+	adminKeyHeaderKey       = "X-Admin-Key"
+)
+
+// authMiddleware verifies the bearer token sent in the Authorization header and stores its payload in the request context.
+// Requests without a valid token are aborted with a 401.
+func (server *Server) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorizationHeader := c.GetHeader(authorizationHeaderKey)
+		if authorizationHeader == "" {
+			abortWithProblem(c, http.StatusUnauthorized, codeMissingAuthorization, "Authorization header is not provided")
+			return
+		}
+
+		// Header must be of the form "Bearer <token>"
+		fields := strings.Fields(authorizationHeader)
+		if len(fields) != 2 || strings.ToLower(fields[0]) != authorizationTypeBearer {
+			abortWithProblem(c, http.StatusUnauthorized, codeInvalidAuthorization, "Invalid authorization header format")
+			return
+		}
+
+		payload, err := server.maker.VerifyToken(fields[1])
+		if err != nil {
+			getLogger(c).Info("invalid token", logging.Error(err))
+			abortWithProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+			return
+		}
+
+		c.Set(authorizationPayloadKey, payload)
+		c.Next()
+	}
+}
+
+// optionalAuthMiddleware stores the payload of the bearer token in the request context if the client sent a valid one,
+// for routes that anyone can use but that show more to identified users. Requests without a valid token go through
+// anonymously rather than being refused, so that an expired token doesn't stop a client from reading comments.
+func (server *Server) optionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fields := strings.Fields(c.GetHeader(authorizationHeaderKey))
+		if len(fields) != 2 || strings.ToLower(fields[0]) != authorizationTypeBearer {
+			c.Next()
+			return
+		}
+
+		payload, err := server.maker.VerifyToken(fields[1])
+		if err != nil {
+			getLogger(c).Debug("ignored invalid token", logging.Error(err))
+			c.Next()
+			return
+		}
+
+		c.Set(authorizationPayloadKey, payload)
+		c.Next()
+	}
+}
+
+// adminAuthMiddleware checks the X-Admin-Key header against the configured admin API key.
+// If no admin key is configured, every admin request is refused.
+func (server *Server) adminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		providedKey := c.GetHeader(adminKeyHeaderKey)
+		if server.adminKey == "" || providedKey == "" ||
+			subtle.ConstantTimeCompare([]byte(providedKey), []byte(server.adminKey)) != 1 {
+			getLogger(c).Warn("refused admin request", logging.IP(clientIP(c)))
+			abortWithProblem(c, http.StatusUnauthorized, codeInvalidAdminKey, "Invalid admin key")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// getAuthPayload returns the token payload stored by authMiddleware, or nil if the request was not authenticated.
+func getAuthPayload(c *gin.Context) *token.Payload {
+	value, ok := c.Get(authorizationPayloadKey)
+	if !ok {
+		return nil
+	}
+	payload, ok := value.(*token.Payload)
+	if !ok {
+		return nil
+	}
+	return payload
+}
+
+// clientIP returns the IP of the client. Under Lambda, where requests don't come over a connection, it is the source
+// IP seen by API Gateway. Otherwise it is the address of the connection, or the one given in X-Forwarded-For by a
+// trusted proxy if the connection comes from one.
+func clientIP(c *gin.Context) string {
+	if gatewayContext, ok := core.GetAPIGatewayContextFromContext(c.Request.Context()); ok && gatewayContext.Identity.SourceIP != "" {
+		return gatewayContext.Identity.SourceIP
+	}
+	return c.ClientIP()
+}
+
+// deprecatedMiddleware marks the responses of a deprecated route with the Deprecation header, and links to the
+// route that replaces it.
+func deprecatedMiddleware(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+successor+">; rel=\"successor-version\"")
+		c.Next()
+	}
+}
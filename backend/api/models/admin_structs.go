@@ -0,0 +1,120 @@
+package models
+
+import (
+	"errors"
+
+	"zillow-commenter.com/m/db/postgres/sqlc"
+
+	"github.com/google/uuid"
+)
+
+// AdminComment is a comment as shown to moderators, including the identifying information hidden from regular users.
+type AdminComment struct {
+	TargetListing string    `json:"listing_id"`
+	CommentID     uuid.UUID `json:"comment_id"`
+	UserIP        string    `json:"user_ip"`
+	UserID        string    `json:"user_id"`
+	Username      string    `json:"username"`
+	CommentText   string    `json:"comment_text"`
+	Hidden        bool      `json:"hidden"`
+	Deleted       bool      `json:"deleted"`
+	Timestamp     int64     `json:"timestamp"`
+}
+
+// BlacklistEntry is a row of the blacklist table. Empty strings mean the identifier is not part of the entry.
+type BlacklistEntry struct {
+	BlacklistID uuid.UUID `json:"blacklist_id"`
+	Cause       string    `json:"cause"`
+	UserIP      string    `json:"user_ip"`
+	UserID      string    `json:"user_id"`
+	Username    string    `json:"username"`
+	Timestamp   int64     `json:"timestamp"`
+}
+
+// AuditLogEntry is a record of an action taken through the admin API.
+type AuditLogEntry struct {
+	AuditID   uuid.UUID `json:"audit_id"`
+	Action    string    `json:"action"`
+	TargetID  string    `json:"target_id"`
+	Detail    string    `json:"detail"`
+	AdminIP   string    `json:"admin_ip"`
+	Timestamp int64     `json:"timestamp"`
+}
+
+// RecentCommentRowsToAdminComments converts rows from GetRecentComments to AdminComment structs.
+func RecentCommentRowsToAdminComments(rows []sqlc.GetRecentCommentsRow) ([]AdminComment, error) {
+	comments := []AdminComment{}
+	for _, row := range rows {
+		commentUUID, err := uuid.FromBytes(row.CommentID.Bytes[:])
+		if err != nil {
+			return nil, errors.Join(errors.New("invalid comment ID format"), err)
+		}
+		if !row.Extract.Valid {
+			return nil, errors.New("timestamp is not valid")
+		}
+
+		comments = append(comments, AdminComment{
+			TargetListing: row.ListingID,
+			CommentID:     commentUUID,
+			UserIP:        row.UserIp,
+			UserID:        row.UserID,
+			Username:      row.Username,
+			CommentText:   row.CommentText,
+			Hidden:        row.Hidden,
+			Deleted:       row.Deleted,
+			Timestamp:     row.Extract.Int.Int64(),
+		})
+	}
+	return comments, nil
+}
+
+// BlacklistRowToEntry converts a blacklist table row to a BlacklistEntry struct.
+func BlacklistRowToEntry(row sqlc.Blacklist) (*BlacklistEntry, error) {
+	blacklistUUID, err := uuid.FromBytes(row.BlacklistID.Bytes[:])
+	if err != nil {
+		return nil, errors.Join(errors.New("invalid blacklist ID format"), err)
+	}
+
+	return &BlacklistEntry{
+		BlacklistID: blacklistUUID,
+		Cause:       row.Cause,
+		UserIP:      row.UserIp,
+		UserID:      row.UserID.String,
+		Username:    row.Username.String,
+		Timestamp:   row.DateCreated.Time.Unix(),
+	}, nil
+}
+
+// BlacklistRowsToEntries converts a slice of blacklist table rows to a slice of BlacklistEntry structs.
+func BlacklistRowsToEntries(rows []sqlc.Blacklist) ([]BlacklistEntry, error) {
+	entries := []BlacklistEntry{}
+	for _, row := range rows {
+		entry, err := BlacklistRowToEntry(row)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+// AuditLogRowsToEntries converts a slice of admin_audit_log rows to a slice of AuditLogEntry structs.
+func AuditLogRowsToEntries(rows []sqlc.AdminAuditLog) ([]AuditLogEntry, error) {
+	entries := []AuditLogEntry{}
+	for _, row := range rows {
+		auditUUID, err := uuid.FromBytes(row.AuditID.Bytes[:])
+		if err != nil {
+			return nil, errors.Join(errors.New("invalid audit ID format"), err)
+		}
+
+		entries = append(entries, AuditLogEntry{
+			AuditID:   auditUUID,
+			Action:    row.Action,
+			TargetID:  row.TargetID,
+			Detail:    row.Detail,
+			AdminIP:   row.AdminIp,
+			Timestamp: row.DateCreated.Time.Unix(),
+		})
+	}
+	return entries, nil
+}
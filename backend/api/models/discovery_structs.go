@@ -0,0 +1,76 @@
+package models
+
+import "zillow-commenter.com/m/buildinfo"
+
+// APIIndex is the response of GetAPIIndex, which tells clients which versions of the API they can switch between.
+type APIIndex struct {
+	Name           string           `json:"name"`
+	CurrentVersion string           `json:"current_version"`
+	Versions       []APIVersionLink `json:"versions"`
+	Build          buildinfo.Info   `json:"build"`
+}
+
+// APIVersionLink points to the discovery document of a version of the API.
+type APIVersionLink struct {
+	Version    string `json:"version"`
+	URL        string `json:"url"`
+	Status     string `json:"status"` // "current" or "deprecated"
+	Deprecated bool   `json:"deprecated"`
+}
+
+// APIVersion is the response of GetAPIVersion: what a version of the API serves, and within which limits.
+type APIVersion struct {
+	Version      string        `json:"version"`
+	Status       string        `json:"status"`
+	Deprecated   bool          `json:"deprecated"`
+	Endpoints    []APIEndpoint `json:"endpoints"`
+	Deprecations []Deprecation `json:"deprecations"`
+	Limits       APILimits     `json:"limits"`
+	Features     APIFeatures   `json:"features"`
+}
+
+// APIEndpoint is a route served by a version of the API.
+type APIEndpoint struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Deprecated bool   `json:"deprecated,omitempty"`
+}
+
+// Deprecation describes an endpoint or behavior that still works but is due to go away, and what to use instead.
+type Deprecation struct {
+	Feature     string `json:"feature"`
+	Replacement string `json:"replacement"`
+}
+
+// APILimits holds the limits the server enforces. Lengths are in characters, durations in seconds.
+type APILimits struct {
+	MaxCommentLength         int                  `json:"max_comment_length"`
+	MaxUsernameLength        int                  `json:"max_username_length"`
+	MaxReplyDepth            int                  `json:"max_reply_depth"`
+	MaxCommentPageSize       int                  `json:"max_comment_page_size"`
+	MaxCountedListings       int                  `json:"max_counted_listings"`
+	MaxReportDetailLength    int                  `json:"max_report_detail_length"`
+	MaxEmailLength           int                  `json:"max_email_length"`
+	CommentEditWindowSeconds int64                `json:"comment_edit_window_seconds"` // 0 if editing is disabled
+	RateLimits               map[string]RateLimit `json:"rate_limits"`                 // Keyed by what they limit: "ip", "user" or "listing"
+}
+
+// RateLimit is a limit on posting comments: Burst posts at once, refilled over PeriodSeconds.
+type RateLimit struct {
+	Burst         int   `json:"burst"`
+	PeriodSeconds int64 `json:"period_seconds"`
+}
+
+// APIFeatures tells which optional features the server has enabled.
+type APIFeatures struct {
+	CommentStreams     bool `json:"comment_streams"`
+	EmailNotifications bool `json:"email_notifications"`
+	Webhooks           bool `json:"webhooks"`
+	Admin              bool `json:"admin"`
+}
+
+// HealthStatus is the response of Readyz, with the outcome of each check: "ok", "skipped", or "failed".
+type HealthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "zillow-commenter.com/m/db/postgres/sqlc"
+
+// ListingCommentCount sums up the comments on a listing: how many are visible, replies included, and when the
+// latest one was posted.
+type ListingCommentCount struct {
+	CommentCount    int64  `json:"comment_count"`
+	LatestTimestamp *int64 `json:"latest_timestamp"` // In microseconds. null if the listing has no comments.
+}
+
+// ListingCommentCounts is the response of GetListingCommentCounts, keyed by the listing IDs as the client sent them.
+type ListingCommentCounts struct {
+	Counts map[string]ListingCommentCount `json:"counts"`
+}
+
+// ListingCountRowsToCounts converts the rows of GetListingCommentCounts to ListingCommentCounts keyed by listing ID.
+func ListingCountRowsToCounts(rows []sqlc.GetListingCommentCountsRow) map[string]ListingCommentCount {
+	counts := make(map[string]ListingCommentCount, len(rows))
+	for _, row := range rows {
+		count := ListingCommentCount{CommentCount: row.CommentCount}
+		if row.LatestComment.Valid {
+			latest := numericToTimestamp(row.LatestComment)
+			count.LatestTimestamp = &latest
+		}
+		counts[row.ListingID] = count
+	}
+	return counts
+}
@@ -0,0 +1,25 @@
+package models
+
+// Problem is the body of every error response, an RFC 7807 problem details object served as application/problem+json.
+// Clients should branch on Code, which is stable, rather than on Detail, which is meant for people and may change.
+type Problem struct {
+	Type     string `json:"type"`     // A URN naming the code, e.g. "urn:zillow-commenter:problem:comment_too_long"
+	Title    string `json:"title"`    // The text of the status code, e.g. "Bad Request"
+	Status   int    `json:"status"`   // The HTTP status code of the response
+	Detail   string `json:"detail"`   // What went wrong with this request
+	Instance string `json:"instance"` // The path of the request
+	Code     string `json:"code"`     // A machine-readable code, e.g. "missing_field" or "internal"
+	// RequestID is the ID of the request in the server logs, which is also in the X-Request-ID header
+	RequestID string `json:"request_id,omitempty"`
+	// Errors tells which fields of the request were invalid, if the problem is about its input
+	Errors []FieldError `json:"errors,omitempty"`
+	// Reason is which identifier of a blacklisted client matched, the same as Code. It predates Code.
+	Reason string `json:"reason,omitempty"`
+}
+
+// FieldError is what was wrong with one field of a request.
+type FieldError struct {
+	Field  string `json:"field"`  // The name of the field, as sent by the client, e.g. "comment_text"
+	Code   string `json:"code"`   // A machine-readable code, e.g. "missing_field" or "too_long"
+	Detail string `json:"detail"` // What is wrong with the field
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"errors"
+	"slices"
+
+	"zillow-commenter.com/m/db/postgres/sqlc"
+
+	"github.com/google/uuid"
+)
+
+// Why a comment is reported
+const (
+	ReportReasonSpam           = "spam"
+	ReportReasonHarassment     = "harassment"
+	ReportReasonHateSpeech     = "hate_speech"
+	ReportReasonPersonalInfo   = "personal_info"
+	ReportReasonMisinformation = "misinformation"
+	ReportReasonOther          = "other"
+
+	// ReportReasonFlagged is the reason of the reports filed by the comment filters. Users can't report for it.
+	ReportReasonFlagged = "flagged"
+)
+
+// FilterReporterID is the reporter ID of the reports filed when the comment filters flag a comment for review.
+// Those reports only ask a moderator to look, so they don't count towards hiding the comment.
+const FilterReporterID = "filter"
+
+// ReportReasons lists every reason a comment can be reported for.
+var ReportReasons = []string{
+	ReportReasonSpam,
+	ReportReasonHarassment,
+	ReportReasonHateSpeech,
+	ReportReasonPersonalInfo,
+	ReportReasonMisinformation,
+	ReportReasonOther,
+}
+
+// IsReportReason reports whether reason is one of ReportReasons.
+func IsReportReason(reason string) bool {
+	return slices.Contains(ReportReasons, reason)
+}
+
+// Where a report stands. Reports are open until a moderator resolves them (the comment was abusive) or dismisses
+// them (it wasn't).
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+// Report is a user's report of a comment, as returned to the reporter. Timestamp is in microseconds.
+type Report struct {
+	ReportID   uuid.UUID `json:"report_id"`
+	CommentID  uuid.UUID `json:"comment_id"`
+	ReporterID string    `json:"-"`
+	Reason     string    `json:"reason"`
+	Detail     string    `json:"detail"`
+	Status     string    `json:"status"`
+	Timestamp  int64     `json:"timestamp"`
+}
+
+// AdminReport is a report as shown to moderators, along with the reported comment and how many open reports it has.
+// ClosedAt is null while the report is open. Timestamps are in microseconds.
+type AdminReport struct {
+	ReportID    uuid.UUID    `json:"report_id"`
+	ReporterID  string       `json:"reporter_id"`
+	Reason      string       `json:"reason"`
+	Detail      string       `json:"detail"`
+	Status      string       `json:"status"`
+	Timestamp   int64        `json:"timestamp"`
+	ClosedAt    *int64       `json:"closed_at"`
+	Comment     AdminComment `json:"comment"`
+	OpenReports int          `json:"open_reports"`
+}
+
+// ReportRowToReport converts a reports table row to a Report struct.
+func ReportRowToReport(row sqlc.Report) (*Report, error) {
+	if !row.ReportID.Valid || !row.CommentID.Valid {
+		return nil, errors.New("invalid report or comment ID")
+	}
+
+	return &Report{
+		ReportID:   uuid.UUID(row.ReportID.Bytes),
+		CommentID:  uuid.UUID(row.CommentID.Bytes),
+		ReporterID: row.ReporterID,
+		Reason:     row.Reason,
+		Detail:     row.Detail,
+		Status:     row.Status,
+		Timestamp:  row.DateCreated.Time.UnixMicro(),
+	}, nil
+}
+
+// ReportRowsToAdminReports converts rows from ListReports to AdminReport structs.
+func ReportRowsToAdminReports(rows []sqlc.ListReportsRow) ([]AdminReport, error) {
+	reports := []AdminReport{}
+	for _, row := range rows {
+		if !row.ReportID.Valid || !row.CommentID.Valid {
+			return nil, errors.New("invalid report or comment ID")
+		}
+		if !row.Extract.Valid {
+			return nil, errors.New("timestamp is not valid")
+		}
+
+		var closedAt *int64
+		if row.DateClosed.Valid {
+			closed := row.DateClosed.Time.UnixMicro()
+			closedAt = &closed
+		}
+
+		reports = append(reports, AdminReport{
+			ReportID:   uuid.UUID(row.ReportID.Bytes),
+			ReporterID: row.ReporterID,
+			Reason:     row.Reason,
+			Detail:     row.Detail,
+			Status:     row.Status,
+			Timestamp:  row.DateCreated.Time.UnixMicro(),
+			ClosedAt:   closedAt,
+			Comment: AdminComment{
+				TargetListing: row.ListingID,
+				CommentID:     uuid.UUID(row.CommentID.Bytes),
+				UserIP:        row.UserIp,
+				UserID:        row.UserID,
+				Username:      row.Username,
+				CommentText:   row.CommentText,
+				Hidden:        row.Hidden,
+				Deleted:       row.Deleted,
+				Timestamp:     row.Extract.Int.Int64(),
+			},
+			OpenReports: int(row.OpenReports),
+		})
+	}
+	return reports, nil
+}
@@ -0,0 +1,67 @@
+package models
+
+// The bodies of the requests that take one. Each can be sent as a JSON object or as a URL-encoded or multipart form,
+// whose fields are named after the json and form tags. The binding tags are checked when the body is bound; the
+// checks that depend on the server's settings, such as the comment length limits, are left to the handlers.
+
+// ListingRef is how a request refers to a listing: by its ID, or by the URL of its page.
+type ListingRef struct {
+	ListingID string `form:"listing_id" json:"listing_id"`
+	URL       string `form:"url" json:"url"`
+}
+
+// PostCommentRequest is the body of PostListingComment.
+type PostCommentRequest struct {
+	ListingRef
+	Username    string `form:"username" json:"username" binding:"required"`
+	CommentText string `form:"comment_text" json:"comment_text" binding:"required"`
+	ParentID    string `form:"parent_id" json:"parent_id"`
+}
+
+// EditCommentRequest is the body of EditComment.
+type EditCommentRequest struct {
+	CommentText string `form:"comment_text" json:"comment_text" binding:"required"`
+}
+
+// VoteRequest is the body of VoteComment. Vote is a pointer so that a missing vote can be told apart from 0.
+type VoteRequest struct {
+	Vote *int `form:"vote" json:"vote" binding:"required,oneof=-1 0 1"`
+}
+
+// ReportRequest is the body of ReportComment. The maximum length of Detail matches the reports table.
+type ReportRequest struct {
+	Reason string `form:"reason" json:"reason" binding:"required"`
+	Detail string `form:"detail" json:"detail" binding:"max=300"`
+}
+
+// SubscribeRequest is the body of SubscribeListing.
+type SubscribeRequest struct {
+	Email string `form:"email" json:"email"`
+}
+
+// ListingCountsRequest is the body of GetListingCommentCounts. Forms repeat the listing_id field once per listing.
+type ListingCountsRequest struct {
+	ListingIDs []string `form:"listing_id" json:"listing_ids" binding:"required"`
+}
+
+// AddBlacklistEntryRequest is the body of AdminAddBlacklistEntry. The maximum lengths match the blacklist table.
+// At least one of UserIP, UserID and Username is required, which the handler checks.
+type AddBlacklistEntryRequest struct {
+	Cause    string `form:"cause" json:"cause" binding:"required,max=100"`
+	UserIP   string `form:"user_ip" json:"user_ip" binding:"max=45"`
+	UserID   string `form:"user_id" json:"user_id" binding:"max=50"`
+	Username string `form:"username" json:"username" binding:"max=50"`
+}
+
+// DismissReportRequest is the body of AdminDismissReport.
+type DismissReportRequest struct {
+	Blacklist string `form:"blacklist" json:"blacklist" binding:"omitempty,oneof=reporter author"`
+	Cause     string `form:"cause" json:"cause" binding:"max=100"`
+}
+
+// AddWebhookRequest is the body of AdminAddWebhook. Forms repeat the event_type field once per event type.
+type AddWebhookRequest struct {
+	TargetURL  string   `form:"target_url" json:"target_url" binding:"required"`
+	ListingID  string   `form:"listing_id" json:"listing_id"`
+	EventTypes []string `form:"event_type" json:"event_types"`
+}
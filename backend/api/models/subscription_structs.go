@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+
+	"zillow-commenter.com/m/db/postgres/sqlc"
+
+	"github.com/google/uuid"
+)
+
+// Subscription is a user's subscription to the comments posted on a listing. The subscriber is notified of the
+// comments posted after LastCommentID, and by email only once they verified the address.
+type Subscription struct {
+	ListingID     string    `json:"listing_id"`
+	UserID        string    `json:"-"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	LastCommentID uuid.UUID `json:"-"`
+	Timestamp     int64     `json:"timestamp"` // When the user subscribed, in microseconds
+}
+
+// SubscriptionRowToSubscription converts a postgres database row from GetSubscription to a Subscription struct
+// used by the API. The rows of UpsertSubscription and GetPendingSubscriptions have the same columns.
+func SubscriptionRowToSubscription(row sqlc.GetSubscriptionRow) (*Subscription, error) {
+	if !row.LastCommentID.Valid {
+		return nil, errors.New("LastCommentID is NULL")
+	}
+	return &Subscription{
+		ListingID:     row.ListingID,
+		UserID:        row.UserID,
+		Email:         row.Email,
+		EmailVerified: row.EmailVerified,
+		LastCommentID: uuid.UUID(row.LastCommentID.Bytes),
+		Timestamp:     numericToTimestamp(row.Extract),
+	}, nil
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"math/big"
 	"reflect"
+	"slices"
 
 	"zillow-commenter.com/m/db/postgres/sqlc"
 
@@ -16,21 +17,81 @@ import (
 )
 
 type Comment struct {
-	TargetListing string    `json:"listing_id"`
-	CommentID     uuid.UUID `json:"comment_id"`
-	UserIP        string    `json:"user_ip"`
-	UserID        string    `json:"user_id"`
-	Username      string    `json:"username"`
-	CommentText   string    `json:"comment_text"`
-	Timestamp     int64     `json:"timestamp"`
+	TargetListing string     `json:"listing_id"`
+	CommentID     uuid.UUID  `json:"comment_id"`
+	ParentID      *uuid.UUID `json:"parent_id,omitempty"`
+	UserIP        string     `json:"user_ip"`
+	UserID        string     `json:"user_id"`
+	Username      string     `json:"username"`
+	CommentText   string     `json:"comment_text"`
+	Timestamp     int64      `json:"timestamp"`
+	EditedAt      int64      `json:"edited_at,omitempty"` // 0 if the comment was never edited
+	RevisionCount int        `json:"revision_count"`
+	DeletedAt     int64      `json:"deleted_at,omitempty"` // 0 if the comment was not deleted
+	DeletedBy     string     `json:"deleted_by,omitempty"` // DeletedByAuthor or DeletedByAdmin
+	Score         int        `json:"score"`                // Upvotes minus downvotes
 }
 
+// Who deleted a comment
+const (
+	DeletedByAuthor = "author"
+	DeletedByAdmin  = "admin"
+)
+
+// deletedPlaceholder replaces the username and text of deleted comments that are kept as tombstones
+const deletedPlaceholder = "[deleted]"
+
+// ResponseComment is a comment as returned to clients. Depth is the comment's nesting level in its thread,
+// with 0 for top-level comments and ParentID unset. EditedAt is null if the comment was never edited.
+// Score is the comment's upvotes minus its downvotes, and MyVote the vote of the requesting user (1, -1, or 0 if
+// they haven't voted or aren't identified).
+// Deleted comments that still have replies are returned as tombstones, with Deleted set and their username
+// and text replaced by "[deleted]".
 type ResponseComment struct {
-	TargetListing string    `json:"listing_id"`
-	CommentID     uuid.UUID `json:"comment_id"`
-	Username      string    `json:"username"`
-	CommentText   string    `json:"comment_text"`
-	Timestamp     int64     `json:"timestamp"`
+	TargetListing string     `json:"listing_id"`
+	CommentID     uuid.UUID  `json:"comment_id"`
+	ParentID      *uuid.UUID `json:"parent_id,omitempty"`
+	Depth         int        `json:"depth"`
+	Username      string     `json:"username"`
+	CommentText   string     `json:"comment_text"`
+	Timestamp     int64      `json:"timestamp"`
+	EditedAt      *int64     `json:"edited_at"`
+	RevisionCount int        `json:"revision_count"`
+	Score         int        `json:"score"`
+	MyVote        int        `json:"my_vote"`
+	Deleted       bool       `json:"deleted"`
+}
+
+// VoteResult is the outcome of a vote as returned by VoteComment: the comment's new score and the user's vote.
+type VoteResult struct {
+	CommentID uuid.UUID `json:"comment_id"`
+	Score     int       `json:"score"`
+	MyVote    int       `json:"my_vote"`
+}
+
+// CommentRevision is a previous version of a comment's text. WrittenAt is when that version was posted
+// (or edited in), and ReplacedAt when it was edited out. Timestamps are in microseconds.
+type CommentRevision struct {
+	RevisionID  uuid.UUID `json:"revision_id"`
+	CommentText string    `json:"comment_text"`
+	WrittenAt   int64     `json:"written_at"`
+	ReplacedAt  int64     `json:"replaced_at"`
+}
+
+// CommentHistory is the edit history of a comment as returned by GetCommentRevisions.
+// Revisions are ordered oldest first, and the current text is in Comment.
+type CommentHistory struct {
+	Comment   ResponseComment   `json:"comment"`
+	Revisions []CommentRevision `json:"revisions"`
+}
+
+// CommentPage is a page of comments as returned by GetListingComments, with cursors to the neighbouring pages.
+// NextCursor leads further in the sort order and PrevCursor back. The cursors are opaque strings, and either is nil
+// when there is nothing more that way.
+type CommentPage struct {
+	Comments   []ResponseComment `json:"comments"`
+	NextCursor *string           `json:"next_cursor"`
+	PrevCursor *string           `json:"prev_cursor"`
 }
 
 // GenericRowToComment converts any struct with the required fields to a Comment object.
@@ -128,26 +189,81 @@ func GenericRowToComment(row interface{}) (*Comment, error) {
 	}
 	timestamp := int8Value.Int64
 
+	// Extract ParentCommentID, which is optional since not every row carries it
+	var parentID *uuid.UUID
+	if parentField, ok := getField("ParentCommentID"); ok {
+		parentUUID, ok := parentField.Interface().(pgtype.UUID)
+		if !ok {
+			return nil, errors.New("ParentCommentID field is not of type pgtype.UUID")
+		}
+		parentID = pgUUIDToUUIDPtr(parentUUID)
+	}
+
+	// Extract EditedAt and RevisionCount, which are optional too
+	var editedAt int64
+	if editedAtField, ok := getField("EditedAt"); ok {
+		editedAtNumeric, ok := editedAtField.Interface().(pgtype.Numeric)
+		if !ok {
+			return nil, errors.New("EditedAt field is not of type pgtype.Numeric")
+		}
+		editedAt = numericToTimestamp(editedAtNumeric)
+	}
+	var revisionCount int
+	if revisionCountField, ok := getField("RevisionCount"); ok {
+		revisionCount = int(revisionCountField.Int())
+	}
+
+	// Extract DeletedAt and DeletedBy, which are optional too
+	var deletedAt int64
+	if deletedAtField, ok := getField("DeletedAt"); ok {
+		deletedAtNumeric, ok := deletedAtField.Interface().(pgtype.Numeric)
+		if !ok {
+			return nil, errors.New("DeletedAt field is not of type pgtype.Numeric")
+		}
+		deletedAt = numericToTimestamp(deletedAtNumeric)
+	}
+	var deletedBy string
+	if deletedByField, ok := getField("DeletedBy"); ok {
+		deletedByText, ok := deletedByField.Interface().(pgtype.Text)
+		if !ok {
+			return nil, errors.New("DeletedBy field is not of type pgtype.Text")
+		}
+		deletedBy = deletedByText.String
+	}
+
+	// Extract Score, which is optional too
+	var score int
+	if scoreField, ok := getField("Score"); ok {
+		score = int(scoreField.Int())
+	}
+
 	return &Comment{
 		TargetListing: listingID,
 		CommentID:     commentUUID,
+		ParentID:      parentID,
 		UserIP:        userIP,
 		UserID:        userID,
 		Username:      username,
 		CommentText:   commentText,
 		Timestamp:     timestamp,
+		EditedAt:      editedAt,
+		RevisionCount: revisionCount,
+		DeletedAt:     deletedAt,
+		DeletedBy:     deletedBy,
+		Score:         score,
 	}, nil
 }
 
-// CommentRowToComment converts a postgres database row from GetCommentsByListingID to a Comment struct used by the API.
+// CommentRowToComment converts a postgres database row from one of the comment queries to a Comment struct used by
+// the API.
 //
 // Input:
-//   - row: a sqlc.GetCommentsByListingIDRow struct containing the comment data from the database.
+//   - row: a sqlc.CommentRow struct containing the comment data from the database.
 //
 // Output:
 //   - Comment: a Comment struct containing the comment data.
 //   - error: an error if the conversion fails, otherwise nil.
-func CommentRowToComment(row sqlc.GetCommentsByListingIDRow) (*Comment, error) {
+func CommentRowToComment(row sqlc.CommentRow) (*Comment, error) {
 	// Convert postgres types to Go types.
 
 	// Convert the comment ID from pgtype.UUID to uuid.UUID.
@@ -172,16 +288,22 @@ func CommentRowToComment(row sqlc.GetCommentsByListingIDRow) (*Comment, error) {
 	return &Comment{
 		TargetListing: row.ListingID,
 		CommentID:     commentUUID,
+		ParentID:      pgUUIDToUUIDPtr(row.ParentCommentID),
 		UserIP:        row.UserIp,
 		UserID:        row.UserID,
 		Username:      row.Username,
 		CommentText:   row.CommentText,
 		Timestamp:     timestamp,
+		EditedAt:      numericToTimestamp(row.EditedAt),
+		RevisionCount: int(row.RevisionCount),
+		DeletedAt:     numericToTimestamp(row.DeletedAt),
+		DeletedBy:     row.DeletedBy.String,
+		Score:         int(row.Score),
 	}, nil
 }
 
-// CommentRowsToComments converts a slice of sqlc.GetCommentsByListingIDRow to a slice of Comment structs.
-func CommentRowsToComments(rows []sqlc.GetCommentsByListingIDRow) ([]Comment, error) {
+// CommentRowsToComments converts a slice of sqlc.CommentRow to a slice of Comment structs.
+func CommentRowsToComments(rows []sqlc.CommentRow) ([]Comment, error) {
 	var comments []Comment
 	for _, row := range rows {
 		comment, err := CommentRowToComment(row)
@@ -193,15 +315,15 @@ func CommentRowsToComments(rows []sqlc.GetCommentsByListingIDRow) ([]Comment, er
 	return comments, nil
 }
 
-// CommentToCommentRow converts a Comment struct used by the API to a sqlc.GetCommentsByListingIDRow struct used by postgres.
+// CommentToCommentRow converts a Comment struct used by the API to a sqlc.CommentRow struct used by postgres.
 //
 // Input:
 //   - comment: a Comment struct containing the comment data.
 //
 // Output:
-//   - sqlc.GetCommentsByListingIDRow: a sqlc.GetCommentsByListingIDRow struct containing the comment data.
+//   - sqlc.CommentRow: a sqlc.CommentRow struct containing the comment data.
 //   - error: an error if the conversion fails, otherwise nil.
-func CommentToCommentRow(comment Comment) *sqlc.GetCommentsByListingIDRow {
+func CommentToCommentRow(comment Comment) *sqlc.CommentRow {
 	// Convert go types to postgres types.
 
 	// Convert the timestamp to pgtype.Numeric.
@@ -210,21 +332,45 @@ func CommentToCommentRow(comment Comment) *sqlc.GetCommentsByListingIDRow {
 		Valid: true,
 	}
 
-	// Create a GetCommentsByListingIDRow struct from the Comment struct.
-	return &sqlc.GetCommentsByListingIDRow{
-		CommentID:   pgtype.UUID{Bytes: [16]byte(comment.CommentID), Valid: true},
-		ListingID:   comment.TargetListing,
-		UserIp:      comment.UserIP,
-		UserID:      comment.UserID,
-		Username:    comment.Username,
-		CommentText: comment.CommentText,
-		Extract:     extract,
+	// Convert the optional parent ID to pgtype.UUID.
+	parentCommentID := pgtype.UUID{}
+	if comment.ParentID != nil {
+		parentCommentID = pgtype.UUID{Bytes: [16]byte(*comment.ParentID), Valid: true}
+	}
+
+	// Convert the optional edit timestamp to pgtype.Numeric, leaving it NULL if the comment was never edited.
+	editedAt := pgtype.Numeric{}
+	if comment.EditedAt != 0 {
+		editedAt = pgtype.Numeric{Int: big.NewInt(comment.EditedAt), Valid: true}
+	}
+
+	// Convert the optional deletion timestamp the same way.
+	deletedAt := pgtype.Numeric{}
+	if comment.DeletedAt != 0 {
+		deletedAt = pgtype.Numeric{Int: big.NewInt(comment.DeletedAt), Valid: true}
+	}
+
+	// Create a CommentRow struct from the Comment struct.
+	return &sqlc.CommentRow{
+		CommentID:       pgtype.UUID{Bytes: [16]byte(comment.CommentID), Valid: true},
+		ListingID:       comment.TargetListing,
+		UserIp:          comment.UserIP,
+		UserID:          comment.UserID,
+		Username:        comment.Username,
+		CommentText:     comment.CommentText,
+		ParentCommentID: parentCommentID,
+		Extract:         extract,
+		EditedAt:        editedAt,
+		RevisionCount:   int32(comment.RevisionCount),
+		DeletedAt:       deletedAt,
+		DeletedBy:       pgtype.Text{String: comment.DeletedBy, Valid: comment.DeletedBy != ""},
+		Score:           int32(comment.Score),
 	}
 }
 
-// CommentsToCommentRows converts a slice of Comment structs to a slice of sqlc.GetCommentsByListingIDRow structs.
-func CommentsToCommentRows(comments []Comment) []sqlc.GetCommentsByListingIDRow {
-	var commentRows []sqlc.GetCommentsByListingIDRow
+// CommentsToCommentRows converts a slice of Comment structs to a slice of sqlc.CommentRow structs.
+func CommentsToCommentRows(comments []Comment) []sqlc.CommentRow {
+	var commentRows []sqlc.CommentRow
 	for _, comment := range comments {
 		commentRow := CommentToCommentRow(comment)
 		commentRows = append(commentRows, *commentRow)
@@ -234,14 +380,50 @@ func CommentsToCommentRows(comments []Comment) []sqlc.GetCommentsByListingIDRow
 
 // ToResponse converts a Comment to a ResponseComment.
 // This is used to format the comment data for API responses, excluding sensitive information like UserIP and UserID.
+// Deleted comments are turned into tombstones.
 func (c Comment) ToResponse() ResponseComment {
+	var editedAt *int64
+	if c.EditedAt != 0 {
+		editedAt = &c.EditedAt
+	}
+
+	if c.DeletedAt != 0 {
+		return ResponseComment{
+			TargetListing: c.TargetListing,
+			CommentID:     c.CommentID,
+			ParentID:      c.ParentID,
+			Username:      deletedPlaceholder,
+			CommentText:   deletedPlaceholder,
+			Timestamp:     c.Timestamp,
+			Deleted:       true,
+		}
+	}
+
 	return ResponseComment{
 		TargetListing: c.TargetListing,
 		CommentID:     c.CommentID,
+		ParentID:      c.ParentID,
 		Username:      c.Username,
 		CommentText:   c.CommentText,
 		Timestamp:     c.Timestamp,
+		EditedAt:      editedAt,
+		RevisionCount: c.RevisionCount,
+		Score:         c.Score,
+	}
+}
+
+// RevisionRowsToRevisions converts the rows of GetCommentRevisions to CommentRevision structs.
+func RevisionRowsToRevisions(rows []sqlc.GetCommentRevisionsRow) []CommentRevision {
+	revisions := make([]CommentRevision, 0, len(rows))
+	for _, row := range rows {
+		revisions = append(revisions, CommentRevision{
+			RevisionID:  uuid.UUID(row.RevisionID.Bytes),
+			CommentText: row.CommentText,
+			WrittenAt:   numericToTimestamp(row.WrittenAt),
+			ReplacedAt:  numericToTimestamp(row.ReplacedAt),
+		})
 	}
+	return revisions
 }
 
 // ToResponseSlice converts a slice of Comment to a slice of ResponseComment.
@@ -254,16 +436,89 @@ func ToResponseSlice(comments []Comment) []ResponseComment {
 	return response
 }
 
+// ToThreadedResponseSlice converts a slice of Comment to a flattened thread of ResponseComment. The top-level
+// comments keep their order in the slice, and the replies, which must be ordered newest first, follow their parent
+// oldest first, with Depth set to the reply's nesting level.
+// Replies whose parent is not in the slice (e.g. because it was hidden) are left out along with their own replies.
+func ToThreadedResponseSlice(comments []Comment) []ResponseComment {
+	// Group replies under their parents. Iterating backwards keeps replies in chronological order,
+	// while prepending keeps top-level comments in their original order.
+	replies := map[uuid.UUID][]Comment{}
+	var topLevel []Comment
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := comments[i]
+		if comment.ParentID == nil {
+			topLevel = append([]Comment{comment}, topLevel...)
+			continue
+		}
+		replies[*comment.ParentID] = append(replies[*comment.ParentID], comment)
+	}
+
+	var response []ResponseComment
+	var appendThread func(comment Comment, depth int)
+	appendThread = func(comment Comment, depth int) {
+		responseComment := comment.ToResponse()
+		responseComment.Depth = depth
+		response = append(response, responseComment)
+		for _, reply := range replies[comment.CommentID] {
+			appendThread(reply, depth+1)
+		}
+	}
+	for _, comment := range topLevel {
+		appendThread(comment, 0)
+	}
+
+	return response
+}
+
+// numericToTimestamp converts a timestamp from EXTRACT(EPOCH FROM ...) to microseconds, returning 0 for NULL.
+func numericToTimestamp(extract pgtype.Numeric) int64 {
+	if !extract.Valid {
+		return 0
+	}
+	return extract.Int.Int64()
+}
+
+// DropDeletedLeaves removes the deleted comments that have no replies left, so that deleted comments only show
+// up as tombstones when a thread continues below them.
+func DropDeletedLeaves(comments []Comment) []Comment {
+	for {
+		hasReplies := map[uuid.UUID]bool{}
+		for _, comment := range comments {
+			if comment.ParentID != nil {
+				hasReplies[*comment.ParentID] = true
+			}
+		}
+
+		remaining := slices.DeleteFunc(slices.Clone(comments), func(comment Comment) bool {
+			return comment.DeletedAt != 0 && !hasReplies[comment.CommentID]
+		})
+		if len(remaining) == len(comments) {
+			return remaining
+		}
+		comments = remaining
+	}
+}
+
+// pgUUIDToUUIDPtr converts a nullable pgtype.UUID to a *uuid.UUID, returning nil for NULL.
+func pgUUIDToUUIDPtr(id pgtype.UUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	converted := uuid.UUID(id.Bytes)
+	return &converted
+}
+
 var TempCommentDB = map[string][]Comment{}
 
 // TempCommentDB is a temporary in-memory database for comments.
 // The key is the listing ID, and the value is a slice of comments for that listing.
-// This is used for demonstration purposes and should be replaced with a proper database in production.
+// It seeds the in-memory comment store used when the server runs without a database.
 
 func InitTempCommentDB() {
-	// Reference times
-	now := int64(1748366686) // today
-	oneDay := int64(86400)
+	// Reference times, in microseconds like the timestamps from the database
+	now := int64(1748366686) * 1_000_000 // today
+	oneDay := int64(86400) * 1_000_000
 
 	// Helper to generate a new V7 UUID or panic if error
 	newV7 := func() uuid.UUID {
@@ -274,9 +529,9 @@ func InitTempCommentDB() {
 		return id
 	}
 
-	TempCommentDB["32707340"] = []Comment{
+	TempCommentDB["zillow:32707340"] = []Comment{
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -285,7 +540,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 10*oneDay, // 10 days ago
 		},
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -294,7 +549,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 8*oneDay, // 8 days ago
 		},
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -303,7 +558,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 6*oneDay, // 6 days ago
 		},
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -312,7 +567,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 5*oneDay, // 5 days ago
 		},
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -321,7 +576,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 4*oneDay, // 4 days ago
 		},
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -330,7 +585,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 3*oneDay, // 3 days ago
 		},
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -339,7 +594,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 2*oneDay, // 2 days ago
 		},
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -348,7 +603,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - oneDay, // yesterday
 		},
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -357,7 +612,7 @@ func InitTempCommentDB() {
 			Timestamp:     now, // today
 		},
 		{
-			TargetListing: "32707340",
+			TargetListing: "zillow:32707340",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -367,9 +622,9 @@ func InitTempCommentDB() {
 		},
 	}
 
-	TempCommentDB["32692760"] = []Comment{
+	TempCommentDB["zillow:32692760"] = []Comment{
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -378,7 +633,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 12*oneDay, // 12 days ago
 		},
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -387,7 +642,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 9*oneDay, // 9 days ago
 		},
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -396,7 +651,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 7*oneDay, // 7 days ago
 		},
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -405,7 +660,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 5*oneDay, // 5 days ago
 		},
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -414,7 +669,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 3*oneDay, // 3 days ago
 		},
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -423,7 +678,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - 2*oneDay, // 2 days ago
 		},
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -432,7 +687,7 @@ func InitTempCommentDB() {
 			Timestamp:     now - oneDay, // yesterday
 		},
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -441,7 +696,7 @@ func InitTempCommentDB() {
 			Timestamp:     now, // today
 		},
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -450,7 +705,7 @@ func InitTempCommentDB() {
 			Timestamp:     now, // today
 		},
 		{
-			TargetListing: "32692760",
+			TargetListing: "zillow:32692760",
 			CommentID:     newV7(),
 			UserIP:        "",
 			UserID:        "",
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+
+	"zillow-commenter.com/m/db/postgres/sqlc"
+
+	"github.com/google/uuid"
+)
+
+// Webhook is a target URL that the events of a listing, or of every listing if ListingID is empty, are posted to.
+// Secret signs the requests. It is only shown when the webhook is created.
+type Webhook struct {
+	WebhookID  uuid.UUID `json:"webhook_id"`
+	ListingID  string    `json:"listing_id"`
+	TargetURL  string    `json:"target_url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	Timestamp  int64     `json:"timestamp"`
+}
+
+// WebhookAttempt is an attempt at delivering an event to a webhook, with the current status of the delivery.
+// StatusCode is nil if the target didn't respond.
+type WebhookAttempt struct {
+	EventID        uuid.UUID `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	DeliveryStatus string    `json:"delivery_status"`
+	Attempt        int       `json:"attempt"`
+	StatusCode     *int      `json:"status_code"`
+	Error          string    `json:"error"`
+	DurationMs     int       `json:"duration_ms"`
+	Timestamp      int64     `json:"timestamp"`
+}
+
+// WebhookRowToWebhook converts a webhooks table row to a Webhook struct, secret included.
+func WebhookRowToWebhook(row sqlc.Webhook) (*Webhook, error) {
+	webhookUUID, err := uuid.FromBytes(row.WebhookID.Bytes[:])
+	if err != nil {
+		return nil, errors.Join(errors.New("invalid webhook ID format"), err)
+	}
+
+	return &Webhook{
+		WebhookID:  webhookUUID,
+		ListingID:  row.ListingID.String,
+		TargetURL:  row.TargetUrl,
+		EventTypes: row.EventTypes,
+		Secret:     row.Secret,
+		Timestamp:  row.DateCreated.Time.Unix(),
+	}, nil
+}
+
+// WebhookRowsToWebhooks converts a slice of webhooks table rows to a slice of Webhook structs, without their secrets.
+func WebhookRowsToWebhooks(rows []sqlc.Webhook) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	for _, row := range rows {
+		webhook, err := WebhookRowToWebhook(row)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Secret = ""
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, nil
+}
+
+// WebhookAttemptRowsToAttempts converts rows from ListWebhookAttempts to WebhookAttempt structs.
+func WebhookAttemptRowsToAttempts(rows []sqlc.ListWebhookAttemptsRow) ([]WebhookAttempt, error) {
+	attempts := []WebhookAttempt{}
+	for _, row := range rows {
+		eventUUID, err := uuid.FromBytes(row.EventID.Bytes[:])
+		if err != nil {
+			return nil, errors.Join(errors.New("invalid event ID format"), err)
+		}
+
+		attempt := WebhookAttempt{
+			EventID:        eventUUID,
+			EventType:      row.EventType,
+			DeliveryStatus: row.Status,
+			Attempt:        int(row.Attempt),
+			Error:          row.Error,
+			DurationMs:     int(row.DurationMs),
+			Timestamp:      row.DateCreated.Time.Unix(),
+		}
+		if row.StatusCode.Valid {
+			statusCode := int(row.StatusCode.Int32)
+			attempt.StatusCode = &statusCode
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"zillow-commenter.com/m/api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:zillow-commenter:problem:"
+
+	// multipartMemory is how much of a multipart form is kept in memory, like gin does for c.PostForm
+	multipartMemory = 32 << 20
+)
+
+// The codes of the problems returned to clients. They are part of the API, so they must not change. The comment
+// filters and the blacklist have codes of their own, e.g. "comment_too_long" or "blacklisted_ip".
+const (
+	codeInternal             = "internal"
+	codeInvalidBody          = "invalid_body"
+	codeMissingField         = "missing_field"
+	codeInvalidField         = "invalid_field"
+	codeInvalidValue         = "invalid_value"
+	codeTooLong              = "too_long"
+	codeInvalidListing       = "invalid_listing"
+	codeInvalidParent        = "invalid_parent"
+	codeTooManyListings      = "too_many_listings"
+	codeMissingAuthorization = "missing_authorization"
+	codeInvalidAuthorization = "invalid_authorization"
+	codeInvalidToken         = "invalid_token"
+	codeInvalidAdminKey      = "invalid_admin_key"
+	codeNotAuthor            = "not_author"
+	codeEditWindowClosed     = "edit_window_closed"
+	codeOriginNotAllowed     = "origin_not_allowed"
+	codeNotFound             = "not_found"
+	codeRateLimited          = "rate_limited"
+	codeNotAvailable         = "not_available"
+)
+
+// newProblem builds the problem details of a failed request.
+func newProblem(c *gin.Context, status int, code, detail string, fieldErrors ...models.FieldError) models.Problem {
+	return models.Problem{
+		Type:      problemTypePrefix + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		RequestID: getRequestID(c),
+		Errors:    fieldErrors,
+	}
+}
+
+// writeProblem writes a problem as application/problem+json. gin only sets the content type if it isn't set yet.
+func writeProblem(c *gin.Context, problem models.Problem) {
+	c.Header("Content-Type", problemContentType)
+	c.JSON(problem.Status, problem)
+}
+
+// respondProblem answers a request with an error, as a problem details object.
+func respondProblem(c *gin.Context, status int, code, detail string, fieldErrors ...models.FieldError) {
+	writeProblem(c, newProblem(c, status, code, detail, fieldErrors...))
+}
+
+// abortWithProblem is respondProblem for middleware, which also stops the handlers after it from running.
+func abortWithProblem(c *gin.Context, status int, code, detail string) {
+	c.Abort()
+	respondProblem(c, status, code, detail)
+}
+
+// respondInternalError answers a request that failed because of the server. The cause is only logged, never sent.
+func respondInternalError(c *gin.Context) {
+	respondProblem(c, http.StatusInternalServerError, codeInternal, "Internal server error")
+}
+
+// respondInvalidField answers a request with a 400 about one of its fields, or path or query parameters.
+func respondInvalidField(c *gin.Context, field, code, detail string) {
+	respondProblem(c, http.StatusBadRequest, code, detail, models.FieldError{Field: field, Code: code, Detail: detail})
+}
+
+// fieldError is an error about a single field of a request, for the helpers that validate several fields.
+type fieldError struct {
+	field  string
+	detail string
+}
+
+func (err fieldError) Error() string {
+	return err.detail
+}
+
+// respondFieldError answers a request with a 400 about the field of err, if err is a fieldError.
+func respondFieldError(c *gin.Context, err error) {
+	var invalid fieldError
+	if errors.As(err, &invalid) {
+		respondInvalidField(c, invalid.field, codeInvalidField, invalid.detail)
+		return
+	}
+	respondProblem(c, http.StatusBadRequest, codeInvalidField, err.Error())
+}
+
+// bindBody reads the body of a request into obj, and validates it against the binding tags of obj. The body can be
+// a JSON object, or a URL-encoded or multipart form, whose fields are named after the json and form tags of obj.
+//
+// JSON bodies are kept in the context, so that the body can be bound more than once, e.g. by a middleware and then
+// by the handler.
+func bindBody(c *gin.Context, obj any) error {
+	if c.ContentType() == binding.MIMEJSON {
+		return c.ShouldBindBodyWithJSON(obj)
+	}
+
+	// Parse multipart forms first, so that their fields are in the post form too
+	err := c.Request.ParseMultipartForm(multipartMemory)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+	return c.ShouldBindWith(obj, binding.FormPost)
+}
+
+// respondBindError answers a request whose body bindBody couldn't read or validate with a 400, with a field error
+// for each invalid field. It returns the code of the problem, e.g. for metrics.
+func respondBindError(c *gin.Context, err error) string {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fieldErrors := make([]models.FieldError, 0, len(validationErrors))
+		details := make([]string, 0, len(validationErrors))
+		for _, validationError := range validationErrors {
+			converted := convertFieldError(validationError)
+			fieldErrors = append(fieldErrors, converted)
+			details = append(details, converted.Detail)
+		}
+		// The problem takes the code of its first field, so that clients checking a single code see the main one
+		code := fieldErrors[0].Code
+		respondProblem(c, http.StatusBadRequest, code, strings.Join(details, "; "), fieldErrors...)
+		return code
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && typeError.Field != "" {
+		detail := fmt.Sprintf("%s must be a %s", typeError.Field, jsonTypeName(typeError.Type))
+		respondInvalidField(c, typeError.Field, codeInvalidField, detail)
+		return codeInvalidField
+	}
+
+	detail := "Invalid request body"
+	if errors.Is(err, io.EOF) {
+		detail = "Request body is empty"
+	}
+	respondProblem(c, http.StatusBadRequest, codeInvalidBody, detail)
+	return codeInvalidBody
+}
+
+// convertFieldError describes a failed validation tag to the client.
+func convertFieldError(validationError validator.FieldError) models.FieldError {
+	field := validationError.Field()
+	switch validationError.Tag() {
+	case "required":
+		return models.FieldError{Field: field, Code: codeMissingField, Detail: fmt.Sprintf("%s is required", field)}
+	case "max":
+		return models.FieldError{
+			Field:  field,
+			Code:   codeTooLong,
+			Detail: fmt.Sprintf("%s exceeds maximum length of %s characters", field, validationError.Param()),
+		}
+	case "oneof":
+		return models.FieldError{
+			Field:  field,
+			Code:   codeInvalidValue,
+			Detail: fmt.Sprintf("%s must be one of %s", field, strings.Join(strings.Fields(validationError.Param()), ", ")),
+		}
+	default:
+		return models.FieldError{Field: field, Code: codeInvalidField, Detail: fmt.Sprintf("Invalid %s", field)}
+	}
+}
+
+// jsonTypeName names a Go type the way JSON would.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.String:
+		return "string"
+	default:
+		return "object"
+	}
+}
+
+// useJSONFieldNames makes the validator name fields after their json tag rather than their Go name, so that field
+// errors name what the client sent.
+func useJSONFieldNames() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
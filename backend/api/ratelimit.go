@@ -0,0 +1,79 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimits are the limits on posting comments. Each one is a separate token bucket, and a post must get
+// a token from all of them.
+type RateLimits struct {
+	// PerIP limits the posts from a single client IP
+	PerIP ratelimit.Limit
+	// PerUser limits the posts from a single user ID
+	PerUser ratelimit.Limit
+	// PerListing limits the posts on a single listing, across every user
+	PerListing ratelimit.Limit
+}
+
+// postRateLimitMiddleware limits how often comments can be posted per client IP, per user and per listing.
+// It must run after authMiddleware. Requests over a limit are aborted with a 429 and a Retry-After header.
+func (server *Server) postRateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := ""
+		if payload := getAuthPayload(c); payload != nil {
+			userID = payload.UserID
+		}
+
+		type rateLimitBucket struct {
+			name  string
+			key   string
+			limit ratelimit.Limit
+		}
+		buckets := []rateLimitBucket{
+			{"ip", "ip:" + clientIP(c), server.rateLimits.PerIP},
+			{"user", "user:" + userID, server.rateLimits.PerUser},
+		}
+
+		// Count posts against the canonical listing key, however the client referred to the listing. Posts on
+		// listings that don't parse, or whose body doesn't, are rejected by the handler, but still count against the
+		// IP and user. They get no listing bucket, so that made-up listing IDs don't each create one.
+		var request models.ListingRef
+		_ = bindBody(c, &request)
+		if listingKey, err := parseListing(request.ListingID, request.URL); err == nil {
+			buckets = append(buckets, rateLimitBucket{"listing", "listing:" + listingKey.String(), server.rateLimits.PerListing})
+		}
+
+		// Stop at the first exhausted bucket, so that refused posts don't use up the tokens of the next ones
+		for _, bucket := range buckets {
+			if !bucket.limit.Enabled() {
+				continue
+			}
+
+			result, err := server.rateLimiter.Take(c.Request.Context(), bucket.key, bucket.limit)
+			if err != nil {
+				// Let the post through rather than refusing everyone while the limiter is unavailable
+				getLogger(c).Error("failed to check rate limit", logging.Error(err))
+				continue
+			}
+			if !result.Allowed {
+				getLogger(c).Info("rate limited", slog.String("bucket", bucket.name))
+				server.metrics.CommentRejected("rate_limited")
+				retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+				c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+				abortWithProblem(c, http.StatusTooManyRequests, codeRateLimited, "Too many comments, please try again later")
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"zillow-commenter.com/m/ratelimit"
+)
+
+// recordingLimiter lets every request through, and keeps the keys of the buckets taken from.
+type recordingLimiter struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (limiter *recordingLimiter) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.keys = append(limiter.keys, key)
+	return ratelimit.Result{Allowed: true}, nil
+}
+
+func TestPostRateLimitSkipsInvalidListings(t *testing.T) {
+	limit := ratelimit.Limit{Burst: 10, Period: time.Minute}
+	server, _ := newTestServer(t, ServerOptions{RateLimits: RateLimits{PerIP: limit, PerUser: limit, PerListing: limit}})
+	limiter := &recordingLimiter{}
+	server.rateLimiter = limiter
+	sessionToken := userToken(t, server, "alice")
+
+	// Posts count against the canonical key of their listing
+	body := map[string]string{"url": "https://www.zillow.com/homedetails/123-Main-St/12345_zpid/", "username": "alice", "comment_text": "hello"}
+	do(t, server, http.MethodPost, "/api/v1/comments", sessionToken, body, http.StatusCreated)
+	want := []string{"ip:192.0.2.1", "user:alice", "listing:zillow:12345"}
+	if !slices.Equal(limiter.keys, want) {
+		t.Errorf("buckets = %q, want %q", limiter.keys, want)
+	}
+
+	// Listing IDs that don't parse get no bucket, whatever their length
+	limiter.keys = nil
+	body = map[string]string{"listing_id": strings.Repeat("x", 1000), "username": "alice", "comment_text": "hello"}
+	do(t, server, http.MethodPost, "/api/v1/comments", sessionToken, body, http.StatusBadRequest)
+	want = []string{"ip:192.0.2.1", "user:alice"}
+	if !slices.Equal(limiter.keys, want) {
+		t.Errorf("buckets = %q, want %q", limiter.keys, want)
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"zillow-commenter.com/m/logging"
+)
+
+// retentionJobInterval is how often the standalone server runs the retention job
+const retentionJobInterval = 24 * time.Hour
+
+// PurgeDeletedComments permanently deletes the comments that were soft-deleted longer ago than the server's
+// retention period, and returns how many were purged. Deleted comments that still have replies stay as tombstones,
+// but their text and author are erased.
+func (server *Server) PurgeDeletedComments(ctx context.Context) (int64, error) {
+	return server.store.PurgeDeletedComments(ctx, time.Now().Add(-server.deletedCommentRetention))
+}
+
+// RunRetentionJob purges the expired deleted comments right away, then every retentionJobInterval until the
+// context is done. Failures are logged and retried at the next run.
+func (server *Server) RunRetentionJob(ctx context.Context) {
+	ticker := time.NewTicker(retentionJobInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := server.PurgeDeletedComments(ctx)
+		if err != nil {
+			slog.Error("failed to purge deleted comments", logging.Error(err))
+		} else {
+			slog.Info("purged deleted comments", slog.Int64("purged", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
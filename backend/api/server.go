@@ -3,101 +3,453 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
-	"os"
+	"slices"
+	"sync/atomic"
+	"time"
 
 	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/config"
+	"zillow-commenter.com/m/db/postgres/migrations"
+	"zillow-commenter.com/m/filter"
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/metrics"
+	"zillow-commenter.com/m/notify"
+	"zillow-commenter.com/m/ratelimit"
+	"zillow-commenter.com/m/store"
+	"zillow-commenter.com/m/stream"
 	"zillow-commenter.com/m/token"
+	"zillow-commenter.com/m/webhook"
 
 	ginadapter "github.com/awslabs/aws-lambda-go-api-proxy/gin"
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
 )
 
 type Server struct {
 	Router        *gin.Engine
 	LambdaAdapter *ginadapter.GinLambda
 	maker         *token.PasetoMaker
-	pool          *pgxpool.Pool
+	store         store.CommentStore
+
+	// pool is the Postgres pool backing the admin API. It is nil when the server runs without a database.
+	pool *pgxpool.Pool
+
+	// adminKey is the static key that must be sent in the X-Admin-Key header to use the admin API
+	adminKey string
+
+	// hideBlacklistedComments leaves comments by blacklisted users out of GetListingComments
+	hideBlacklistedComments bool
+
+	// maxReplyDepth is how deeply replies may be nested below a top-level comment
+	maxReplyDepth int
+
+	// commentEditWindow is how long after posting a comment its author may edit it. Editing is disabled if it is 0.
+	commentEditWindow time.Duration
+
+	// deletedCommentRetention is how long soft-deleted comments are kept before the retention job purges them
+	deletedCommentRetention time.Duration
+
+	// reportHideThreshold is how many open reports hide a comment until a moderator reviews them. Reports never
+	// hide comments if it is 0.
+	reportHideThreshold int
+
+	// commentFilters validate and clean up comments before they are posted or edited
+	commentFilters filter.Pipeline
+
+	// commentHub fans new comments out to the comment streams, which are only served while streaming is set
+	commentHub *stream.Hub
+	streaming  atomic.Bool
+
+	// notifier sends the subscription digests and verification emails, every digestInterval. Subscriptions get no
+	// emails if it is nil. publicBaseURL is the URL the API is reachable at, which the links in the emails start with.
+	notifier       notify.Notifier
+	publicBaseURL  string
+	digestInterval time.Duration
+
+	// userTokenDuration is how long session tokens stay valid, userSessionLifetime how long they can be refreshed
+	// for, and verifyEmailTokenDuration and unsubscribeTokenDuration how long the links in the emails work
+	userTokenDuration        time.Duration
+	userSessionLifetime      time.Duration
+	verifyEmailTokenDuration time.Duration
+	unsubscribeTokenDuration time.Duration
+
+	// webhooks queues events for the registered webhooks and delivers them. It is nil when the server runs without a
+	// database.
+	webhooks *webhook.Dispatcher
+
+	// metrics records the requests and comments. Nothing is recorded unless ServePrometheusMetrics or WriteEMFMetrics
+	// is called.
+	metrics metrics.Recorder
+
+	// cors is which browser origins may call the API, and what their requests may carry
+	cors CORSPolicy
+
+	// rateLimiter keeps the token buckets of rateLimits, in Postgres if the server has a pool and in memory otherwise
+	rateLimiter ratelimit.Store
+	rateLimits  RateLimits
+}
+
+// ServerOptions holds the settings of a Server that don't come from its dependencies.
+type ServerOptions struct {
+	// AdminKey is the static key that must be sent in the X-Admin-Key header to use the admin API.
+	// The admin API refuses every request if it is empty.
+	AdminKey string
+
+	// HideBlacklistedComments leaves comments by blacklisted users out of GetListingComments.
+	HideBlacklistedComments bool
+
+	// MaxReplyDepth is how deeply replies may be nested below a top-level comment.
+	MaxReplyDepth int
+
+	// RateLimits are the limits on posting comments.
+	RateLimits RateLimits
+
+	// CommentEditWindow is how long after posting a comment its author may edit it. Editing is disabled if it is 0.
+	CommentEditWindow time.Duration
+
+	// DeletedCommentRetention is how long soft-deleted comments are kept before the retention job purges them.
+	DeletedCommentRetention time.Duration
+
+	// ReportHideThreshold is how many open reports hide a comment until a moderator reviews them.
+	// Reports never hide comments if it is 0.
+	ReportHideThreshold int
+
+	// CommentFilters validate and clean up comments before they are posted or edited.
+	// The default pipeline is used if it is nil.
+	CommentFilters filter.Pipeline
+
+	// Notifier sends the subscription digests and verification emails. Subscriptions get no emails if it is nil.
+	Notifier notify.Notifier
+
+	// PublicBaseURL is the URL the API is reachable at, which the links in the emails start with.
+	PublicBaseURL string
+
+	// DigestInterval is how often the digest job sends the subscription digests.
+	DigestInterval time.Duration
+
+	// UserTokenDuration is how long session tokens stay valid, and UserSessionLifetime how long after the first one
+	// of a user ID they can be refreshed for.
+	UserTokenDuration   time.Duration
+	UserSessionLifetime time.Duration
+
+	// VerifyEmailTokenDuration and UnsubscribeTokenDuration are how long the links in the emails work.
+	VerifyEmailTokenDuration time.Duration
+	UnsubscribeTokenDuration time.Duration
+
+	// CORS is which browser origins may call the API, and what their requests may carry.
+	CORS CORSPolicy
+
+	// TrustedProxies are the IPs or CIDR ranges of the reverse proxies whose X-Forwarded-For header gives the client
+	// IP. None is trusted if it is empty.
+	TrustedProxies []string
 }
 
 func (server *Server) GetPostgresPool() *pgxpool.Pool {
 	return server.pool
 }
 
-func GetNewServer() (*Server, error) {
-	//load env vars
-	godotenv.Load()
-	key := os.Getenv("TOKEN_KEY")
-	tokenMaker, err := token.NewPasetoMaker(key)
+// GetNewServer builds a server from the given settings, which it validates first.
+// Comments are kept in Postgres if a connection string is set, and in memory (seeded with sample comments) otherwise.
+func GetNewServer(cfg *config.Config) (*Server, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenMaker, err := token.NewPasetoMaker(cfg.Token.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	commentFilterConfig, err := newCommentFilterConfig(cfg.Comments)
+	if err != nil {
+		return nil, err
+	}
+
+	notifier, err := newNotifier(cfg.Email)
 	if err != nil {
 		return nil, err
 	}
 
-	pool, err := pgxpool.New(context.Background(), os.Getenv("CONNECTION_STRING"))
+	options := ServerOptions{
+		AdminKey:                 cfg.Admin.APIKey,
+		HideBlacklistedComments:  cfg.Comments.HideBlacklistedComments,
+		MaxReplyDepth:            cfg.Comments.MaxReplyDepth,
+		RateLimits:               RateLimits(cfg.RateLimits),
+		CommentEditWindow:        cfg.Comments.EditWindow,
+		DeletedCommentRetention:  time.Duration(cfg.Comments.DeletedCommentRetentionDays) * 24 * time.Hour,
+		ReportHideThreshold:      cfg.Comments.ReportHideThreshold,
+		CommentFilters:           filter.NewPipeline(commentFilterConfig),
+		Notifier:                 notifier,
+		PublicBaseURL:            cfg.Email.PublicBaseURL,
+		DigestInterval:           cfg.Email.DigestInterval,
+		UserTokenDuration:        cfg.Token.UserTokenDuration,
+		UserSessionLifetime:      cfg.Token.UserSessionLifetime,
+		VerifyEmailTokenDuration: cfg.Token.VerifyEmailTokenDuration,
+		UnsubscribeTokenDuration: cfg.Token.UnsubscribeTokenDuration,
+		CORS:                     CORSPolicy(cfg.CORS),
+		TrustedProxies:           cfg.Server.TrustedProxies,
+	}
+
+	if len(cfg.CORS.AllowedOrigins) == 0 {
+		slog.Warn("CORS_ALLOWED_ORIGINS is not set, refusing every cross-origin request")
+	} else if slices.Contains(cfg.CORS.AllowedOrigins, config.AnyOrigin) {
+		slog.Warn("CORS_ALLOWED_ORIGINS allows every origin")
+	}
+
+	if cfg.Database.ConnectionString == "" {
+		slog.Warn("CONNECTION_STRING is not set, keeping comments in memory")
+		models.InitTempCommentDB() // Initialize the temporary comment database
+		return NewServer(store.NewMemoryStore(models.TempCommentDB), tokenMaker, nil, options), nil
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.Database.ConnectionString)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("invalid CONNECTION_STRING"))
+	}
+	poolConfig.MaxConns = cfg.Database.MaxConns
+	poolConfig.MinConns = cfg.Database.MinConns
+	poolConfig.MaxConnLifetime = cfg.Database.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.Database.MaxConnIdleTime
+	poolConfig.HealthCheckPeriod = cfg.Database.HealthCheckPeriod
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	router := gin.Default()
-	// Set up CORS middleware to allow all origins, methods, and headers
-	router.Use(cors.Default())
+	// Refuse to start on a database the queries were not written for
+	err = migrations.CheckVersion(context.Background(), pool)
+	if err != nil {
+		pool.Close()
+		return nil, errors.Join(err, errors.New("run the migrations with: migrate up, or start with AUTO_MIGRATE=true"))
+	}
+
+	return NewServer(store.NewPostgresStore(pool), tokenMaker, pool, options), nil
+}
+
+// NewServer builds a server that keeps comments in the given store.
+// The admin API is only mounted if a Postgres pool is given, and rate limits are only shared between instances if so.
+func NewServer(commentStore store.CommentStore, tokenMaker *token.PasetoMaker, pool *pgxpool.Pool, options ServerOptions) *Server {
+	router := gin.New()
+
+	// gin trusts every proxy by default, which would let clients pick their IP with an X-Forwarded-For header
+	err := router.SetTrustedProxies(options.TrustedProxies)
+	if err != nil {
+		slog.Error("invalid trusted proxies, trusting none", logging.Error(err))
+		_ = router.SetTrustedProxies(nil)
+	}
 
 	server := &Server{
 		Router: router,
 		maker:  tokenMaker,
+		store:  commentStore,
 		pool:   pool,
+
+		adminKey:                 options.AdminKey,
+		hideBlacklistedComments:  options.HideBlacklistedComments,
+		maxReplyDepth:            options.MaxReplyDepth,
+		commentEditWindow:        options.CommentEditWindow,
+		deletedCommentRetention:  options.DeletedCommentRetention,
+		reportHideThreshold:      options.ReportHideThreshold,
+		commentFilters:           options.CommentFilters,
+		rateLimits:               options.RateLimits,
+		cors:                     options.CORS,
+		commentHub:               stream.NewHub(),
+		notifier:                 options.Notifier,
+		publicBaseURL:            options.PublicBaseURL,
+		digestInterval:           options.DigestInterval,
+		userTokenDuration:        options.UserTokenDuration,
+		userSessionLifetime:      options.UserSessionLifetime,
+		verifyEmailTokenDuration: options.VerifyEmailTokenDuration,
+		unsubscribeTokenDuration: options.UnsubscribeTokenDuration,
+		metrics:                  metrics.Nop{},
+	}
+	if server.commentFilters == nil {
+		server.commentFilters = filter.NewPipeline(filter.DefaultConfig())
+	}
+	if server.digestInterval <= 0 {
+		server.digestInterval = config.DefaultDigestInterval
+	}
+	if server.userTokenDuration <= 0 {
+		server.userTokenDuration = config.DefaultUserTokenDuration
+	}
+	if server.userSessionLifetime <= 0 {
+		server.userSessionLifetime = max(config.DefaultUserSessionLifetime, server.userTokenDuration)
+	}
+	if server.verifyEmailTokenDuration <= 0 {
+		server.verifyEmailTokenDuration = config.DefaultVerifyEmailTokenDuration
 	}
+	if server.unsubscribeTokenDuration <= 0 {
+		server.unsubscribeTokenDuration = config.DefaultUnsubscribeTokenDuration
+	}
+	if len(server.cors.AllowedMethods) == 0 {
+		server.cors.AllowedMethods = config.Default().CORS.AllowedMethods
+	}
+	if len(server.cors.AllowedHeaders) == 0 {
+		server.cors.AllowedHeaders = config.Default().CORS.AllowedHeaders
+	}
+	// Name the fields of validation errors as clients send them
+	useJSONFieldNames()
+	if pool != nil {
+		server.rateLimiter = ratelimit.NewPostgresStore(pool)
+		server.webhooks = webhook.NewDispatcher(pool)
+	} else {
+		server.rateLimiter = ratelimit.NewMemoryStore()
+	}
+
+	// Log every request as JSON, including the ones that panic
+	router.Use(server.requestLoggingMiddleware())
+	router.Use(server.metricsMiddleware())
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		getLogger(c).Error("recovered from panic", slog.String("panic", fmt.Sprint(recovered)))
+		c.Abort()
+		if !c.Writer.Written() {
+			respondInternalError(c)
+		}
+	}))
+	// Answer preflight requests, and refuse the mutating requests of the origins the CORS policy doesn't allow
+	router.Use(server.corsMiddleware())
 
 	// =============================================================================================================== //
 	//                                             Mount routes below                                                  //
 	// =============================================================================================================== //
 
+	// Liveness and readiness probes, and the build of the server
+	router.GET("/healthz", server.Healthz)
+	router.GET("/readyz", server.Readyz)
+	router.GET("/version", server.Version)
+
 	// Top-leve api routes
 	api := router.Group("/api")
 	{
 		// Gives information about the API in general, particularly about how to switch between versions
-		api.GET("", server.NotImplemented)
+		api.GET("", server.GetAPIIndex)
 
 		// Version 1 of the API routes
 		api_v1 := api.Group("/v1")
 		{
 			// Gives information about the first version of the API
-			api_v1.GET("", server.NotImplemented)
+			api_v1.GET("", server.GetAPIVersion)
 
 			// Comment routes
 			comments := api_v1.Group("/comments")
 			{
-				// Gets all comments for a specific zillow listing
-				comments.GET(":listing_id", server.GetListingComments)
+				// Gets all comments for a specific listing, given by its ID or (without it) by its URL, with the votes of
+				// the user identified by the token, if any
+				comments.GET("", server.optionalAuthMiddleware(), server.GetListingComments)
+				comments.GET(":listing_id", server.optionalAuthMiddleware(), server.GetListingComments)
+
+				// Creates a new comment for a specific listing, as the user identified by the token
+				comments.POST("", server.authMiddleware(), server.postRateLimitMiddleware(), server.PostListingComment)
+
+				// Edits a comment, as its author, and gets its edit history
+				comments.PATCH(":comment_id", server.authMiddleware(), server.EditComment)
+				comments.GET(":listing_id/:comment_id/revisions", server.GetCommentRevisions)
+				comments.GET("revisions/:comment_id", server.GetCommentRevisions)
+
+				// Streams the new comments on a specific listing, given by its ID or (without it) by its URL, in the
+				// standalone server
+				comments.GET(":listing_id/stream", server.StreamListingComments)
+				comments.GET("stream", server.StreamListingComments)
+
+				// Deletes a comment, as its author
+				comments.DELETE(":comment_id", server.authMiddleware(), server.DeleteComment)
+
+				// Upvotes, downvotes, or takes back the vote on a comment, as the user identified by the token
+				comments.POST(":comment_id/vote", server.authMiddleware(), server.VoteComment)
+
+				// Reports a comment to the moderators, as the user identified by the token
+				comments.POST(":comment_id/report", server.authMiddleware(), server.ReportComment)
+			}
+
+			// Listing routes
+			listings := api_v1.Group("/listings")
+			{
+				// Counts the comments on several listings at once, for search result pages
+				listings.POST("/counts", server.GetListingCommentCounts)
+
+				// Subscribes to the comments on a listing, or unsubscribes, as the user identified by the token
+				listings.POST(":listing_id/subscribe", server.authMiddleware(), server.SubscribeListing)
+				listings.DELETE(":listing_id/subscribe", server.authMiddleware(), server.UnsubscribeListing)
 
-				// Creates a new comment for a specific zillow listing
-				comments.POST("", server.PostListingComment)
+				// Unsubscribes and verifies emails through the links sent in the emails, without a session token. The
+				// unsubscribe link only shows a page asking to confirm, since mail scanners follow links too.
+				listings.GET("/unsubscribe", server.ConfirmUnsubscribe)
+				listings.POST("/unsubscribe", server.UnsubscribeWithToken)
+				listings.GET("/verify-email", server.VerifySubscriptionEmail)
 			}
 
 			// User routes
 			user := api_v1.Group("/user")
 			{
-				user.GET("/user_id", server.GenerateUserID)
+				// Generates a user ID without a session token. Deprecated in favor of POST /token.
+				user.GET("/user_id", deprecatedMiddleware(deprecatedEndpoints[0].successor), server.GenerateUserID)
+
+				// Issues a new user ID along with a session token bound to it, to clients that aren't blacklisted by IP
+				user.POST("/token", server.IssueUserToken)
+
+				// Reissues a session token for the user ID of a still-valid token, until its session's lifetime is up
+				user.POST("/token/refresh", server.authMiddleware(), server.RefreshUserToken)
 			}
 		}
+
+		// Moderation routes, authenticated with the admin key. They work directly on the database.
+		if server.pool != nil {
+			admin := api.Group("/admin", server.adminAuthMiddleware())
+			// Lists the most recent comments across all listings, including identifying information
+			admin.GET("/comments", server.AdminListRecentComments)
+
+			// Hides or unhides a comment without deleting it
+			admin.POST("/comments/:comment_id/hide", server.AdminHideComment)
+			admin.POST("/comments/:comment_id/unhide", server.AdminUnhideComment)
+
+			// Deletes a comment, leaving a tombstone if it has replies
+			admin.DELETE("/comments/:comment_id", server.AdminDeleteComment)
+
+			// Manages the blacklist
+			admin.GET("/blacklist", server.AdminListBlacklist)
+			admin.POST("/blacklist", server.AdminAddBlacklistEntry)
+			admin.DELETE("/blacklist/:blacklist_id", server.AdminRemoveBlacklistEntry)
+
+			// Lists the report queue, and upholds or rejects reports
+			admin.GET("/reports", server.AdminListReports)
+			admin.POST("/reports/:report_id/resolve", server.AdminResolveReport)
+			admin.POST("/reports/:report_id/dismiss", server.AdminDismissReport)
+
+			// Manages the webhooks, and lists their delivery attempts
+			admin.GET("/webhooks", server.AdminListWebhooks)
+			admin.POST("/webhooks", server.AdminAddWebhook)
+			admin.DELETE("/webhooks/:webhook_id", server.AdminRemoveWebhook)
+			admin.GET("/webhooks/:webhook_id/attempts", server.AdminListWebhookAttempts)
+
+			// Lists the actions taken through the admin API
+			admin.GET("/audit", server.AdminListAuditLog)
+		}
 	}
 
+	// Answer unknown routes with a problem too, rather than gin's plain text
+	router.NoRoute(func(c *gin.Context) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Not found")
+	})
+
 	// =============================================================================================================== //
 	//                                             End of mounting routes                                              //
 	// =============================================================================================================== //
 
-	models.InitTempCommentDB() // Initialize the temporary comment database
-
 	server.LambdaAdapter = ginadapter.New(router)
 
-	// load router
-	// load token maker
-	return server, nil
+	return server
 }
 
-func (server *Server) NotImplemented(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"status": "This resource is not yet implemented, but will be in the future"})
+// Close releases the server's resources. It must only be called once the server has stopped handling requests.
+func (server *Server) Close() {
+	if server.pool != nil {
+		server.pool.Close()
+	}
 }
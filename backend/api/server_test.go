@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"zillow-commenter.com/m/store"
+	"zillow-commenter.com/m/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testTokenKey is the key of the test servers' token makers, 32 characters like PASETO needs
+const testTokenKey = "0123456789abcdef0123456789abcdef"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// newTestServer returns a server keeping its comments in an empty memory store, along with the store.
+func newTestServer(t *testing.T, options ServerOptions) (*Server, *store.MemoryStore) {
+	t.Helper()
+	tokenMaker, err := token.NewPasetoMaker(testTokenKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memoryStore := store.NewMemoryStore(nil)
+	return NewServer(memoryStore, tokenMaker, nil, options), memoryStore
+}
+
+// userToken issues a session token for a user of the server.
+func userToken(t *testing.T, server *Server, userID string) string {
+	t.Helper()
+	sessionToken, _, err := server.maker.CreateToken(userID, server.userTokenDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessionToken
+}
+
+// newTestRequest builds a request to the server, as the user of a session token if it isn't empty, with body sent as
+// JSON if it isn't nil.
+func newTestRequest(t *testing.T, method, path, sessionToken string, body any) *http.Request {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if sessionToken != "" {
+		request.Header.Set("Authorization", "Bearer "+sessionToken)
+	}
+	return request
+}
+
+// serve has the server answer a request.
+func serve(server *Server, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// do has the server answer a request built by newTestRequest, and fails the test if the status isn't the wanted one.
+func do(t *testing.T, server *Server, method, path, sessionToken string, body any, wantStatus int) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := serve(server, newTestRequest(t, method, path, sessionToken, body))
+	if recorder.Code != wantStatus {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, recorder.Code, wantStatus, recorder.Body)
+	}
+	return recorder
+}
+
+// decode reads the JSON body of a response into a value of type T.
+func decode[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	err := json.Unmarshal(recorder.Body.Bytes(), &value)
+	if err != nil {
+		t.Fatalf("invalid response body %q: %v", recorder.Body, err)
+	}
+	return value
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxReportDetailLength matches the detail column of the reports table
+const maxReportDetailLength = 300
+
+// ReportComment reports a comment to the moderators. Each user can only report a given comment once, and a comment
+// is hidden once it has been reported by the server's report threshold of distinct users, until a moderator
+// reviews the reports.
+//
+// POST api/v1/comments/:comment_id/report
+//
+// Input:
+//
+//	Authorization header: "Bearer <token>", as issued by POST api/v1/user/token. The reporter is the token's user ID.
+//	- comment_id: The ID of the comment to report.
+//	Post form or JSON body containing the following fields:
+//	- reason: One of spam, harassment, hate_speech, personal_info, misinformation or other.
+//	- detail (optional): More about what is wrong with the comment, up to 300 characters.
+//
+// Output:
+//   - 201: A JSON object representing the report.
+//   - 200: A JSON object representing the user's earlier report, if they already reported the comment.
+//   - 400: If the comment ID, the reason or the detail is invalid.
+//   - 401: If the token is missing, invalid, or expired.
+//   - 403: If the client's IP or user ID is blacklisted. The "code" field says which.
+//   - 404: If the comment does not exist, was deleted, or is hidden.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) ReportComment(c *gin.Context) {
+	// Get the reporter's user ID from the verified token rather than trusting the client
+	payload := getAuthPayload(c)
+	if payload == nil {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	commentID, err := uuid.Parse(c.Param("comment_id"))
+	if err != nil {
+		respondInvalidField(c, "comment_id", codeInvalidField, "Invalid comment_id")
+		return
+	}
+	logger := getLogger(c).With("comment_id", commentID.String())
+
+	var request models.ReportRequest
+	if err := bindBody(c, &request); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	reason := request.Reason
+	if !models.IsReportReason(reason) {
+		respondInvalidField(c, "reason", codeInvalidValue, "Invalid reason, must be one of "+strings.Join(models.ReportReasons, ", "))
+		return
+	}
+	detail := request.Detail
+
+	// Refuse the report if the client's IP or user ID is blacklisted
+	blacklistReason, err := server.checkBlacklist(c.Request.Context(), clientIP(c), payload.UserID, "")
+	if err != nil {
+		logger.Error("failed to check blacklist", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if blacklistReason != "" {
+		respondBlacklisted(c, blacklistReason)
+		return
+	}
+
+	// Report IDs are V7 UUIDs, so that the report queue can be listed oldest first
+	reportID, err := uuid.NewV7()
+	if err != nil {
+		logger.Error("failed to generate report UUID", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	result, err := server.store.ReportComment(c.Request.Context(), models.Report{
+		ReportID:   reportID,
+		CommentID:  commentID,
+		ReporterID: payload.UserID,
+		Reason:     reason,
+		Detail:     detail,
+	}, server.reportHideThreshold)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to report comment", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	if !result.Created {
+		c.JSON(http.StatusOK, result.Report)
+		return
+	}
+	logger.Info("comment reported", slog.String("reason", reason), slog.Bool("hidden", result.Hidden))
+	c.JSON(http.StatusCreated, result.Report)
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/filter"
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// EditComment replaces the text of a comment. Only the comment's author can edit it, and only within the server's
+// edit window after it was posted. The previous text is kept in the comment's edit history.
+//
+// PATCH api/v1/comments/:comment_id
+//
+// Input:
+//
+//	Authorization header: "Bearer <token>", as issued by POST api/v1/user/token. It must carry the author's user ID.
+//	- comment_id: The ID of the comment to edit.
+//	Post form or JSON body containing the following fields:
+//	- comment_text: The new text of the comment.
+//
+// Output:
+//   - 200: A JSON object representing the edited comment.
+//   - 400: If the comment ID or the new text is invalid.
+//   - 401: If the token is missing, invalid, or expired.
+//   - 403: If the user is not the author, the edit window has passed, or the client is blacklisted.
+//   - 404: If the comment does not exist.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) EditComment(c *gin.Context) {
+	// Get the user ID from the verified token rather than trusting the client
+	payload := getAuthPayload(c)
+	if payload == nil {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	commentID, err := uuid.Parse(c.Param("comment_id"))
+	if err != nil {
+		respondInvalidField(c, "comment_id", codeInvalidField, "Invalid comment_id")
+		return
+	}
+	logger := getLogger(c).With("comment_id", commentID.String())
+
+	var request models.EditCommentRequest
+	if err := bindBody(c, &request); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	commentText := request.CommentText
+
+	comment, err := server.store.GetComment(c.Request.Context(), commentID)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to get comment", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	// Only the author may edit the comment, and only for a while after posting it
+	if comment.UserID != payload.UserID {
+		logger.Info("refused edit", slog.String("reason", "not_author"))
+		respondProblem(c, http.StatusForbidden, codeNotAuthor, "Only the author can edit this comment")
+		return
+	}
+	if server.commentEditWindow <= 0 {
+		logger.Info("refused edit", slog.String("reason", "edit_window_passed"))
+		respondProblem(c, http.StatusForbidden, codeEditWindowClosed, "This comment can no longer be edited")
+		return
+	}
+
+	// Comments in hidden threads aren't shown, so they can't be edited either
+	depthResponse, err := server.toResponseWithDepth(c, *comment)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to get comment depth", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	// Refuse the edit if the client's IP, user ID, or username is blacklisted
+	reason, err := server.checkBlacklist(c.Request.Context(), clientIP(c), payload.UserID, comment.Username)
+	if err != nil {
+		logger.Error("failed to check blacklist", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if reason != "" {
+		respondBlacklisted(c, reason)
+		return
+	}
+
+	// Run the new text through the filters like a new comment's
+	filtered, ok := server.filterComment(c, logger, filter.Comment{Username: comment.Username, CommentText: commentText})
+	if !ok {
+		return
+	}
+	commentText = filtered.Comment.CommentText
+
+	// The store checks the edit window against the time the database recorded, and records no revision if nothing
+	// changed
+	editedComment, err := server.store.EditComment(c.Request.Context(), commentID, commentText, server.commentEditWindow)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Comment not found")
+		return
+	}
+	if errors.Is(err, store.ErrEditWindowClosed) {
+		logger.Info("refused edit", slog.String("reason", "edit_window_passed"))
+		respondProblem(c, http.StatusForbidden, codeEditWindowClosed, "This comment can no longer be edited")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to edit comment", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if editedComment.RevisionCount != comment.RevisionCount {
+		logger.Info("comment edited", slog.Int("revision_count", editedComment.RevisionCount))
+		server.flagComment(c.Request.Context(), logger, commentID, filtered.Flags)
+	}
+
+	response := editedComment.ToResponse()
+	response.Depth = depthResponse.Depth
+	c.JSON(http.StatusOK, response)
+}
+
+// GetCommentRevisions returns the edit history of a comment.
+//
+// GET api/v1/comments/:listing_id/:comment_id/revisions
+// GET api/v1/comments/revisions/:comment_id?url=<listing URL>
+//
+// Input:
+//   - listing_id: The listing the comment belongs to, as a listing key (e.g. "zillow:12345") or a bare Zillow
+//     listing ID.
+//   - url (query): The URL of the listing page, instead of listing_id.
+//   - comment_id: The ID of the comment.
+//
+// Output:
+//   - 200: A JSON object containing the comment as it is now and its previous versions, oldest first.
+//     Structure defined in models package.
+//   - 400: If the listing or the comment ID is invalid.
+//   - 404: If the comment does not exist on the listing.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) GetCommentRevisions(c *gin.Context) {
+	commentID, err := uuid.Parse(c.Param("comment_id"))
+	if err != nil {
+		respondInvalidField(c, "comment_id", codeInvalidField, "Invalid comment_id")
+		return
+	}
+	listingKey, err := parseListing(c.Param("listing_id"), c.Query("url"))
+	if err != nil {
+		respondInvalidField(c, "listing_id", codeInvalidListing, err.Error())
+		return
+	}
+	logger := getLogger(c).With("comment_id", commentID.String())
+
+	comment, err := server.store.GetComment(c.Request.Context(), commentID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && comment.TargetListing != listingKey.String()) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to get comment", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	revisions, err := server.store.GetCommentRevisions(c.Request.Context(), commentID)
+	if err != nil {
+		logger.Error("failed to get comment revisions", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if revisions == nil {
+		revisions = []models.CommentRevision{}
+	}
+
+	response, err := server.toResponseWithDepth(c, *comment)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to get comment depth", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	c.JSON(http.StatusOK, models.CommentHistory{
+		Comment:   response,
+		Revisions: revisions,
+	})
+}
+
+// toResponseWithDepth converts a single comment to a ResponseComment, looking up its depth in its thread. It returns
+// store.ErrNotFound if the comment is in a hidden thread, and isn't shown.
+func (server *Server) toResponseWithDepth(c *gin.Context, comment models.Comment) (models.ResponseComment, error) {
+	response := comment.ToResponse()
+	if comment.ParentID == nil {
+		return response, nil
+	}
+
+	threadInfo, err := server.store.GetThreadInfo(c.Request.Context(), comment.CommentID)
+	if err != nil {
+		return response, err
+	}
+	response.Depth = threadInfo.Depth
+	return response, nil
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/store"
+	"zillow-commenter.com/m/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// streamHeartbeatInterval is how often an idle comment stream sends a heartbeat, so that proxies and clients
+	// don't time it out
+	streamHeartbeatInterval = 25 * time.Second
+
+	// streamRetry is how long clients wait before reconnecting to a stream that ended, in milliseconds
+	streamRetry = 3000
+
+	// streamCatchUpPageSize is how many missed comments are fetched at once when a client resumes a stream
+	streamCatchUpPageSize = 100
+)
+
+// RunCommentStream feeds the comment streams until the context is done, then ends them. Only the standalone server
+// runs it: the streams answer 501 until it does, since the Lambda adapter can't hold them open.
+func (server *Server) RunCommentStream(ctx context.Context) {
+	server.streaming.Store(true)
+	defer server.streaming.Store(false)
+
+	if server.pool != nil {
+		stream.Listen(ctx, server.pool, server.commentHub)
+		return
+	}
+
+	// Without a database, PostListingComment publishes the new comments itself
+	<-ctx.Done()
+	server.commentHub.Close()
+}
+
+// StreamListingComments streams the comments posted on a listing as Server-Sent Events, as long as the client
+// stays connected. Each comment is a "comment" event whose ID is the comment ID, so that clients reconnecting with
+// Last-Event-ID get the comments they missed first. Idle streams send a "heartbeat" event every 25 seconds.
+// Streams are only available from the standalone server.
+//
+// GET api/v1/comments/:listing_id/stream
+// GET api/v1/comments/stream?url=<listing URL>
+//
+// Input:
+//
+//	Last-Event-ID header (optional): The ID of the last comment received, to get the comments posted since first.
+//	- listing_id: The listing to follow, as a listing key (e.g. "zillow:12345") or a bare Zillow listing ID.
+//	- url (query): The URL of the listing page, instead of listing_id.
+//	- last_event_id (query, optional): Same as the Last-Event-ID header, for clients that can't set it.
+//
+// Output:
+//   - 200: A text/event-stream of the comments posted on the listing, oldest first. Each event's data is a JSON
+//     object representing the comment, like the ones GetListingComments returns. A stream started without a
+//     resume point begins with a "ready" event, whose ID resumes the stream from the time it started.
+//   - 400: If the listing or the resume point is invalid.
+//   - 501: If the server can't hold streams open, e.g. under Lambda.
+func (server *Server) StreamListingComments(c *gin.Context) {
+	if !server.streaming.Load() {
+		respondProblem(c, http.StatusNotImplemented, codeNotAvailable, "Comment streams are only available from the standalone server")
+		return
+	}
+
+	listingKey, err := parseListing(c.Param("listing_id"), c.Query("url"))
+	if err != nil {
+		respondInvalidField(c, "listing_id", codeInvalidListing, err.Error())
+		return
+	}
+	listingID := listingKey.String()
+	logger := getLogger(c).With("listing_id", listingID)
+
+	// Comment IDs are V7 UUIDs, so the ID of the last comment a client got is also when it got cut off
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var since uuid.NullUUID
+	if lastEventID != "" {
+		parsed, err := uuid.Parse(lastEventID)
+		if err != nil {
+			respondInvalidField(c, "Last-Event-ID", codeInvalidField, "Invalid Last-Event-ID")
+			return
+		}
+		since = uuid.NullUUID{UUID: parsed, Valid: true}
+	}
+
+	// Subscribe before catching up, so that the comments posted in between aren't missed
+	subscription := server.commentHub.Subscribe(listingID)
+	defer subscription.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Don't let nginx buffer the stream
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry)
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	sent := map[uuid.UUID]bool{}
+	if since.Valid {
+		// Send the comments the client missed, which may be announced again by the subscription
+		for {
+			comments, err := server.store.GetCommentsSince(ctx, listingID, since.UUID, streamCatchUpPageSize, server.hideBlacklistedComments)
+			if err != nil {
+				logger.Error("failed to get missed comments", logging.Error(err))
+				return
+			}
+			for _, comment := range comments {
+				since.UUID = comment.CommentID
+				response, err := server.toResponseWithDepth(c, comment)
+				if errors.Is(err, store.ErrNotFound) {
+					// The comment is in a hidden thread
+					continue
+				}
+				if err != nil {
+					logger.Error("failed to get comment depth", logging.Error(err))
+					return
+				}
+				if writeStreamEvent(c, comment.CommentID.String(), "comment", response) != nil {
+					return
+				}
+				sent[comment.CommentID] = true
+			}
+			if len(comments) < streamCatchUpPageSize {
+				break
+			}
+		}
+	} else {
+		// Give the client a resume point even if no comment comes before it gets cut off
+		readyID, err := uuid.NewV7()
+		if err != nil {
+			logger.Error("failed to generate stream UUID", logging.Error(err))
+			return
+		}
+		if writeStreamEvent(c, readyID.String(), "ready", gin.H{}) != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if writeStreamEvent(c, "", "heartbeat", gin.H{"timestamp": time.Now().UnixMicro()}) != nil {
+				return
+			}
+		case commentID, ok := <-subscription.C:
+			// The subscription ends when the server stops or the client falls behind, and the client then resumes
+			if !ok {
+				return
+			}
+			if sent[commentID] {
+				continue
+			}
+			err := server.streamComment(c, commentID)
+			if err != nil {
+				logger.Error("failed to stream comment", logging.Error(err))
+				return
+			}
+		}
+	}
+}
+
+// streamComment sends a new comment on a stream, unless it can't be shown.
+func (server *Server) streamComment(c *gin.Context, commentID uuid.UUID) error {
+	comment, err := server.store.GetComment(c.Request.Context(), commentID)
+	if errors.Is(err, store.ErrNotFound) {
+		// The comment was hidden or deleted in the meantime
+		return nil
+	}
+	if err != nil {
+		return errors.Join(err, errors.New("failed to get comment"))
+	}
+
+	if server.hideBlacklistedComments {
+		entry, err := server.store.FindBlacklistEntry(c.Request.Context(), comment.UserIP, comment.UserID, comment.Username)
+		if err != nil {
+			return errors.Join(err, errors.New("failed to check blacklist"))
+		}
+		if entry != nil {
+			return nil
+		}
+	}
+
+	response, err := server.toResponseWithDepth(c, *comment)
+	if errors.Is(err, store.ErrNotFound) {
+		// The comment is in a hidden thread
+		return nil
+	}
+	if err != nil {
+		return errors.Join(err, errors.New("failed to get comment depth"))
+	}
+	return writeStreamEvent(c, commentID.String(), "comment", response)
+}
+
+// writeStreamEvent writes a Server-Sent Event with JSON data and flushes it to the client. The event has no ID
+// if id is empty.
+func writeStreamEvent(c *gin.Context, id, event string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		fmt.Fprintf(c.Writer, "id: %s\n", id)
+	}
+	_, err = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, encoded)
+	if err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
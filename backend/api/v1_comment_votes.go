@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// VoteComment records the user's vote on a comment. Each user has a single vote per comment, so voting the same way
+// twice changes nothing, and voting the other way replaces the previous vote.
+//
+// POST api/v1/comments/:comment_id/vote
+//
+// Input:
+//
+//	Authorization header: "Bearer <token>", as issued by POST api/v1/user/token. The user ID is taken from the token.
+//	- comment_id: The ID of the comment to vote on.
+//	Post form or JSON body containing the following fields:
+//	- vote: 1 to upvote, -1 to downvote, or 0 to take the vote back.
+//
+// Output:
+//   - 200: A JSON object containing the comment's new score and the user's vote.
+//   - 400: If the comment ID or the vote is invalid.
+//   - 401: If the token is missing, invalid, or expired.
+//   - 403: If the client's IP or user ID is blacklisted. The "code" field says which.
+//   - 404: If the comment does not exist or was deleted.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) VoteComment(c *gin.Context) {
+	// Get the user ID from the verified token rather than trusting the client
+	payload := getAuthPayload(c)
+	if payload == nil {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	commentID, err := uuid.Parse(c.Param("comment_id"))
+	if err != nil {
+		respondInvalidField(c, "comment_id", codeInvalidField, "Invalid comment_id")
+		return
+	}
+	logger := getLogger(c).With("comment_id", commentID.String())
+
+	var request models.VoteRequest
+	if err := bindBody(c, &request); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	vote := *request.Vote
+
+	// Refuse the vote if the client's IP or user ID is blacklisted
+	reason, err := server.checkBlacklist(c.Request.Context(), clientIP(c), payload.UserID, "")
+	if err != nil {
+		logger.Error("failed to check blacklist", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if reason != "" {
+		respondBlacklisted(c, reason)
+		return
+	}
+
+	score, err := server.store.Vote(c.Request.Context(), commentID, payload.UserID, vote)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to record vote", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	logger.Debug("comment voted", slog.Int("vote", vote), slog.Int("score", score))
+	c.JSON(http.StatusOK, models.VoteResult{
+		CommentID: commentID,
+		Score:     score,
+		MyVote:    vote,
+	})
+}
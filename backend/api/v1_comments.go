@@ -2,53 +2,210 @@ package api
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
 
-	"zillow-commenter.com/m/db/postgres/sqlc"
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/filter"
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgtype"
-	"zillow-commenter.com/m/api/models"
 )
 
-// GetListingComments returns a list of comments for a specific zilllow listing.
+const (
+	// Default and maximum number of top-level comments returned per page by GetListingComments
+	defaultCommentPageSize = 50
+	maxCommentPageSize     = 100
+)
+
+// GetListingComments returns a page of comments for a specific zilllow listing.
 //
 // GET api/v1/comments/:listing_id
+// GET api/v1/comments?url=<listing URL>
 //
 // Input:
-//   - listing_id: The zillow listing ID for which to retrieve comments.
+//
+//	Authorization header (optional): "Bearer <token>". If it is valid, each comment carries the user's own vote.
+//	- listing_id: The listing for which to retrieve comments, as a listing key (e.g. "zillow:12345") or a bare
+//	  Zillow listing ID.
+//	- url (query): The URL of the listing page, instead of listing_id.
+//	- sort (query, optional): The order of the top-level comments: new (newest first, the default), top (highest
+//	  score first), or controversial (most votes, most evenly split, first).
+//	- limit (query, optional): The maximum number of top-level comments to return. Defaults to 50, capped at 100.
+//	- before (query, optional): A cursor, as returned in next_cursor, to return the top-level comments that come after
+//	  in the sort order.
+//	- after (query, optional): A cursor, as returned in prev_cursor, to return the top-level comments that come before
+//	  in the sort order. Can't be used with before. Cursors are opaque, and only valid with the sort they came from.
 //
 // Output:
-//   - 200: A JSON array of comments for the specified listing. Comment structure defined in models package.
+//   - 200: A JSON object containing the page of comments and the cursors to the neighbouring pages. The comments
+//     are flattened into threads: each top-level comment (in the sort order) is followed by all its replies (oldest
+//     first), each with its nesting depth, score, and the user's vote. Deleted comments only appear, as "[deleted]"
+//     tombstones, if they have replies. next_cursor is passed as before to get the next page, and prev_cursor
+//     as after to get the previous one; either is null when there is nothing more in that direction. Structure
+//     defined in models package.
+//   - 400: If the listing, the sort, the limit or a cursor is invalid.
 //   - 404: If the listing does not exist.
 //   - 500: Internal server error if something goes wrong.
 func (server *Server) GetListingComments(c *gin.Context) {
-	// Get information from the request context
-	listingID := c.Param("listing_id")
-	userIP := c.ClientIP()
-	timestamp := time.Now().Unix()
+	// Get the canonical key of the listing
+	listingKey, err := parseListing(c.Param("listing_id"), c.Query("url"))
+	if err != nil {
+		getLogger(c).Info("invalid listing", logging.Error(err))
+		respondInvalidField(c, "listing_id", codeInvalidListing, err.Error())
+		return
+	}
+	listingID := listingKey.String()
+	logger := getLogger(c).With("listing_id", listingID)
 
-	log.Println("GetListingComments called with listing_id:", listingID, "\nfrom IP:", userIP, "\nat timestamp:", timestamp)
+	// Parse the pagination parameters
+	page, err := server.parseCommentPageRequest(c)
+	if err != nil {
+		logger.Info("invalid pagination parameters", logging.Error(err))
+		respondFieldError(c, err)
+		return
+	}
 
-	// Check if the listing exists in the temporary comment database
-	comments, err := server.getComments(listingID)
+	// Get the page of top-level comments and their replies
+	commentPage, err := server.store.GetComments(c.Request.Context(), listingID, page)
 	if err != nil {
-		log.Println("Error getting comments from db", listingID)
+		logger.Error("failed to get comments from store", logging.Error(err))
 
 		// Tell the client that something went wrong
-		c.JSON(500, gin.H{"error": "Internal server error"})
+		respondInternalError(c)
 		return
 	}
 
 	// Prepare the response comments
-	responseComments := models.ToResponseSlice(comments)
+	response := models.CommentPage{
+		Comments: models.ToThreadedResponseSlice(models.DropDeletedLeaves(append(commentPage.TopLevel, commentPage.Replies...))),
+	}
+	if response.Comments == nil {
+		response.Comments = []models.ResponseComment{}
+	}
+
+	// Show identified users their own votes
+	if payload := getAuthPayload(c); payload != nil && len(response.Comments) > 0 {
+		commentIDs := make([]uuid.UUID, 0, len(response.Comments))
+		for _, comment := range response.Comments {
+			commentIDs = append(commentIDs, comment.CommentID)
+		}
+		votes, err := server.store.GetUserVotes(c.Request.Context(), payload.UserID, commentIDs)
+		if err != nil {
+			logger.Error("failed to get user votes from store", logging.Error(err))
+			respondInternalError(c)
+			return
+		}
+		for i := range response.Comments {
+			response.Comments[i].MyVote = votes[response.Comments[i].CommentID]
+		}
+	}
+
+	// Work out the cursors to the neighbouring pages, from the first and last top-level comments in the sort order
+	if cursors := commentPage.Cursors; len(cursors) > 0 {
+		first := encodeCursor(page.Sort, cursors[0])
+		last := encodeCursor(page.Sort, cursors[len(cursors)-1])
+		if page.After != nil {
+			// Anything past this page is at least as far as the cursor, so it exists
+			response.NextCursor = &last
+			if commentPage.HasMore {
+				response.PrevCursor = &first
+			}
+		} else {
+			if commentPage.HasMore {
+				response.NextCursor = &last
+			}
+			if page.Before != nil {
+				response.PrevCursor = &first
+			}
+		}
+	}
 
 	// Return the comments as a JSON response
-	c.JSON(http.StatusOK, responseComments)
+	c.JSON(http.StatusOK, response)
+}
+
+// parseCommentPageRequest reads the sort, limit, before and after query parameters.
+func (server *Server) parseCommentPageRequest(c *gin.Context) (store.PageRequest, error) {
+	page := store.PageRequest{
+		Limit:           defaultCommentPageSize,
+		Sort:            store.SortNew,
+		HideBlacklisted: server.hideBlacklistedComments,
+	}
+
+	if sortParam := c.Query("sort"); sortParam != "" {
+		switch sort := store.Sort(sortParam); sort {
+		case store.SortNew, store.SortTop, store.SortControversial:
+			page.Sort = sort
+		default:
+			return page, fieldError{"sort", "invalid sort"}
+		}
+	}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			return page, fieldError{"limit", "invalid limit"}
+		}
+		page.Limit = min(limit, maxCommentPageSize)
+	}
+
+	beforeParam := c.Query("before")
+	afterParam := c.Query("after")
+	if beforeParam != "" && afterParam != "" {
+		return page, fieldError{"after", "before and after can't be used together"}
+	}
+	if beforeParam != "" {
+		before, ok := decodeCursor(page.Sort, beforeParam)
+		if !ok {
+			return page, fieldError{"before", "invalid before cursor"}
+		}
+		page.Before = &before
+	}
+	if afterParam != "" {
+		after, ok := decodeCursor(page.Sort, afterParam)
+		if !ok {
+			return page, fieldError{"after", "invalid after cursor"}
+		}
+		page.After = &after
+	}
+
+	return page, nil
+}
+
+// encodeCursor turns a page cursor into the opaque string given to clients. It holds the sort it was taken in, so
+// that it can't be used with another one, along with the sort key and the comment ID.
+func encodeCursor(sort store.Sort, cursor store.Cursor) string {
+	raw := string(sort) + ":" + strconv.FormatFloat(cursor.Key, 'g', -1, 64) + ":" + cursor.CommentID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor reads a cursor made by encodeCursor, reporting false if it is malformed or from another sort.
+func decodeCursor(sort store.Sort, encoded string) (store.Cursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return store.Cursor{}, false
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || store.Sort(parts[0]) != sort {
+		return store.Cursor{}, false
+	}
+	key, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || math.IsNaN(key) || math.IsInf(key, 0) {
+		return store.Cursor{}, false
+	}
+	commentID, err := uuid.Parse(parts[2])
+	if err != nil {
+		return store.Cursor{}, false
+	}
+	return store.Cursor{Key: key, CommentID: commentID}, true
 }
 
 // PostListingComment creates a new comment for a specific zillow listing.
@@ -57,47 +214,117 @@ func (server *Server) GetListingComments(c *gin.Context) {
 //
 // Input:
 //
-//	Post form containing the following fields:
-//	- listing_id: The zillow listing ID to which the comment is related.
-//	- user_id: The ID of the user making the comment.
+//	Authorization header: "Bearer <token>", as issued by POST api/v1/user/token. The user ID is taken from the token.
+//	Post form or JSON body containing the following fields:
+//	- listing_id: The listing to which the comment is related, as a listing key (e.g. "zillow:12345") or a bare
+//	  Zillow listing ID.
+//	- url: The URL of the listing page, instead of listing_id.
 //	- username: The username of the user making the comment.
 //	- comment_text: The text of the comment.
+//	- parent_id (optional): The ID of the comment being replied to. It must belong to the same listing, and
+//	  the reply must not be nested deeper than the server's maximum reply depth.
 //
 // Output:
 //   - 201: A JSON object representing the created comment.
-//   - 400: If the input data is invalid.
+//   - 400: If the input data is invalid, or the parent comment is on another listing or too deeply nested.
+//   - 401: If the token is missing, invalid, or expired.
+//   - 403: If the client's IP, user ID, or username is blacklisted. The "code" field says which.
 //   - 500: Internal server error if something goes wrong.
 func (server *Server) PostListingComment(c *gin.Context) {
 	// Get information from the request context
-	userIP := c.ClientIP()
-	timestamp := time.Now().Unix()
+	userIP := clientIP(c)
 
-	// Get postform data
-	listingID := c.PostForm("listing_id")
-	userID := c.PostForm("user_id")
-	username := c.PostForm("username")
-	commentText := c.PostForm("comment_text")
+	// Get the user ID from the verified token rather than trusting the client
+	payload := getAuthPayload(c)
+	if payload == nil {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
+	}
+	userID := payload.UserID
+
+	// Get the comment from the form or JSON body
+	var request models.PostCommentRequest
+	if err := bindBody(c, &request); err != nil {
+		code := respondBindError(c, err)
+		getLogger(c).Info("rejected comment", slog.String("reason", code), logging.Error(err))
+		server.metrics.CommentRejected(code)
+		return
+	}
+	username := request.Username
+	commentText := request.CommentText
 
-	log.Printf("PostListingComment called with listing_id: %s, user_id: %s, username: %s, comment_text: %s\nfrom IP: %s\nat timestamp: %d",
-		listingID, userID, username, commentText, userIP, timestamp)
+	// Comments are stored under the canonical key of their listing
+	listingKey, err := parseListing(request.ListingID, request.URL)
+	if err != nil {
+		getLogger(c).Info("rejected comment", slog.String("reason", codeInvalidListing), logging.Error(err))
+		server.metrics.CommentRejected(codeInvalidListing)
+		respondInvalidField(c, "listing_id", codeInvalidListing, err.Error())
+		return
+	}
+	listingID := listingKey.String()
+
+	// Never log the comment itself, only its length
+	logger := getLogger(c).With("listing_id", listingID)
+	logger.Debug("posting comment", logging.Text("comment_text", commentText), slog.Bool("reply", request.ParentID != ""))
 
 	// Validate input data
-	{
-		if listingID == "" || userID == "" || username == "" || commentText == "" {
-			log.Println("Invalid input data: listing_id, user_id, username, and comment_text are required")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+	if userID == "" {
+		logger.Info("rejected comment", slog.String("reason", codeMissingField))
+		server.metrics.CommentRejected(codeMissingField)
+		respondProblem(c, http.StatusBadRequest, codeMissingField, "Invalid input data")
+		return
+	}
+
+	// Run the comment through the filters, which may clean it up, mask parts of it, or reject it
+	filtered, ok := server.filterComment(c, logger, filter.Comment{Username: username, CommentText: commentText})
+	if !ok {
+		server.metrics.CommentRejected(filtered.Reason)
+		return
+	}
+	username = filtered.Comment.Username
+	commentText = filtered.Comment.CommentText
+	// The blacklist has the username as the client sent it, not as the filters masked it
+	blacklistUsername := filtered.Unmasked.Username
+
+	// Parse the optional parent comment ID
+	var parentID *uuid.UUID
+	if request.ParentID != "" {
+		parsedParentID, err := uuid.Parse(request.ParentID)
+		if err != nil {
+			logger.Info("rejected comment", slog.String("reason", "invalid_parent_id"))
+			server.metrics.CommentRejected("invalid_parent_id")
+			respondInvalidField(c, "parent_id", codeInvalidField, "Invalid parent_id")
 			return
 		}
+		parentID = &parsedParentID
+	}
+
+	// Refuse the comment if the client's IP, user ID, or username is blacklisted
+	reason, err := server.checkBlacklist(c.Request.Context(), userIP, userID, blacklistUsername)
+	if err != nil {
+		logger.Error("failed to check blacklist", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if reason != "" {
+		server.metrics.CommentRejected("blacklisted")
+		respondBlacklisted(c, reason)
+		return
+	}
 
-		if len(commentText) > 300 {
-			log.Println("Comment text exceeds maximum length of 300 characters")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Comment text exceeds maximum length of 300 characters"})
+	// Make sure a reply answers a comment on the same listing and isn't nested too deeply
+	depth := 0
+	if parentID != nil {
+		depth, err = server.validateParentComment(c.Request.Context(), *parentID, listingID)
+		if errors.Is(err, errParentNotFound) || errors.Is(err, errParentDeleted) || errors.Is(err, errParentOtherListing) || errors.Is(err, errReplyTooDeep) {
+			logger.Info("rejected comment", slog.String("reason", codeInvalidParent), logging.Error(err))
+			server.metrics.CommentRejected(codeInvalidParent)
+			respondInvalidField(c, "parent_id", codeInvalidParent, err.Error())
 			return
 		}
-
-		if len(username) > 50 {
-			log.Println("Username exceeds maximum length of 50 characters")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Username exceeds maximum length of 50 characters"})
+		if err != nil {
+			logger.Error("failed to validate parent comment", logging.Error(err))
+			respondInternalError(c)
 			return
 		}
 	}
@@ -105,120 +332,146 @@ func (server *Server) PostListingComment(c *gin.Context) {
 	// Generate a new UUID for the comment using a timestamp-based version (v7) to ensure uniqueness
 	commentID, err := uuid.NewV7()
 	if err != nil {
-		log.Println("Error generating new comment UUID:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		logger.Error("failed to generate comment UUID", logging.Error(err))
+		respondInternalError(c)
 		return
 	}
 
 	// Create a new comment
-	newComment := sqlc.PostCommentParams{
-		CommentID:   pgtype.UUID{Bytes: [16]byte(commentID), Valid: true}, // Unique comment ID based on timestamp
-		ListingID:   listingID,
-		UserIp:      userIP,
-		UserID:      userID,
-		Username:    username,
-		CommentText: commentText,
+	newComment := models.Comment{
+		TargetListing: listingID,
+		CommentID:     commentID, // Unique comment ID based on timestamp
+		ParentID:      parentID,
+		UserIP:        userIP,
+		UserID:        userID,
+		Username:      username,
+		CommentText:   commentText,
 	}
 
-	// Log the new comment creation
-	log.Println("New comment created for listing:", listingID, "by user:", username, "at timestamp:", timestamp)
-	log.Println("Comment details:", newComment)
-
-	// Acquire a Postgres connection from the pool
-	postgresPool, err := server.GetPostgresPool().Acquire(context.TODO())
+	// Insert the new comment into the store
+	postedComment, err := server.store.PostComment(c.Request.Context(), newComment)
 	if err != nil {
-		log.Println("Error acquiring Postgres connection:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		logger.Error("failed to insert comment into store", logging.Error(err))
+		respondInternalError(c)
 		return
 	}
-	defer postgresPool.Release()
-	postgresQueryClient := sqlc.New(postgresPool)
 
-	// Insert the new comment into the database
-	postCommentRow, err := postgresQueryClient.PostComment(context.TODO(), newComment)
-	if err != nil {
-		log.Println("Error inserting new comment into database for listing:", listingID, "-", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
+	logger.Info("comment posted", slog.String("comment_id", postedComment.CommentID.String()))
+	server.metrics.CommentPosted(listingID)
+	// Postgres notifies the comment streams of new comments itself, but the memory store can't
+	if server.pool == nil {
+		server.commentHub.Publish(listingID, postedComment.CommentID)
 	}
-
-	/* // Convert the sqlc.PostCommentRow struct to a models.Comment struct
-	newCommentFromDB, err := models.GenericRowToComment(postCommentRow)
-	if err != nil {
-		log.Println("Error converting new comment row to models.Comment struct for listing:", listingID, "-", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	// Log the new comment from the database
-	log.Println("New comment from database for listing:", listingID, ":", newCommentFromDB)
-
-	//log.Println("Response comments for listing:", listingID, ":", responseComments)
-	c.JSON(http.StatusCreated, newCommentFromDB) */
-
-	// Log the successful creation of the new comment
-	log.Println("New comment successfully created for listing:", listingID, ":", postCommentRow)
-	c.JSON(http.StatusCreated, postCommentRow)
+	server.flagComment(c.Request.Context(), logger, postedComment.CommentID, filtered.Flags)
+	server.wakeWebhookDispatcher()
+	response := postedComment.ToResponse()
+	response.Depth = depth
+	c.JSON(http.StatusCreated, response)
 }
 
-// Helper function to get comments for a specific listing.
+// DeleteComment deletes a comment as its author. The comment is soft-deleted: it stays in the thread as a
+// "[deleted]" tombstone if it has replies, until the retention job purges it.
+//
+// DELETE api/v1/comments/:comment_id
 //
 // Input:
-//   - listingID: The zillow listing ID for which to retrieve comments.
+//
+//	Authorization header: "Bearer <token>", as issued by POST api/v1/user/token. It must carry the author's user ID.
+//	- comment_id: The ID of the comment to delete.
 //
 // Output:
-//   - A slice of Comment structs containing the comments for the specified listing.
-//   - An error if the listing doesn't exist in the DB.
-func (server Server) getComments(listingID string) ([]models.Comment, error) {
-	// Acquire a Postgres connection from the pool
-	postgresPool, err := server.GetPostgresPool().Acquire(context.TODO())
-	if err != nil {
-		log.Println("Error acquiring Postgres connection:", err)
-		return nil, errors.Join(err, errors.New("failed to acquire postgres connection"))
+//   - 204: The comment was deleted.
+//   - 400: If the comment ID is invalid.
+//   - 401: If the token is missing, invalid, or expired.
+//   - 403: If the user is not the author.
+//   - 404: If the comment does not exist or was already deleted.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) DeleteComment(c *gin.Context) {
+	// Get the user ID from the verified token rather than trusting the client
+	payload := getAuthPayload(c)
+	if payload == nil {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
 	}
-	defer postgresPool.Release()
-	postgresQueryClient := sqlc.New(postgresPool)
 
-	// Query the database for comments by listing ID
-	commentRows, err := postgresQueryClient.GetCommentsByListingID(context.TODO(), listingID)
+	commentID, err := uuid.Parse(c.Param("comment_id"))
 	if err != nil {
-		log.Println("Error retrieving comments from database for listing:", listingID, "-", err)
-		return nil, errors.Join(err, errors.New("failed to retrieve comments from database"))
+		respondInvalidField(c, "comment_id", codeInvalidField, "Invalid comment_id")
+		return
 	}
+	logger := getLogger(c).With("comment_id", commentID.String())
 
-	// Convert the sqlc.GetCommentsByListingIDRow structs to models.Comment structs
-	comments, err := models.CommentRowsToComments(commentRows)
+	comment, err := server.store.GetComment(c.Request.Context(), commentID)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Comment not found")
+		return
+	}
 	if err != nil {
-		log.Println("Error converting comment rows to models. Comment structs for listing:", listingID, "-", err)
-		return nil, errors.Join(err, errors.New("failed to convert comment rows to models.Comment structs"))
+		logger.Error("failed to get comment", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	// Only the author may delete the comment through this route
+	if comment.UserID != payload.UserID {
+		logger.Info("refused deletion", slog.String("reason", "not_author"))
+		respondProblem(c, http.StatusForbidden, codeNotAuthor, "Only the author can delete this comment")
+		return
 	}
 
-	// Return the comments to the client
-	/* slices.SortStableFunc(comments, func(a, b models.Comment) int {
-		return int(b.Timestamp) - int(a.Timestamp) // Sort by timestamp in descending order
-	}) */
+	err = server.store.DeleteComment(c.Request.Context(), commentID, models.DeletedByAuthor)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to delete comment", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
 
-	return comments, nil
+	logger.Info("comment deleted", slog.String("deleted_by", models.DeletedByAuthor))
+	c.Status(http.StatusNoContent)
 }
 
-// GenerateUserID generates a new user ID for the client.
+var (
+	errParentNotFound     = errors.New("parent comment does not exist")
+	errParentDeleted      = errors.New("parent comment was deleted")
+	errParentOtherListing = errors.New("parent comment belongs to a different listing")
+	errReplyTooDeep       = errors.New("reply exceeds the maximum reply depth")
+)
+
+// Helper function to check that a reply's parent comment exists, belongs to the same listing,
+// and isn't so deeply nested that the reply would exceed the server's maximum reply depth.
 //
-// GET api/v1/user/user_id
+// Input:
+//   - parentID: The ID of the comment being replied to.
+//   - listingID: The listing the reply is being posted to.
 //
 // Output:
-//   - 200: A JSON object containing the generated user ID. ID is a V7 (Time) UUID.
-func (server *Server) GenerateUserID(c *gin.Context) {
-	// Generate a new UUID for the user using a timestamp-based version (v7) to ensure uniqueness
-	userID, err := uuid.NewV7()
+//   - The depth the reply will sit at.
+//   - errParentNotFound, errParentDeleted, errParentOtherListing or errReplyTooDeep if the parent is not valid.
+//   - Another error if the store could not be queried.
+func (server *Server) validateParentComment(ctx context.Context, parentID uuid.UUID, listingID string) (int, error) {
+	threadInfo, err := server.store.GetThreadInfo(ctx, parentID)
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, errParentNotFound
+	}
 	if err != nil {
-		log.Println("Error generating new user UUID:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
+		return 0, errors.Join(err, errors.New("failed to retrieve parent comment"))
 	}
 
-	// Log the generated user ID
-	log.Println("Generated new user ID:", userID)
+	if threadInfo.Deleted {
+		return 0, errParentDeleted
+	}
+	if threadInfo.ListingID != listingID {
+		return 0, errParentOtherListing
+	}
+	// The reply sits one level below its parent
+	depth := threadInfo.Depth + 1
+	if depth > server.maxReplyDepth {
+		return 0, errReplyTooDeep
+	}
 
-	// Return the user ID as a JSON response
-	c.JSON(http.StatusOK, gin.H{"user_id": userID.String()})
+	return depth, nil
 }
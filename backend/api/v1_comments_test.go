@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/store"
+
+	"github.com/google/uuid"
+)
+
+func TestPostCommentChecksBlacklistBeforeMasking(t *testing.T) {
+	server, memoryStore := newTestServer(t, ServerOptions{})
+	memoryStore.AddBlacklistEntry(models.BlacklistEntry{Cause: "abuse", Username: "shit"})
+	sessionToken := userToken(t, server, "alice")
+
+	// The filters mask the username to "****", which must not get it past the blacklist
+	body := map[string]string{"listing_id": "zillow:1", "username": "Shit", "comment_text": "hello"}
+	problem := decode[models.Problem](t, do(t, server, http.MethodPost, "/api/v1/comments", sessionToken, body, http.StatusForbidden))
+	if problem.Code != blacklistReasonUsername {
+		t.Errorf("code = %q, want %q", problem.Code, blacklistReasonUsername)
+	}
+
+	body["username"] = "alice"
+	do(t, server, http.MethodPost, "/api/v1/comments", sessionToken, body, http.StatusCreated)
+}
+
+func TestRepliesToHiddenCommentsAreRefused(t *testing.T) {
+	server, memoryStore := newTestServer(t, ServerOptions{MaxReplyDepth: 3, CommentEditWindow: time.Hour})
+	sessionToken := userToken(t, server, "alice")
+	post := func(parentID string, wantStatus int) *httptest.ResponseRecorder {
+		t.Helper()
+		body := map[string]string{"listing_id": "zillow:1", "username": "alice", "comment_text": "hello", "parent_id": parentID}
+		return do(t, server, http.MethodPost, "/api/v1/comments", sessionToken, body, wantStatus)
+	}
+	thread := decode[models.ResponseComment](t, post("", http.StatusCreated))
+	reply := decode[models.ResponseComment](t, post(thread.CommentID.String(), http.StatusCreated))
+
+	// Hide the thread, as reports would
+	reportID, err := uuid.NewV7()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = memoryStore.ReportComment(context.Background(), models.Report{ReportID: reportID, CommentID: thread.CommentID, ReporterID: "bob", Reason: "spam"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the hidden comment nor the replies below it, which aren't shown either, can be answered
+	for _, parentID := range []uuid.UUID{thread.CommentID, reply.CommentID} {
+		problem := decode[models.Problem](t, post(parentID.String(), http.StatusBadRequest))
+		if problem.Code != codeInvalidParent || problem.Detail != errParentNotFound.Error() {
+			t.Errorf("reply to %s = %+v, want %q", parentID, problem, errParentNotFound)
+		}
+	}
+
+	// Nor can the replies be edited or their history read
+	do(t, server, http.MethodPatch, "/api/v1/comments/"+reply.CommentID.String(), sessionToken, map[string]string{"comment_text": "edited"}, http.StatusNotFound)
+	do(t, server, http.MethodGet, "/api/v1/comments/zillow:1/"+reply.CommentID.String()+"/revisions", "", nil, http.StatusNotFound)
+	if _, err := memoryStore.GetThreadInfo(context.Background(), reply.CommentID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetThreadInfo() of a reply to a hidden comment = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCommentCursorsKeepTheirPlaceAcrossVotes(t *testing.T) {
+	server, memoryStore := newTestServer(t, ServerOptions{})
+	sessionToken := userToken(t, server, "alice")
+	var commentIDs []uuid.UUID
+	for range 3 {
+		body := map[string]string{"listing_id": "zillow:1", "username": "alice", "comment_text": "hello"}
+		commentIDs = append(commentIDs, decode[models.ResponseComment](t, do(t, server, http.MethodPost, "/api/v1/comments", sessionToken, body, http.StatusCreated)).CommentID)
+	}
+	vote := func(commentID uuid.UUID, vote int) {
+		t.Helper()
+		if _, err := memoryStore.Vote(context.Background(), commentID, "bob", vote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	getPage := func(query string, wantStatus int) *httptest.ResponseRecorder {
+		t.Helper()
+		return do(t, server, http.MethodGet, "/api/v1/comments/zillow:1?sort=top&limit=1"+query, "", nil, wantStatus)
+	}
+
+	// The first comment is on top, then the others newest first
+	vote(commentIDs[0], 1)
+	page := decode[models.CommentPage](t, getPage("", http.StatusOK))
+	if len(page.Comments) != 1 || page.Comments[0].CommentID != commentIDs[0] || page.NextCursor == nil {
+		t.Fatalf("first page = %+v, want the first comment and a next cursor", page)
+	}
+
+	// Votes on the comment the cursor was taken from don't move the cursor, so the next pages skip none of the
+	// comments below it. The downvoted comment comes last now.
+	vote(commentIDs[0], -1)
+	var rest []uuid.UUID
+	for page.NextCursor != nil {
+		page = decode[models.CommentPage](t, getPage("&before="+*page.NextCursor, http.StatusOK))
+		for _, comment := range page.Comments {
+			rest = append(rest, comment.CommentID)
+		}
+	}
+	if want := []uuid.UUID{commentIDs[2], commentIDs[1], commentIDs[0]}; !slices.Equal(rest, want) {
+		t.Errorf("next pages = %v, want %v", rest, want)
+	}
+
+	// Cursors are only valid with the sort they came from
+	newPage := decode[models.CommentPage](t, do(t, server, http.MethodGet, "/api/v1/comments/zillow:1?limit=1", "", nil, http.StatusOK))
+	for _, cursor := range []string{"not-a-cursor", commentIDs[0].String(), *newPage.NextCursor} {
+		problem := decode[models.Problem](t, getPage("&before="+cursor, http.StatusBadRequest))
+		if problem.Code != codeInvalidField {
+			t.Errorf("cursor %q: code = %q, want %q", cursor, problem.Code, codeInvalidField)
+		}
+	}
+}
+
+func TestCommentRevisionsByListingURL(t *testing.T) {
+	server, _ := newTestServer(t, ServerOptions{})
+	body := map[string]string{"listing_id": "zillow:1", "username": "alice", "comment_text": "hello"}
+	comment := decode[models.ResponseComment](t, do(t, server, http.MethodPost, "/api/v1/comments", userToken(t, server, "alice"), body, http.StatusCreated))
+	revisionsPath := "/api/v1/comments/revisions/" + comment.CommentID.String()
+
+	history := decode[models.CommentHistory](t, do(t, server, http.MethodGet, revisionsPath+"?url="+url.QueryEscape("https://www.zillow.com/homedetails/1_zpid/"), "", nil, http.StatusOK))
+	if history.Comment.CommentID != comment.CommentID {
+		t.Errorf("history is of comment %s, want %s", history.Comment.CommentID, comment.CommentID)
+	}
+	do(t, server, http.MethodGet, revisionsPath+"?url="+url.QueryEscape("https://www.zillow.com/homedetails/2_zpid/"), "", nil, http.StatusNotFound)
+	do(t, server, http.MethodGet, revisionsPath, "", nil, http.StatusBadRequest)
+	do(t, server, http.MethodGet, "/api/v1/comments/zillow:1/"+comment.CommentID.String()+"/revisions?url="+url.QueryEscape("https://www.zillow.com/homedetails/1_zpid/"), "", nil, http.StatusBadRequest)
+}
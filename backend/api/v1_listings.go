@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/listing"
+	"zillow-commenter.com/m/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCountedListings is how many listings GetListingCommentCounts sums up at once, which is more than a page of
+// search results shows
+const maxCountedListings = 100
+
+// GetListingCommentCounts sums up the comments on several listings at once, so that search result pages can show
+// how many comments each listing has without fetching them.
+//
+// POST api/v1/listings/counts
+//
+// Input:
+//
+//	Post form or JSON body containing the following fields:
+//	- listing_id: The listings to sum up, as listing keys (e.g. "zillow:12345") or bare Zillow listing IDs.
+//	  Repeated once per listing, up to 100 times. JSON bodies send them as the listing_ids array instead.
+//
+// Output:
+//   - 200: A JSON object mapping each listing ID, as sent, to its number of visible comments (replies included)
+//     and the timestamp of the latest one, which is null if it has none. Structure defined in models package.
+//   - 400: If no listing ID is given, too many are, or one is invalid.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) GetListingCommentCounts(c *gin.Context) {
+	var request models.ListingCountsRequest
+	if err := bindBody(c, &request); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	listingIDs := request.ListingIDs
+	if len(listingIDs) == 0 {
+		respondInvalidField(c, "listing_ids", codeMissingField, "listing_ids is required")
+		return
+	}
+	if len(listingIDs) > maxCountedListings {
+		detail := fmt.Sprintf("Too many listings, at most %d can be counted at once", maxCountedListings)
+		respondInvalidField(c, "listing_ids", codeTooManyListings, detail)
+		return
+	}
+	logger := getLogger(c).With(slog.Int("listings", len(listingIDs)))
+
+	// Count the comments under the canonical keys, then answer with the IDs as the client sent them
+	keys := make([]string, 0, len(listingIDs))
+	for _, listingID := range listingIDs {
+		key, err := listing.Parse(listingID)
+		if err != nil {
+			logger.Info("invalid listing", logging.Error(err))
+			respondInvalidField(c, "listing_ids", codeInvalidListing, err.Error())
+			return
+		}
+		keys = append(keys, key.String())
+	}
+
+	counts, err := server.store.GetCommentCounts(c.Request.Context(), keys, server.hideBlacklistedComments)
+	if err != nil {
+		logger.Error("failed to count comments", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	response := models.ListingCommentCounts{Counts: make(map[string]models.ListingCommentCount, len(listingIDs))}
+	for i, listingID := range listingIDs {
+		response.Counts[listingID] = counts[keys[i]]
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"errors"
+	"html/template"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/listing"
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/notify"
+	"zillow-commenter.com/m/store"
+	"zillow-commenter.com/m/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"github.com/google/uuid"
+)
+
+// maxEmailLength is the longest email address a subscription can have, matching the listing_subscriptions table
+const maxEmailLength = 254
+
+// SubscribeListing subscribes a user to the comments posted on a listing, or changes the email of their
+// subscription. Subscribers get digests of the comments posted by others since the last one. If an email is given,
+// a link to verify it is sent there, and digests are only emailed once it is followed.
+//
+// POST api/v1/listings/:listing_id/subscribe
+//
+// Input:
+//
+//	Authorization header: "Bearer <token>", as issued by POST api/v1/user/token. The subscriber is the token's user.
+//	- listing_id: The listing to subscribe to, as a listing key (e.g. "zillow:12345") or a bare Zillow listing ID.
+//	Post form or JSON body containing the following fields:
+//	- email (optional): The email address to send the digests to. Leaving it out removes the subscription's email.
+//
+// Output:
+//   - 201: A JSON object representing the new subscription.
+//   - 200: A JSON object representing the subscription, if the user was already subscribed.
+//   - 400: If the listing or the email is invalid, or an email is given but the server can't send any.
+//   - 401: If the token is missing, invalid, or expired.
+//   - 403: If the client's IP or user ID is blacklisted.
+//   - 429: If too many verification emails were sent from the client's IP.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) SubscribeListing(c *gin.Context) {
+	// Get the user ID from the verified token rather than trusting the client
+	payload := getAuthPayload(c)
+	if payload == nil {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	listingKey, err := listing.Parse(c.Param("listing_id"))
+	if err != nil {
+		respondInvalidField(c, "listing_id", codeInvalidListing, err.Error())
+		return
+	}
+	listingID := listingKey.String()
+	logger := getLogger(c).With("listing_id", listingID)
+
+	var request models.SubscribeRequest
+	if err := bindBody(c, &request); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	email := strings.TrimSpace(request.Email)
+	if email != "" {
+		if server.notifier == nil {
+			respondInvalidField(c, "email", codeNotAvailable, "Email notifications are not available")
+			return
+		}
+		// Only bare addresses, without a display name
+		address, err := mail.ParseAddress(email)
+		if err != nil || address.Address != email || len(email) > maxEmailLength {
+			respondInvalidField(c, "email", codeInvalidField, "Invalid email")
+			return
+		}
+	}
+
+	// Refuse the subscription if the client's IP or user ID is blacklisted
+	reason, err := server.checkBlacklist(c.Request.Context(), clientIP(c), payload.UserID, "")
+	if err != nil {
+		logger.Error("failed to check blacklist", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if reason != "" {
+		respondBlacklisted(c, reason)
+		return
+	}
+
+	// Verification emails go to addresses the client chose, so they count against the per-IP limit on posts
+	if email != "" && server.rateLimits.PerIP.Enabled() {
+		result, err := server.rateLimiter.Take(c.Request.Context(), "verify-email-ip:"+clientIP(c), server.rateLimits.PerIP)
+		if err != nil {
+			logger.Error("failed to check rate limit", logging.Error(err))
+		} else if !result.Allowed {
+			logger.Info("rate limited", slog.String("bucket", "verify_email_ip"))
+			c.Header("Retry-After", strconv.Itoa(max(int(math.Ceil(result.RetryAfter.Seconds())), 1)))
+			respondProblem(c, http.StatusTooManyRequests, codeRateLimited, "Too many verification emails, please try again later")
+			return
+		}
+	}
+
+	// A new subscription is notified of the comments posted from now on, and V7 UUIDs sort by time
+	lastCommentID, err := uuid.NewV7()
+	if err != nil {
+		logger.Error("failed to generate subscription cursor", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	result, err := server.store.Subscribe(c.Request.Context(), models.Subscription{
+		ListingID:     listingID,
+		UserID:        payload.UserID,
+		Email:         email,
+		LastCommentID: lastCommentID,
+	})
+	if err != nil {
+		logger.Error("failed to subscribe", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	// Failing to send the verification email is only logged: subscribing again with the same email sends another
+	if result.EmailChanged && email != "" {
+		err = server.sendVerification(c, result.Subscription)
+		if err != nil {
+			logger.Error("failed to send verification email", logging.Error(err))
+		}
+	}
+
+	if !result.Created {
+		c.JSON(http.StatusOK, result.Subscription)
+		return
+	}
+	logger.Info("subscribed to listing", slog.Bool("email", email != ""))
+	c.JSON(http.StatusCreated, result.Subscription)
+}
+
+// sendVerification sends a link to verify the email of a subscription.
+func (server *Server) sendVerification(c *gin.Context, subscription models.Subscription) error {
+	verifyToken, err := server.maker.CreateSubscriptionToken(token.PurposeVerifyEmail, subscription.ListingID, subscription.UserID, subscription.Email, server.verifyEmailTokenDuration)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to create verification token"))
+	}
+	return server.notifier.SendVerification(c.Request.Context(), notify.Verification{
+		ListingID: subscription.ListingID,
+		Email:     subscription.Email,
+		VerifyURL: server.publicURL("/api/v1/listings/verify-email", verifyToken),
+	})
+}
+
+// UnsubscribeListing deletes a user's subscription to a listing.
+//
+// DELETE api/v1/listings/:listing_id/subscribe
+//
+// Input:
+//
+//	Authorization header: "Bearer <token>", as issued by POST api/v1/user/token. The subscriber is the token's user.
+//	- listing_id: The listing to unsubscribe from, as a listing key (e.g. "zillow:12345") or a bare Zillow listing ID.
+//
+// Output:
+//   - 204: The subscription was deleted.
+//   - 400: If the listing is invalid.
+//   - 401: If the token is missing, invalid, or expired.
+//   - 404: If the user isn't subscribed to the listing.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) UnsubscribeListing(c *gin.Context) {
+	payload := getAuthPayload(c)
+	if payload == nil {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	listingKey, err := listing.Parse(c.Param("listing_id"))
+	if err != nil {
+		respondInvalidField(c, "listing_id", codeInvalidListing, err.Error())
+		return
+	}
+	logger := getLogger(c).With("listing_id", listingKey.String())
+
+	err = server.store.Unsubscribe(c.Request.Context(), listingKey.String(), payload.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Subscription not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to unsubscribe", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	logger.Info("unsubscribed from listing")
+	c.Status(http.StatusNoContent)
+}
+
+// unsubscribePage is the page the unsubscribe links of digests lead to. It asks to confirm with a button, which posts
+// back to the link, and then tells that it is done.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Unsubscribe</title>
+</head>
+<body>
+{{if .Done}}
+<p>You are unsubscribed, and won't get emails about the comments on this listing anymore.</p>
+{{else}}
+<p>Stop getting emails about the comments on this listing?</p>
+<form method="post" action="?token={{.Token}}">
+<button type="submit">Unsubscribe</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// unsubscribePageData is what unsubscribePage shows.
+type unsubscribePageData struct {
+	Token string
+	Done  bool
+}
+
+// ConfirmUnsubscribe shows the page the unsubscribe link of a digest leads to, which asks to confirm with a button
+// posting to UnsubscribeWithToken. Following the link doesn't unsubscribe by itself, since mail scanners and link
+// previews follow links too.
+//
+// GET api/v1/listings/unsubscribe
+//
+// Input:
+//   - token (query): The unsubscribe token from the link.
+//
+// Output:
+//   - 200: An HTML page asking to confirm.
+//   - 400: If the token is invalid or expired.
+func (server *Server) ConfirmUnsubscribe(c *gin.Context) {
+	unsubscribeToken := c.Query("token")
+	_, err := server.maker.VerifySubscriptionToken(token.PurposeUnsubscribe, unsubscribeToken)
+	if err != nil {
+		respondInvalidField(c, "token", codeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	c.Render(http.StatusOK, render.HTML{
+		Template: unsubscribePage,
+		Data:     unsubscribePageData{Token: unsubscribeToken},
+	})
+}
+
+// UnsubscribeWithToken deletes a subscription through the link sent with its digests, without a session token. It is
+// the one-click unsubscribe of mail clients (RFC 8058), and the button of the page shown by ConfirmUnsubscribe.
+//
+// POST api/v1/listings/unsubscribe
+//
+// Input:
+//   - token (query): The unsubscribe token from the link.
+//
+// Output:
+//   - 200: The subscription was deleted, or didn't exist anymore. Browsers get an HTML page saying so.
+//   - 400: If the token is invalid or expired.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) UnsubscribeWithToken(c *gin.Context) {
+	payload, err := server.maker.VerifySubscriptionToken(token.PurposeUnsubscribe, c.Query("token"))
+	if err != nil {
+		respondInvalidField(c, "token", codeInvalidToken, "Invalid or expired token")
+		return
+	}
+	logger := getLogger(c).With("listing_id", payload.ListingID)
+
+	err = server.store.Unsubscribe(c.Request.Context(), payload.ListingID, payload.UserID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.Error("failed to unsubscribe", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	logger.Info("unsubscribed from listing", slog.Bool("with_token", true))
+	if c.NegotiateFormat(binding.MIMEJSON, binding.MIMEHTML) == binding.MIMEHTML {
+		c.Render(http.StatusOK, render.HTML{Template: unsubscribePage, Data: unsubscribePageData{Done: true}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "Unsubscribed"})
+}
+
+// VerifySubscriptionEmail verifies the email of a subscription through the link sent to it.
+//
+// GET api/v1/listings/verify-email
+//
+// Input:
+//   - token (query): The verification token from the link.
+//
+// Output:
+//   - 200: The email was verified, and digests will be sent to it.
+//   - 400: If the token is invalid or expired.
+//   - 404: If the subscription doesn't exist anymore, or has another email by now.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) VerifySubscriptionEmail(c *gin.Context) {
+	payload, err := server.maker.VerifySubscriptionToken(token.PurposeVerifyEmail, c.Query("token"))
+	if err != nil {
+		respondInvalidField(c, "token", codeInvalidToken, "Invalid or expired token")
+		return
+	}
+	logger := getLogger(c).With("listing_id", payload.ListingID)
+
+	err = server.store.VerifySubscriptionEmail(c.Request.Context(), payload.ListingID, payload.UserID, payload.Email)
+	if errors.Is(err, store.ErrNotFound) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "Subscription not found")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to verify subscription email", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	logger.Info("verified subscription email")
+	c.JSON(http.StatusOK, gin.H{"status": "Email verified"})
+}
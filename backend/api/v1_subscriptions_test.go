@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/notify"
+	"zillow-commenter.com/m/token"
+)
+
+// fakeNotifier keeps the notifications it is asked to send.
+type fakeNotifier struct {
+	mu            sync.Mutex
+	digests       []notify.Digest
+	verifications []notify.Verification
+}
+
+func (notifier *fakeNotifier) SendDigest(ctx context.Context, digest notify.Digest) error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.digests = append(notifier.digests, digest)
+	return nil
+}
+
+func (notifier *fakeNotifier) SendVerification(ctx context.Context, verification notify.Verification) error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	notifier.verifications = append(notifier.verifications, verification)
+	return nil
+}
+
+// lastDigest returns the last digest sent, failing the test if none was.
+func (notifier *fakeNotifier) lastDigest(t *testing.T) notify.Digest {
+	t.Helper()
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if len(notifier.digests) == 0 {
+		t.Fatal("no digest sent")
+	}
+	return notifier.digests[len(notifier.digests)-1]
+}
+
+const testPublicBaseURL = "https://comments.example.com"
+
+// linkPath turns a link from an email into the path and query of a request to the test server.
+func linkPath(t *testing.T, link string) string {
+	t.Helper()
+	if !strings.HasPrefix(link, testPublicBaseURL+"/") {
+		t.Fatalf("link %q doesn't start with the public base URL", link)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.RequestURI()
+}
+
+// sendDigests runs the digest job once, and fails the test if it didn't send the wanted number of digests.
+func sendDigests(t *testing.T, server *Server, want int) {
+	t.Helper()
+	sent, err := server.SendDigests(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != want {
+		t.Fatalf("SendDigests() sent %d digests, want %d", sent, want)
+	}
+}
+
+func TestSubscriptionEmailFlow(t *testing.T) {
+	notifier := &fakeNotifier{}
+	server, _ := newTestServer(t, ServerOptions{Notifier: notifier, PublicBaseURL: testPublicBaseURL})
+	alice := userToken(t, server, "alice")
+	bob := userToken(t, server, "bob")
+	postComment := func(sessionToken, text string) models.ResponseComment {
+		body := map[string]string{"listing_id": "zillow:1", "username": "someone", "comment_text": text}
+		return decode[models.ResponseComment](t, do(t, server, http.MethodPost, "/api/v1/comments", sessionToken, body, http.StatusCreated))
+	}
+
+	// Subscribing with an email sends a link to verify it
+	body := map[string]string{"email": "alice@example.com"}
+	subscription := decode[models.Subscription](t, do(t, server, http.MethodPost, "/api/v1/listings/zillow:1/subscribe", alice, body, http.StatusCreated))
+	if subscription.EmailVerified {
+		t.Error("new subscription has its email verified")
+	}
+	if len(notifier.verifications) != 1 || notifier.verifications[0].Email != "alice@example.com" {
+		t.Fatalf("verifications = %+v, want one to alice@example.com", notifier.verifications)
+	}
+
+	// Digests go out before the email is verified, but without it, so they don't count as emailed
+	postComment(bob, "first")
+	sendDigests(t, server, 0)
+	if digest := notifier.lastDigest(t); digest.Email != "" || len(digest.Comments) != 1 {
+		t.Errorf("digest before verification = %+v, want one comment and no email", digest)
+	}
+
+	do(t, server, http.MethodGet, linkPath(t, notifier.verifications[0].VerifyURL), "", nil, http.StatusOK)
+	postComment(bob, "second")
+	sendDigests(t, server, 1)
+	digest := notifier.lastDigest(t)
+	if digest.Email != "alice@example.com" {
+		t.Errorf("digest email = %q, want alice@example.com", digest.Email)
+	}
+	if len(digest.Comments) != 1 || digest.Comments[0].CommentText != "second" {
+		t.Errorf("digest comments = %+v, want only the second comment", digest.Comments)
+	}
+
+	// Subscribers aren't notified of their own comments
+	postComment(alice, "mine")
+	sendDigests(t, server, 0)
+
+	// Following the unsubscribe link only asks to confirm
+	unsubscribePath := linkPath(t, digest.UnsubscribeURL)
+	page := do(t, server, http.MethodGet, unsubscribePath, "", nil, http.StatusOK)
+	if !strings.HasPrefix(page.Header().Get("Content-Type"), "text/html") || !strings.Contains(page.Body.String(), `<form method="post"`) {
+		t.Errorf("unsubscribe link answered %q with %s, want a confirmation form", page.Header().Get("Content-Type"), page.Body)
+	}
+	postComment(bob, "third")
+	sendDigests(t, server, 1)
+
+	// The form of the page posts back to the link, which unsubscribes, as many times as it is posted
+	_, action, _ := strings.Cut(page.Body.String(), `action="`)
+	action, _, _ = strings.Cut(action, `"`)
+	formURL, err := url.Parse(unsubscribePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formURL, err = formURL.Parse(html.UnescapeString(action))
+	if err != nil || formURL.RequestURI() != unsubscribePath {
+		t.Fatalf("confirmation form posts to %q, want %q", action, unsubscribePath)
+	}
+	request := newTestRequest(t, http.MethodPost, unsubscribePath, "", nil)
+	request.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	request.Header.Set("Origin", "http://"+request.Host)
+	confirmation := serve(server, request)
+	if confirmation.Code != http.StatusOK || !strings.Contains(confirmation.Body.String(), "You are unsubscribed") {
+		t.Errorf("confirming answered %d: %s, want the unsubscribed page", confirmation.Code, confirmation.Body)
+	}
+	do(t, server, http.MethodPost, unsubscribePath, "", nil, http.StatusOK)
+	postComment(bob, "fourth")
+	sendDigests(t, server, 0)
+}
+
+func TestDigestsSkipBlacklistedComments(t *testing.T) {
+	notifier := &fakeNotifier{}
+	server, memoryStore := newTestServer(t, ServerOptions{Notifier: notifier, HideBlacklistedComments: true})
+	do(t, server, http.MethodPost, "/api/v1/listings/zillow:1/subscribe", userToken(t, server, "alice"), map[string]string{}, http.StatusCreated)
+	body := map[string]string{"listing_id": "zillow:1", "username": "mallory", "comment_text": "spam"}
+	do(t, server, http.MethodPost, "/api/v1/comments", userToken(t, server, "mallory"), body, http.StatusCreated)
+	memoryStore.AddBlacklistEntry(models.BlacklistEntry{Cause: "spam", UserID: "mallory"})
+
+	// The subscription has nothing to be notified of, so it isn't pending anymore
+	pending, err := memoryStore.GetPendingSubscriptions(context.Background(), "", "", digestPageSize, true)
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("GetPendingSubscriptions() = %+v, %v, want none", pending, err)
+	}
+	sendDigests(t, server, 0)
+	if len(notifier.digests) != 0 {
+		t.Errorf("digests = %+v, want none", notifier.digests)
+	}
+}
+
+func TestSubscriptionLinksRefuseBadTokens(t *testing.T) {
+	server, _ := newTestServer(t, ServerOptions{Notifier: &fakeNotifier{}, PublicBaseURL: testPublicBaseURL})
+
+	// A verification token doesn't unsubscribe
+	verifyToken, err := server.maker.CreateSubscriptionToken(token.PurposeVerifyEmail, "zillow:1", "alice", "alice@example.com", server.verifyEmailTokenDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		"/api/v1/listings/unsubscribe?token=nonsense",
+		"/api/v1/listings/unsubscribe?token=" + url.QueryEscape(verifyToken),
+		"/api/v1/listings/verify-email?token=nonsense",
+	} {
+		do(t, server, http.MethodGet, path, "", nil, http.StatusBadRequest)
+	}
+	do(t, server, http.MethodPost, "/api/v1/listings/unsubscribe?token="+url.QueryEscape(verifyToken), "", nil, http.StatusBadRequest)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"zillow-commenter.com/m/logging"
+	"zillow-commenter.com/m/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GenerateUserID generates a new user ID for the client.
+//
+// GET api/v1/user/user_id
+//
+// Output:
+//   - 200: A JSON object containing the generated user ID. ID is a V7 (Time) UUID.
+func (server *Server) GenerateUserID(c *gin.Context) {
+	// Generate a new UUID for the user using a timestamp-based version (v7) to ensure uniqueness
+	userID, err := uuid.NewV7()
+	if err != nil {
+		getLogger(c).Error("failed to generate user UUID", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	// Return the user ID as a JSON response
+	c.JSON(http.StatusOK, gin.H{"user_id": userID.String()})
+}
+
+// IssueUserToken generates a new user ID and a session token bound to it. Since anyone can get a new user ID this
+// way, tokens are refused to blacklisted IPs, and count against the per-IP limit on posts.
+//
+// POST api/v1/user/token
+//
+// Output:
+//   - 201: A JSON object containing the generated user ID, the token, and its expiry (unix seconds).
+//   - 403: If the client's IP is blacklisted.
+//   - 429: If the client's IP was issued too many tokens lately, with a Retry-After header.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) IssueUserToken(c *gin.Context) {
+	logger := getLogger(c)
+
+	reason, err := server.checkBlacklist(c.Request.Context(), clientIP(c), "", "")
+	if err != nil {
+		logger.Error("failed to check blacklist", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if reason != "" {
+		respondBlacklisted(c, reason)
+		return
+	}
+
+	if server.rateLimits.PerIP.Enabled() {
+		result, err := server.rateLimiter.Take(c.Request.Context(), "token-ip:"+clientIP(c), server.rateLimits.PerIP)
+		if err != nil {
+			logger.Error("failed to check rate limit", logging.Error(err))
+		} else if !result.Allowed {
+			logger.Info("rate limited", slog.String("bucket", "token_ip"))
+			c.Header("Retry-After", strconv.Itoa(max(int(math.Ceil(result.RetryAfter.Seconds())), 1)))
+			respondProblem(c, http.StatusTooManyRequests, codeRateLimited, "Too many tokens, please try again later")
+			return
+		}
+	}
+
+	// Generate a new UUID for the user using a timestamp-based version (v7) to ensure uniqueness
+	userID, err := uuid.NewV7()
+	if err != nil {
+		logger.Error("failed to generate user UUID", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	accessToken, payload, err := server.maker.CreateToken(userID.String(), server.userTokenDuration)
+	if err != nil {
+		logger.Error("failed to create user token", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	respondWithToken(c, http.StatusCreated, accessToken, payload)
+}
+
+// RefreshUserToken issues a fresh session token for the user ID of the token used to authenticate the request. Tokens
+// can only be refreshed for the session lifetime after the first token of the user ID was issued, and don't outlive
+// it, so that a client has to get a new user ID at some point.
+//
+// POST api/v1/user/token/refresh
+//
+// Input:
+//   - Authorization header: "Bearer <token>" with a valid, unexpired token.
+//
+// Output:
+//   - 200: A JSON object containing the user ID, the new token, and its expiry (unix seconds).
+//   - 401: If the token is missing, invalid, or expired, or if its session's lifetime is up.
+//   - 500: Internal server error if something goes wrong.
+func (server *Server) RefreshUserToken(c *gin.Context) {
+	previous := getAuthPayload(c)
+	if previous == nil {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	accessToken, payload, err := server.maker.RefreshToken(previous, server.userTokenDuration, server.userSessionLifetime)
+	if errors.Is(err, token.ErrExpiredToken) {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "Session expired, request a new token")
+		return
+	}
+	if err != nil {
+		getLogger(c).Error("failed to refresh user token", logging.Error(err))
+		respondInternalError(c)
+		return
+	}
+	respondWithToken(c, http.StatusOK, accessToken, payload)
+}
+
+// respondWithToken writes a session token and its payload to the response with the given status.
+func respondWithToken(c *gin.Context, status int, accessToken string, payload *token.Payload) {
+	c.JSON(status, gin.H{
+		"user_id":    payload.UserID,
+		"token":      accessToken,
+		"expires_at": payload.ExpiredAt.Unix(),
+	})
+}
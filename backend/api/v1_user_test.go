@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/ratelimit"
+	"zillow-commenter.com/m/token"
+)
+
+// tokenResponse is the body of the token endpoints.
+type tokenResponse struct {
+	UserID    string `json:"user_id"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func TestIssueUserTokenLimitsIPs(t *testing.T) {
+	server, memoryStore := newTestServer(t, ServerOptions{
+		RateLimits: RateLimits{PerIP: ratelimit.Limit{Burst: 2, Period: time.Hour}},
+	})
+
+	first := decode[tokenResponse](t, do(t, server, http.MethodPost, "/api/v1/user/token", "", nil, http.StatusCreated))
+	second := decode[tokenResponse](t, do(t, server, http.MethodPost, "/api/v1/user/token", "", nil, http.StatusCreated))
+	if first.UserID == second.UserID {
+		t.Errorf("both tokens are for user ID %s, want a new one each", first.UserID)
+	}
+	limited := do(t, server, http.MethodPost, "/api/v1/user/token", "", nil, http.StatusTooManyRequests)
+	if limited.Header().Get("Retry-After") == "" {
+		t.Error("rate limited response has no Retry-After header")
+	}
+
+	// httptest requests come from 192.0.2.1
+	memoryStore.AddBlacklistEntry(models.BlacklistEntry{Cause: "spam", UserIP: "192.0.2.1"})
+	problem := decode[models.Problem](t, do(t, server, http.MethodPost, "/api/v1/user/token", "", nil, http.StatusForbidden))
+	if problem.Code != blacklistReasonIP {
+		t.Errorf("code = %q, want %q", problem.Code, blacklistReasonIP)
+	}
+}
+
+func TestRefreshUserTokenEndsWithSession(t *testing.T) {
+	server, _ := newTestServer(t, ServerOptions{UserTokenDuration: time.Hour, UserSessionLifetime: 2 * time.Hour})
+	sessionToken := func(startedAgo, lifetime time.Duration) string {
+		t.Helper()
+		sessionToken, _, err := server.maker.RefreshToken(&token.Payload{
+			UserID:           "alice",
+			SessionStartedAt: time.Now().Add(-startedAgo),
+		}, time.Hour, lifetime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sessionToken
+	}
+
+	// Refreshed tokens keep the user ID, but don't outlive the session
+	started := time.Now().Add(-90 * time.Minute)
+	refreshed := decode[tokenResponse](t, do(t, server, http.MethodPost, "/api/v1/user/token/refresh", sessionToken(90*time.Minute, 2*time.Hour), nil, http.StatusOK))
+	if refreshed.UserID != "alice" {
+		t.Errorf("user ID = %q, want alice", refreshed.UserID)
+	}
+	if end := started.Add(2 * time.Hour).Unix(); refreshed.ExpiresAt < end-5 || refreshed.ExpiresAt > end+5 {
+		t.Errorf("expires_at = %d, want the end of the session, %d", refreshed.ExpiresAt, end)
+	}
+
+	// A token still valid from a longer lifetime can't be refreshed past the current one
+	do(t, server, http.MethodPost, "/api/v1/user/token/refresh", sessionToken(3*time.Hour, 10*time.Hour), nil, http.StatusUnauthorized)
+}
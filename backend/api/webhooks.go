@@ -0,0 +1,32 @@
+package api
+
+import (
+	"context"
+	"errors"
+)
+
+// wakeWebhookDispatcher has the events queued by a request delivered right away. The store queues them along with the
+// change that raised them, e.g. the comment.created event with the comment.
+func (server *Server) wakeWebhookDispatcher() {
+	if server.webhooks == nil {
+		return
+	}
+	server.webhooks.Wake()
+}
+
+// DeliverWebhooks sends the webhook deliveries that are due, and returns how many were attempted.
+func (server *Server) DeliverWebhooks(ctx context.Context) (int, error) {
+	if server.webhooks == nil {
+		return 0, errors.New("webhooks need a database, set CONNECTION_STRING")
+	}
+	return server.webhooks.DeliverPending(ctx)
+}
+
+// RunWebhookDispatcher delivers the queued webhook events until the context is done. It does nothing without a
+// database.
+func (server *Server) RunWebhookDispatcher(ctx context.Context) {
+	if server.webhooks == nil {
+		return
+	}
+	server.webhooks.Run(ctx)
+}
@@ -0,0 +1,62 @@
+// The buildinfo package tells which build of the server is running. The commit and build time are set at build time:
+//
+//	go build -ldflags "-X zillow-commenter.com/m/buildinfo.Commit=$(git rev-parse HEAD) -X zillow-commenter.com/m/buildinfo.Time=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them, the commit and commit time Go embeds in binaries built inside the repository are used instead.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set through -ldflags "-X" at build time
+var (
+	// Commit is the git SHA the server was built from
+	Commit string
+	// Time is when the server was built, in RFC 3339
+	Time string
+)
+
+// unknown stands for the values that weren't set at build time and couldn't be read from the binary
+const unknown = "unknown"
+
+// Info describes the build of the running server.
+type Info struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build of the running server. The values set at build time take precedence over the ones Go
+// embedded in the binary.
+func Get() Info {
+	info := Info{
+		Commit:    Commit,
+		BuildTime: Time,
+		GoVersion: runtime.Version(),
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = unknown
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = unknown
+	}
+	return info
+}
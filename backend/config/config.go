@@ -0,0 +1,280 @@
+// The config package loads the settings of the application into a typed Config, from (by increasing precedence)
+// the defaults, an optional YAML file named by CONFIG_FILE, a .env file, and the environment.
+//
+// Secrets (the token key, the admin key, the database password, the SMTP password and the log hash key) are
+// redacted when the Config is printed.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"zillow-commenter.com/m/filter"
+	"zillow-commenter.com/m/ratelimit"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Server modes. In lambda mode the router is proxied to AWS Lambda, otherwise it is served directly.
+const (
+	ModeLambda = "lambda"
+	ModeHTTP   = "http"
+	ModeHTTPS  = "https"
+)
+
+// Defaults, used for the settings that are set neither in the config file nor in the environment
+const (
+	DefaultServerAddress = ":3000"
+
+	// The pool is kept small by default, since every Lambda instance has its own and handles one request at a time
+	DefaultMaxConns          = 4
+	DefaultMaxConnLifetime   = time.Hour
+	DefaultMaxConnIdleTime   = 30 * time.Minute
+	DefaultHealthCheckPeriod = time.Minute
+
+	DefaultUserTokenDuration        = 30 * 24 * time.Hour
+	DefaultUserSessionLifetime      = 365 * 24 * time.Hour
+	DefaultVerifyEmailTokenDuration = 24 * time.Hour
+	DefaultUnsubscribeTokenDuration = 365 * 24 * time.Hour
+
+	DefaultMaxReplyDepth               = 3
+	DefaultCommentEditWindow           = 15 * time.Minute
+	DefaultDeletedCommentRetentionDays = 30
+	DefaultReportHideThreshold         = 3
+
+	// Browsers cap the preflight cache anyway, Chrome at 2 hours
+	DefaultCORSMaxAge = 2 * time.Hour
+
+	// AnyOrigin on its own in the allowed CORS origins lets every origin call the API
+	AnyOrigin = "*"
+
+	DefaultSMTPPort       = 587
+	DefaultDigestInterval = time.Hour
+
+	DefaultMetricsNamespace = "ZillowCommenter"
+)
+
+// tokenKeyLength is the length of the key tokens are signed with, as required by PASETO v2
+const tokenKeyLength = 32
+
+// Config holds the settings of the application. The comment on each field names its environment variable.
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Token      TokenConfig      `yaml:"token"`
+	Admin      AdminConfig      `yaml:"admin"`
+	CORS       CORSConfig       `yaml:"cors"`
+	Comments   CommentsConfig   `yaml:"comments"`
+	RateLimits RateLimitsConfig `yaml:"rate_limits"`
+	Email      EmailConfig      `yaml:"email"`
+	Log        LogConfig        `yaml:"log"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+}
+
+// ServerConfig holds how the API is served. The command-line flags take precedence over it.
+type ServerConfig struct {
+	Mode        string `yaml:"mode"`          // SERVER_MODE: lambda, http or https
+	Address     string `yaml:"address"`       // SERVER_ADDRESS, in http and https modes
+	TLSCertFile string `yaml:"tls_cert_file"` // TLS_CERT_FILE, in https mode
+	TLSKeyFile  string `yaml:"tls_key_file"`  // TLS_KEY_FILE, in https mode
+	// TrustedProxies are the IPs or CIDR ranges of the reverse proxies whose X-Forwarded-For header gives the client
+	// IP. None is trusted by default, so that clients can't pick their own IP. Unused under Lambda, where the client
+	// IP is the source IP seen by API Gateway.
+	TrustedProxies []string `yaml:"trusted_proxies"` // TRUSTED_PROXIES, comma-separated
+}
+
+// DatabaseConfig holds the Postgres connection and the sizing of its pool. Comments are kept in memory if
+// ConnectionString is empty.
+type DatabaseConfig struct {
+	ConnectionString  string        `yaml:"connection_string"`   // CONNECTION_STRING
+	AutoMigrate       bool          `yaml:"auto_migrate"`        // AUTO_MIGRATE
+	MaxConns          int32         `yaml:"max_conns"`           // DB_MAX_CONNS
+	MinConns          int32         `yaml:"min_conns"`           // DB_MIN_CONNS
+	MaxConnLifetime   time.Duration `yaml:"max_conn_lifetime"`   // DB_MAX_CONN_LIFETIME
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time"`  // DB_MAX_CONN_IDLE_TIME
+	HealthCheckPeriod time.Duration `yaml:"health_check_period"` // DB_HEALTH_CHECK_PERIOD
+}
+
+// TokenConfig holds the key tokens are signed with, and how long each kind of token stays valid.
+type TokenConfig struct {
+	Key                      string        `yaml:"key"`                         // TOKEN_KEY
+	UserTokenDuration        time.Duration `yaml:"user_token_duration"`         // USER_TOKEN_DURATION
+	UserSessionLifetime      time.Duration `yaml:"user_session_lifetime"`       // USER_SESSION_LIFETIME
+	VerifyEmailTokenDuration time.Duration `yaml:"verify_email_token_duration"` // VERIFY_EMAIL_TOKEN_DURATION
+	UnsubscribeTokenDuration time.Duration `yaml:"unsubscribe_token_duration"`  // UNSUBSCRIBE_TOKEN_DURATION
+}
+
+// AdminConfig holds the settings of the admin API.
+type AdminConfig struct {
+	APIKey string `yaml:"api_key"` // ADMIN_API_KEY. The admin API refuses every request if it is empty.
+}
+
+// CORSConfig holds which origins may call the API from a browser, and what their requests may carry. Origins may
+// contain a "*" matching any part but a slash, e.g. "https://*.example.com", and "*" on its own lets every origin call
+// the API. No origin may if none is set.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`   // CORS_ALLOWED_ORIGINS, comma-separated
+	AllowedMethods   []string      `yaml:"allowed_methods"`   // CORS_ALLOWED_METHODS, comma-separated
+	AllowedHeaders   []string      `yaml:"allowed_headers"`   // CORS_ALLOWED_HEADERS, comma-separated
+	AllowCredentials bool          `yaml:"allow_credentials"` // CORS_ALLOW_CREDENTIALS
+	MaxAge           time.Duration `yaml:"max_age"`           // CORS_MAX_AGE, how long browsers may cache preflights
+}
+
+// CommentsConfig holds the limits on comments and the settings of the comment filters.
+type CommentsConfig struct {
+	MaxCommentLength            int           `yaml:"max_comment_length"`             // MAX_COMMENT_LENGTH
+	MaxUsernameLength           int           `yaml:"max_username_length"`            // MAX_USERNAME_LENGTH
+	MaxReplyDepth               int           `yaml:"max_reply_depth"`                // MAX_REPLY_DEPTH
+	EditWindow                  time.Duration `yaml:"edit_window"`                    // COMMENT_EDIT_WINDOW
+	DeletedCommentRetentionDays int           `yaml:"deleted_comment_retention_days"` // DELETED_COMMENT_RETENTION_DAYS
+	ReportHideThreshold         int           `yaml:"report_hide_threshold"`          // REPORT_HIDE_THRESHOLD
+	HideBlacklistedComments     bool          `yaml:"hide_blacklisted_comments"`      // HIDE_BLACKLISTED_COMMENTS
+	WordlistFile                string        `yaml:"wordlist_file"`                  // COMMENT_WORDLIST_FILE
+	WordlistAction              filter.Action `yaml:"wordlist_action"`                // COMMENT_WORDLIST_ACTION
+	LinkAction                  filter.Action `yaml:"link_action"`                    // COMMENT_LINK_ACTION
+	AllowedLinkDomains          []string      `yaml:"allowed_link_domains"`           // COMMENT_ALLOWED_LINK_DOMAINS
+}
+
+// RateLimitsConfig holds the limits on posting comments.
+type RateLimitsConfig struct {
+	PerIP      ratelimit.Limit `yaml:"per_ip"`      // RATE_LIMIT_IP
+	PerUser    ratelimit.Limit `yaml:"per_user"`    // RATE_LIMIT_USER
+	PerListing ratelimit.Limit `yaml:"per_listing"` // RATE_LIMIT_LISTING
+}
+
+// EmailConfig holds the SMTP server the subscription emails are sent through. Subscriptions get no emails if
+// SMTPHost is empty.
+type EmailConfig struct {
+	SMTPHost       string        `yaml:"smtp_host"`       // SMTP_HOST
+	SMTPPort       int           `yaml:"smtp_port"`       // SMTP_PORT
+	SMTPUsername   string        `yaml:"smtp_username"`   // SMTP_USERNAME
+	SMTPPassword   string        `yaml:"smtp_password"`   // SMTP_PASSWORD
+	SMTPFrom       string        `yaml:"smtp_from"`       // SMTP_FROM
+	PublicBaseURL  string        `yaml:"public_base_url"` // PUBLIC_BASE_URL, which the links in the emails start with
+	DigestInterval time.Duration `yaml:"digest_interval"` // DIGEST_INTERVAL
+}
+
+// LogConfig holds the settings of the logger.
+type LogConfig struct {
+	Level   slog.Level `yaml:"level"`    // LOG_LEVEL: debug, info, warn or error
+	HashKey string     `yaml:"hash_key"` // LOG_HASH_KEY. A random key is used per process if it is empty.
+}
+
+// MetricsConfig holds the settings of the metrics.
+type MetricsConfig struct {
+	Namespace string `yaml:"namespace"` // METRICS_NAMESPACE, the CloudWatch namespace under Lambda
+}
+
+// Default returns the settings used when nothing is configured. It has no token key, so it isn't valid as is.
+func Default() Config {
+	filterConfig := filter.DefaultConfig()
+	return Config{
+		Server: ServerConfig{
+			Mode:        ModeLambda,
+			Address:     DefaultServerAddress,
+			TLSCertFile: "./ssl/public_certificate.pem",
+			TLSKeyFile:  "./ssl/private_key.pem",
+		},
+		Database: DatabaseConfig{
+			MaxConns:          DefaultMaxConns,
+			MaxConnLifetime:   DefaultMaxConnLifetime,
+			MaxConnIdleTime:   DefaultMaxConnIdleTime,
+			HealthCheckPeriod: DefaultHealthCheckPeriod,
+		},
+		Token: TokenConfig{
+			UserTokenDuration:        DefaultUserTokenDuration,
+			UserSessionLifetime:      DefaultUserSessionLifetime,
+			VerifyEmailTokenDuration: DefaultVerifyEmailTokenDuration,
+			UnsubscribeTokenDuration: DefaultUnsubscribeTokenDuration,
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID", "Last-Event-ID"},
+			MaxAge:         DefaultCORSMaxAge,
+		},
+		Comments: CommentsConfig{
+			MaxCommentLength:            filterConfig.MaxCommentLength,
+			MaxUsernameLength:           filterConfig.MaxUsernameLength,
+			MaxReplyDepth:               DefaultMaxReplyDepth,
+			EditWindow:                  DefaultCommentEditWindow,
+			DeletedCommentRetentionDays: DefaultDeletedCommentRetentionDays,
+			ReportHideThreshold:         DefaultReportHideThreshold,
+			WordlistAction:              filterConfig.WordlistAction,
+			LinkAction:                  filterConfig.LinkAction,
+			AllowedLinkDomains:          filterConfig.AllowedLinkDomains,
+		},
+		RateLimits: RateLimitsConfig{
+			PerIP:      ratelimit.Limit{Burst: 20, Period: 10 * time.Minute},
+			PerUser:    ratelimit.Limit{Burst: 10, Period: 10 * time.Minute},
+			PerListing: ratelimit.Limit{Burst: 60, Period: 10 * time.Minute},
+		},
+		Email: EmailConfig{
+			SMTPPort:       DefaultSMTPPort,
+			DigestInterval: DefaultDigestInterval,
+		},
+		Log: LogConfig{
+			Level: slog.LevelInfo,
+		},
+		Metrics: MetricsConfig{
+			Namespace: DefaultMetricsNamespace,
+		},
+	}
+}
+
+// Load reads the settings: the defaults, overridden by the YAML file named by CONFIG_FILE if it is set, overridden by
+// the environment. Variables from a .env file in the working directory are added to the environment first, without
+// replacing the ones already set.
+//
+// Load only fails on settings it can't parse. Call Validate before using the Config, which not every command needs to
+// be complete (e.g. migrations don't need a token key).
+func Load() (*Config, error) {
+	godotenv.Load()
+
+	config := Default()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		err := config.loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := config.loadEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	config.Email.PublicBaseURL = strings.TrimSuffix(config.Email.PublicBaseURL, "/")
+	return &config, nil
+}
+
+// loadFile overrides the settings set in a YAML file. Unknown keys are refused, so that a typo doesn't go unnoticed.
+func (config *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to open config file"))
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	err = decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+	return nil
+}
+
+// String formats the config as YAML, with its secrets redacted.
+func (config Config) String() string {
+	out, err := yaml.Marshal(config.Redacted())
+	if err != nil {
+		return fmt.Sprintf("failed to format config: %v", err)
+	}
+	return string(out)
+}
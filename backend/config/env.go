@@ -0,0 +1,170 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadEnv overrides the settings set in the environment. Empty variables count as unset, except for the lists,
+// which an empty variable clears.
+func (config *Config) loadEnv() error {
+	env := &envReader{}
+
+	env.string("SERVER_MODE", &config.Server.Mode)
+	env.string("SERVER_ADDRESS", &config.Server.Address)
+	env.string("TLS_CERT_FILE", &config.Server.TLSCertFile)
+	env.string("TLS_KEY_FILE", &config.Server.TLSKeyFile)
+	env.list("TRUSTED_PROXIES", &config.Server.TrustedProxies)
+
+	env.string("CONNECTION_STRING", &config.Database.ConnectionString)
+	env.bool("AUTO_MIGRATE", &config.Database.AutoMigrate)
+	env.int32("DB_MAX_CONNS", &config.Database.MaxConns)
+	env.int32("DB_MIN_CONNS", &config.Database.MinConns)
+	env.duration("DB_MAX_CONN_LIFETIME", &config.Database.MaxConnLifetime)
+	env.duration("DB_MAX_CONN_IDLE_TIME", &config.Database.MaxConnIdleTime)
+	env.duration("DB_HEALTH_CHECK_PERIOD", &config.Database.HealthCheckPeriod)
+
+	env.string("TOKEN_KEY", &config.Token.Key)
+	env.duration("USER_TOKEN_DURATION", &config.Token.UserTokenDuration)
+	env.duration("USER_SESSION_LIFETIME", &config.Token.UserSessionLifetime)
+	env.duration("VERIFY_EMAIL_TOKEN_DURATION", &config.Token.VerifyEmailTokenDuration)
+	env.duration("UNSUBSCRIBE_TOKEN_DURATION", &config.Token.UnsubscribeTokenDuration)
+
+	env.string("ADMIN_API_KEY", &config.Admin.APIKey)
+
+	env.list("CORS_ALLOWED_ORIGINS", &config.CORS.AllowedOrigins)
+	env.list("CORS_ALLOWED_METHODS", &config.CORS.AllowedMethods)
+	env.list("CORS_ALLOWED_HEADERS", &config.CORS.AllowedHeaders)
+	env.bool("CORS_ALLOW_CREDENTIALS", &config.CORS.AllowCredentials)
+	env.duration("CORS_MAX_AGE", &config.CORS.MaxAge)
+
+	env.int("MAX_COMMENT_LENGTH", &config.Comments.MaxCommentLength)
+	env.int("MAX_USERNAME_LENGTH", &config.Comments.MaxUsernameLength)
+	env.int("MAX_REPLY_DEPTH", &config.Comments.MaxReplyDepth)
+	env.duration("COMMENT_EDIT_WINDOW", &config.Comments.EditWindow)
+	env.int("DELETED_COMMENT_RETENTION_DAYS", &config.Comments.DeletedCommentRetentionDays)
+	env.int("REPORT_HIDE_THRESHOLD", &config.Comments.ReportHideThreshold)
+	env.bool("HIDE_BLACKLISTED_COMMENTS", &config.Comments.HideBlacklistedComments)
+	env.string("COMMENT_WORDLIST_FILE", &config.Comments.WordlistFile)
+	env.text("COMMENT_WORDLIST_ACTION", &config.Comments.WordlistAction)
+	env.text("COMMENT_LINK_ACTION", &config.Comments.LinkAction)
+	env.list("COMMENT_ALLOWED_LINK_DOMAINS", &config.Comments.AllowedLinkDomains)
+
+	env.text("RATE_LIMIT_IP", &config.RateLimits.PerIP)
+	env.text("RATE_LIMIT_USER", &config.RateLimits.PerUser)
+	env.text("RATE_LIMIT_LISTING", &config.RateLimits.PerListing)
+
+	env.string("SMTP_HOST", &config.Email.SMTPHost)
+	env.int("SMTP_PORT", &config.Email.SMTPPort)
+	env.string("SMTP_USERNAME", &config.Email.SMTPUsername)
+	env.string("SMTP_PASSWORD", &config.Email.SMTPPassword)
+	env.string("SMTP_FROM", &config.Email.SMTPFrom)
+	env.string("PUBLIC_BASE_URL", &config.Email.PublicBaseURL)
+	env.duration("DIGEST_INTERVAL", &config.Email.DigestInterval)
+
+	env.text("LOG_LEVEL", &config.Log.Level)
+	env.string("LOG_HASH_KEY", &config.Log.HashKey)
+
+	env.string("METRICS_NAMESPACE", &config.Metrics.Namespace)
+
+	return errors.Join(env.errs...)
+}
+
+// envReader parses environment variables into settings, collecting the errors so that they are all reported at once.
+type envReader struct {
+	errs []error
+}
+
+// fail records that the value of a variable couldn't be parsed.
+func (env *envReader) fail(key, value string) {
+	env.errs = append(env.errs, fmt.Errorf("invalid %s: %q", key, value))
+}
+
+func (env *envReader) string(key string, setting *string) {
+	if value := os.Getenv(key); value != "" {
+		*setting = value
+	}
+}
+
+func (env *envReader) bool(key string, setting *bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		env.fail(key, value)
+		return
+	}
+	*setting = parsed
+}
+
+func (env *envReader) int(key string, setting *int) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		env.fail(key, value)
+		return
+	}
+	*setting = parsed
+}
+
+func (env *envReader) int32(key string, setting *int32) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	parsed, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		env.fail(key, value)
+		return
+	}
+	*setting = int32(parsed)
+}
+
+func (env *envReader) duration(key string, setting *time.Duration) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		env.fail(key, value)
+		return
+	}
+	*setting = parsed
+}
+
+// list reads a comma-separated list, leaving out the blank items.
+func (env *envReader) list(key string, setting *[]string) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+	*setting = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*setting = append(*setting, item)
+		}
+	}
+}
+
+// text reads a setting that parses itself, such as a log level or a rate limit.
+func (env *envReader) text(key string, setting encoding.TextUnmarshaler) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	err := setting.UnmarshalText([]byte(value))
+	if err != nil {
+		env.errs = append(env.errs, fmt.Errorf("invalid %s: %w", key, err))
+	}
+}
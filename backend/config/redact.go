@@ -0,0 +1,55 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+)
+
+// redacted replaces the secrets of a printed Config
+const redacted = "REDACTED"
+
+// keyValuePassword matches the password of a key/value connection string, e.g. "host=db password=secret"
+var keyValuePassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Redacted returns a copy of the config with its secrets replaced, which is safe to print or log. Empty secrets stay
+// empty, so that it still shows which ones are missing.
+func (config Config) Redacted() Config {
+	config.Database.ConnectionString = redactConnectionString(config.Database.ConnectionString)
+	config.Token.Key = redact(config.Token.Key)
+	config.Admin.APIKey = redact(config.Admin.APIKey)
+	config.Email.SMTPPassword = redact(config.Email.SMTPPassword)
+	config.Log.HashKey = redact(config.Log.HashKey)
+
+	// Don't share the lists with the original
+	config.Server.TrustedProxies = slices.Clone(config.Server.TrustedProxies)
+	config.CORS.AllowedOrigins = slices.Clone(config.CORS.AllowedOrigins)
+	config.CORS.AllowedMethods = slices.Clone(config.CORS.AllowedMethods)
+	config.CORS.AllowedHeaders = slices.Clone(config.CORS.AllowedHeaders)
+	config.Comments.AllowedLinkDomains = slices.Clone(config.Comments.AllowedLinkDomains)
+	return config
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactConnectionString replaces the password of a Postgres connection string, in URL or key/value form.
+func redactConnectionString(connectionString string) string {
+	parsed, err := url.Parse(connectionString)
+	if err == nil && parsed.Scheme != "" {
+		if _, hasPassword := parsed.User.Password(); hasPassword {
+			parsed.User = url.UserPassword(parsed.User.Username(), redacted)
+		}
+		query := parsed.Query()
+		if query.Has("password") {
+			query.Set("password", redacted)
+			parsed.RawQuery = query.Encode()
+		}
+		return parsed.String()
+	}
+	return keyValuePassword.ReplaceAllString(connectionString, "${1}"+redacted)
+}
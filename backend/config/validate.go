@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"zillow-commenter.com/m/filter"
+)
+
+// Validate checks that the settings are complete and consistent, and reports every problem at once.
+func (config *Config) Validate() error {
+	var errs []error
+	invalid := func(setting, env, reason string) {
+		errs = append(errs, fmt.Errorf("invalid %s (%s): %s", setting, env, reason))
+	}
+
+	switch config.Server.Mode {
+	case ModeLambda, ModeHTTP, ModeHTTPS:
+	default:
+		invalid("server.mode", "SERVER_MODE", fmt.Sprintf("%q must be %s, %s or %s", config.Server.Mode, ModeLambda, ModeHTTP, ModeHTTPS))
+	}
+	if config.Server.Mode != ModeLambda && config.Server.Address == "" {
+		invalid("server.address", "SERVER_ADDRESS", "must be set")
+	}
+	for _, proxy := range config.Server.TrustedProxies {
+		if !isIPOrCIDR(proxy) {
+			invalid("server.trusted_proxies", "TRUSTED_PROXIES", fmt.Sprintf("%q is not an IP address or CIDR range", proxy))
+		}
+	}
+
+	database := config.Database
+	if database.MaxConns < 1 {
+		invalid("database.max_conns", "DB_MAX_CONNS", "must be at least 1")
+	}
+	if database.MinConns < 0 || database.MinConns > database.MaxConns {
+		invalid("database.min_conns", "DB_MIN_CONNS", "must be between 0 and database.max_conns")
+	}
+	if database.MaxConnLifetime <= 0 {
+		invalid("database.max_conn_lifetime", "DB_MAX_CONN_LIFETIME", "must be positive")
+	}
+	if database.MaxConnIdleTime <= 0 {
+		invalid("database.max_conn_idle_time", "DB_MAX_CONN_IDLE_TIME", "must be positive")
+	}
+	if database.HealthCheckPeriod <= 0 {
+		invalid("database.health_check_period", "DB_HEALTH_CHECK_PERIOD", "must be positive")
+	}
+
+	if len(config.Token.Key) != tokenKeyLength {
+		invalid("token.key", "TOKEN_KEY", fmt.Sprintf("must be exactly %d characters", tokenKeyLength))
+	}
+	if config.Token.UserTokenDuration <= 0 {
+		invalid("token.user_token_duration", "USER_TOKEN_DURATION", "must be positive")
+	}
+	if config.Token.UserSessionLifetime < config.Token.UserTokenDuration {
+		invalid("token.user_session_lifetime", "USER_SESSION_LIFETIME", "must be at least the user token duration")
+	}
+	if config.Token.VerifyEmailTokenDuration <= 0 {
+		invalid("token.verify_email_token_duration", "VERIFY_EMAIL_TOKEN_DURATION", "must be positive")
+	}
+	if config.Token.UnsubscribeTokenDuration <= 0 {
+		invalid("token.unsubscribe_token_duration", "UNSUBSCRIBE_TOKEN_DURATION", "must be positive")
+	}
+
+	cors := config.CORS
+	for _, origin := range cors.AllowedOrigins {
+		if origin != AnyOrigin && !isOriginPattern(origin) {
+			invalid("cors.allowed_origins", "CORS_ALLOWED_ORIGINS", fmt.Sprintf("%q is not an origin such as https://example.com or chrome-extension://<id>", origin))
+		}
+	}
+	// Letting every origin send credentials would let any site act as the users of the browser
+	if cors.AllowCredentials && slices.Contains(cors.AllowedOrigins, AnyOrigin) {
+		invalid("cors.allow_credentials", "CORS_ALLOW_CREDENTIALS", "needs explicit allowed origins, not *")
+	}
+	for _, method := range cors.AllowedMethods {
+		if !validMethod.MatchString(method) {
+			invalid("cors.allowed_methods", "CORS_ALLOWED_METHODS", fmt.Sprintf("%q is not an HTTP method", method))
+		}
+	}
+	for _, header := range cors.AllowedHeaders {
+		if !validHeader.MatchString(header) {
+			invalid("cors.allowed_headers", "CORS_ALLOWED_HEADERS", fmt.Sprintf("%q is not a header name", header))
+		}
+	}
+	if cors.MaxAge < 0 {
+		invalid("cors.max_age", "CORS_MAX_AGE", "must not be negative")
+	}
+
+	// The lengths can be lowered, but not raised above the columns of the comments table
+	comments := config.Comments
+	if comments.MaxCommentLength < 1 || comments.MaxCommentLength > filter.DefaultMaxCommentLength {
+		invalid("comments.max_comment_length", "MAX_COMMENT_LENGTH", fmt.Sprintf("must be between 1 and %d", filter.DefaultMaxCommentLength))
+	}
+	if comments.MaxUsernameLength < 1 || comments.MaxUsernameLength > filter.DefaultMaxUsernameLength {
+		invalid("comments.max_username_length", "MAX_USERNAME_LENGTH", fmt.Sprintf("must be between 1 and %d", filter.DefaultMaxUsernameLength))
+	}
+	if comments.MaxReplyDepth < 0 {
+		invalid("comments.max_reply_depth", "MAX_REPLY_DEPTH", "must not be negative")
+	}
+	if comments.EditWindow < 0 {
+		invalid("comments.edit_window", "COMMENT_EDIT_WINDOW", "must not be negative")
+	}
+	if comments.DeletedCommentRetentionDays < 0 {
+		invalid("comments.deleted_comment_retention_days", "DELETED_COMMENT_RETENTION_DAYS", "must not be negative")
+	}
+	if comments.ReportHideThreshold < 0 {
+		invalid("comments.report_hide_threshold", "REPORT_HIDE_THRESHOLD", "must not be negative")
+	}
+	if comments.WordlistAction == filter.Allow {
+		invalid("comments.wordlist_action", "COMMENT_WORDLIST_ACTION", "must be flag, mask or reject")
+	}
+	if comments.LinkAction == filter.Allow {
+		invalid("comments.link_action", "COMMENT_LINK_ACTION", "must be flag, mask or reject")
+	}
+
+	email := config.Email
+	if email.PublicBaseURL != "" {
+		parsed, err := url.Parse(email.PublicBaseURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			invalid("email.public_base_url", "PUBLIC_BASE_URL", fmt.Sprintf("%q must be an http or https URL", email.PublicBaseURL))
+		}
+	}
+	if email.SMTPHost != "" {
+		if email.SMTPPort < 1 || email.SMTPPort > 65535 {
+			invalid("email.smtp_port", "SMTP_PORT", "must be between 1 and 65535")
+		}
+		if _, err := mail.ParseAddress(email.SMTPFrom); err != nil {
+			invalid("email.smtp_from", "SMTP_FROM", "must be an email address to send emails")
+		}
+		if email.PublicBaseURL == "" {
+			invalid("email.public_base_url", "PUBLIC_BASE_URL", "must be set to send emails")
+		}
+	}
+	if email.DigestInterval <= 0 {
+		invalid("email.digest_interval", "DIGEST_INTERVAL", "must be positive")
+	}
+
+	if config.Metrics.Namespace == "" {
+		invalid("metrics.namespace", "METRICS_NAMESPACE", "must be set")
+	}
+
+	return errors.Join(errs...)
+}
+
+// validMethod and validHeader match HTTP method and header names
+var (
+	validMethod = regexp.MustCompile(`^[A-Z]+$`)
+	validHeader = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+)
+
+// isIPOrCIDR reports whether value is an IP address, such as 10.0.0.1, or a CIDR range, such as 10.0.0.0/8.
+func isIPOrCIDR(value string) bool {
+	if strings.Contains(value, "/") {
+		_, _, err := net.ParseCIDR(value)
+		return err == nil
+	}
+	return net.ParseIP(value) != nil
+}
+
+// isOriginPattern reports whether value is a browser origin, a scheme and a host without a path, in which a "*" may
+// stand for any part but a slash. Extension origins such as chrome-extension://<id> are origins too.
+func isOriginPattern(value string) bool {
+	if _, err := path.Match(value, ""); err != nil {
+		return false
+	}
+	parsed, err := url.Parse(strings.ReplaceAll(value, "*", "x"))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return false
+	}
+	return parsed.Path == "" && parsed.RawQuery == "" && parsed.Fragment == "" && parsed.User == nil
+}
@@ -0,0 +1,13 @@
+-- Allow moderators to hide comments without deleting them
+ALTER TABLE comments
+ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Record every action taken through the admin API
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    audit_id UUID PRIMARY KEY,
+    action varchar(50) NOT NULL,
+    target_id varchar(200) NOT NULL,
+    detail varchar(500) NOT NULL DEFAULT '',
+    admin_ip varchar(45) NOT NULL,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS comments_parent_comment_id_idx;
+
+ALTER TABLE comments
+DROP COLUMN parent_comment_id;
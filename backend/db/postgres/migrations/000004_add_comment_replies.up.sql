@@ -0,0 +1,5 @@
+-- Replies point at the comment they answer. Top-level comments have no parent.
+ALTER TABLE comments
+ADD COLUMN parent_comment_id UUID REFERENCES comments (comment_id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS comments_parent_comment_id_idx ON comments (parent_comment_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS comments_listing_id_comment_id_idx;
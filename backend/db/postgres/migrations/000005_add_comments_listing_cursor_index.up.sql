@@ -0,0 +1,2 @@
+-- Comment IDs are V7 UUIDs, so ordering by them within a listing is chronological and can back cursor pagination
+CREATE INDEX IF NOT EXISTS comments_listing_id_comment_id_idx ON comments (listing_id, comment_id);
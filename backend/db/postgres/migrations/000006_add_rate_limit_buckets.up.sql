@@ -0,0 +1,8 @@
+-- Token buckets of the rate limiter, shared by every instance of the API
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    bucket_key varchar(200) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_updated_at_idx ON rate_limit_buckets (updated_at);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS comment_revisions;
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS revision_count,
+DROP COLUMN IF EXISTS edited_at;
@@ -0,0 +1,14 @@
+-- Comments can be edited by their author, keeping every previous version of the text
+ALTER TABLE comments
+ADD COLUMN edited_at TIMESTAMP,
+ADD COLUMN revision_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    revision_id UUID PRIMARY KEY,
+    comment_id UUID NOT NULL REFERENCES comments (comment_id) ON DELETE CASCADE,
+    comment_text varchar(300) NOT NULL,
+    written_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS comment_revisions_comment_id_idx ON comment_revisions (comment_id, revision_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS comments_deleted_at_idx;
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS deleted_by,
+DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,7 @@
+-- Deleted comments are kept as tombstones until the retention job purges them.
+-- deleted_by is either 'author' or 'admin'.
+ALTER TABLE comments
+ADD COLUMN deleted_at TIMESTAMP,
+ADD COLUMN deleted_by varchar(10);
+
+CREATE INDEX IF NOT EXISTS comments_deleted_at_idx ON comments (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS comments_listing_controversy_idx;
+DROP INDEX IF EXISTS comments_listing_score_idx;
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS controversy,
+DROP COLUMN IF EXISTS score,
+DROP COLUMN IF EXISTS downvotes,
+DROP COLUMN IF EXISTS upvotes;
+
+DROP TABLE IF EXISTS comment_votes;
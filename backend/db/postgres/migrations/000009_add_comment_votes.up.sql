@@ -0,0 +1,23 @@
+-- Each user has at most one vote per comment, either 1 or -1.
+CREATE TABLE IF NOT EXISTS comment_votes (
+    comment_id UUID NOT NULL REFERENCES comments (comment_id) ON DELETE CASCADE,
+    user_id varchar(50) NOT NULL,
+    vote SMALLINT NOT NULL CHECK (vote IN (-1, 1)),
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+-- The vote counts are kept on the comments, so that listings can be sorted by score or controversy with an index.
+-- A comment is more controversial the more votes it has and the closer they are to evenly split.
+ALTER TABLE comments
+ADD COLUMN upvotes INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN score INTEGER GENERATED ALWAYS AS (upvotes - downvotes) STORED NOT NULL,
+ADD COLUMN controversy DOUBLE PRECISION GENERATED ALWAYS AS (
+    CASE WHEN upvotes = 0 OR downvotes = 0 THEN 0
+    ELSE (upvotes + downvotes)::double precision * LEAST(upvotes, downvotes) / GREATEST(upvotes, downvotes)
+    END
+) STORED NOT NULL;
+
+CREATE INDEX IF NOT EXISTS comments_listing_score_idx ON comments (listing_id, score, comment_id) WHERE parent_comment_id IS NULL;
+CREATE INDEX IF NOT EXISTS comments_listing_controversy_idx ON comments (listing_id, controversy, comment_id) WHERE parent_comment_id IS NULL;
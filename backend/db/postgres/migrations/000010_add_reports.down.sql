@@ -0,0 +1,4 @@
+ALTER TABLE comments
+DROP COLUMN IF EXISTS hidden_by_reports;
+
+DROP TABLE IF EXISTS reports;
@@ -0,0 +1,20 @@
+-- Users report comments they find abusive. Each user can report a given comment once.
+-- status is 'open' until a moderator resolves or dismisses the report.
+CREATE TABLE IF NOT EXISTS reports (
+    report_id UUID PRIMARY KEY,
+    comment_id UUID NOT NULL REFERENCES comments (comment_id) ON DELETE CASCADE,
+    reporter_id varchar(50) NOT NULL,
+    reason varchar(20) NOT NULL,
+    detail varchar(300) NOT NULL DEFAULT '',
+    status varchar(10) NOT NULL DEFAULT 'open',
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_closed TIMESTAMP,
+    UNIQUE (comment_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS reports_status_idx ON reports (status, report_id);
+
+-- Comments hidden because they were reported too many times, rather than by a moderator. Dismissing the reports
+-- makes them visible again.
+ALTER TABLE comments
+ADD COLUMN hidden_by_reports BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+UPDATE comments
+SET listing_id = substr(listing_id, length('zillow:') + 1)
+WHERE listing_id ~ '^zillow:[0-9]{1,15}$';
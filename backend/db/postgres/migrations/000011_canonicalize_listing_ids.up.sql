@@ -0,0 +1,4 @@
+-- Listings are identified by keys like "zillow:12345". Comments posted before keys existed are on bare Zillow IDs.
+UPDATE comments
+SET listing_id = 'zillow:' || listing_id
+WHERE listing_id ~ '^[0-9]{1,15}$';
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS comments_notify_insert ON comments;
+
+DROP FUNCTION IF EXISTS notify_comment_inserted();
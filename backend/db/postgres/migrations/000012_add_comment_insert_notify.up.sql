@@ -0,0 +1,12 @@
+-- Notify the standalone servers of every new comment, so that they can stream it to the clients following its listing.
+-- Only the IDs are sent: NOTIFY payloads are limited in size, and the servers fetch the comment themselves.
+CREATE OR REPLACE FUNCTION notify_comment_inserted() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('comment_inserted', json_build_object('listing_id', NEW.listing_id, 'comment_id', NEW.comment_id)::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comments_notify_insert
+AFTER INSERT ON comments
+FOR EACH ROW EXECUTE FUNCTION notify_comment_inserted();
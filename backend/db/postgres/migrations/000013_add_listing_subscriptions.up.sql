@@ -0,0 +1,12 @@
+-- Users subscribe to listings to get digests of the comments posted since the last one, by email if they verified one.
+-- last_comment_id is the newest comment the subscriber has been notified of, or when they subscribed.
+CREATE TABLE IF NOT EXISTS listing_subscriptions (
+    listing_id varchar(200) NOT NULL,
+    user_id varchar(50) NOT NULL,
+    email varchar(254) NOT NULL DEFAULT '',
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    last_comment_id UUID NOT NULL,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_notified_at TIMESTAMP,
+    PRIMARY KEY (listing_id, user_id)
+);
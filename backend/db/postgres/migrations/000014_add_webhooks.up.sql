@@ -0,0 +1,43 @@
+-- Webhooks post the events they are registered for (e.g. comment.created) to their target URL, signed with their
+-- secret. A webhook without a listing_id gets the events of every listing.
+CREATE TABLE IF NOT EXISTS webhooks (
+    webhook_id UUID PRIMARY KEY,
+    listing_id varchar(200),
+    target_url varchar(2048) NOT NULL,
+    secret varchar(100) NOT NULL,
+    event_types varchar(50)[] NOT NULL,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_listing_id_idx ON webhooks (listing_id);
+
+-- The outbox: each event is queued once per webhook it goes to, and stays pending until it is delivered or runs out
+-- of attempts. status is 'pending', 'delivered' or 'failed'.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    event_id UUID NOT NULL,
+    webhook_id UUID NOT NULL REFERENCES webhooks (webhook_id) ON DELETE CASCADE,
+    event_type varchar(50) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(10) NOT NULL DEFAULT 'pending',
+    attempt_count INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, webhook_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+-- Every attempt at delivering an event. status_code is NULL if the target didn't respond.
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    event_id UUID NOT NULL,
+    webhook_id UUID NOT NULL,
+    attempt INT NOT NULL,
+    status_code INT,
+    error varchar(500) NOT NULL DEFAULT '',
+    duration_ms INT NOT NULL,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, webhook_id, attempt),
+    FOREIGN KEY (event_id, webhook_id) REFERENCES webhook_deliveries (event_id, webhook_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_webhook_idx ON webhook_delivery_attempts (webhook_id, date_created);
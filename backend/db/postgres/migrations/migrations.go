@@ -0,0 +1,173 @@
+// The migrations package embeds the database migrations in the binary and applies them with golang-migrate.
+//
+// Migrations are the source of truth for the database schema. db/postgres/sqlc/sql/schema.sql, which sqlc reads,
+// must be kept in sync with the state they leave the database in.
+//
+// To create a new migration (from backend folder):
+// migrate create -ext sql -dir db/postgres/migrations -seq <name_of_migration>
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// ErrSchemaBehind is returned by CheckVersion when the database hasn't had every embedded migration applied.
+var ErrSchemaBehind = errors.New("database schema is behind the version this binary expects")
+
+// ErrSchemaDirty is returned by CheckVersion when a migration failed halfway and the database needs fixing by hand.
+var ErrSchemaDirty = errors.New("database schema is dirty")
+
+// Status describes the migration state of a database.
+type Status struct {
+	// Version is the version of the last applied migration, or 0 if none has been applied.
+	Version uint
+	// Dirty is true if the last migration failed halfway.
+	Dirty bool
+	// Expected is the version of the newest migration embedded in the binary.
+	Expected uint
+}
+
+func (status Status) String() string {
+	state := "up to date"
+	switch {
+	case status.Dirty:
+		state = "dirty, fix the database by hand and force the version"
+	case status.Version < status.Expected:
+		state = "migrations pending"
+	case status.Version > status.Expected:
+		state = "ahead of this binary"
+	}
+	return fmt.Sprintf("version %d, expected %d: %s", status.Version, status.Expected, state)
+}
+
+// Up applies every pending migration.
+func Up(connectionString string) error {
+	m, err := newMigrate(connectionString)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	err = m.Up()
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return errors.Join(err, errors.New("failed to apply migrations"))
+	}
+	return nil
+}
+
+// Down rolls back the last applied migration.
+func Down(connectionString string) error {
+	m, err := newMigrate(connectionString)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	err = m.Steps(-1)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to roll back migration"))
+	}
+	return nil
+}
+
+// GetStatus returns the migration state of the database.
+func GetStatus(connectionString string) (*Status, error) {
+	m, err := newMigrate(connectionString)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	expected, err := ExpectedVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return &Status{Expected: expected}, nil
+	}
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to read schema version"))
+	}
+
+	return &Status{Version: version, Dirty: dirty, Expected: expected}, nil
+}
+
+// querier is the part of pgx connections and pools that CheckVersion needs.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// CheckVersion reads the schema version recorded by golang-migrate and fails if the database is dirty
+// or behind the newest embedded migration. It is cheap enough to run on every cold start.
+func CheckVersion(ctx context.Context, db querier) error {
+	expected, err := ExpectedVersion()
+	if err != nil {
+		return err
+	}
+
+	var version int64
+	var dirty bool
+	err = db.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		// A missing table or row means no migration was ever applied
+		return errors.Join(ErrSchemaBehind, fmt.Errorf("failed to read schema version, expected %d", expected), err)
+	}
+
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrSchemaDirty, version)
+	}
+	if version < int64(expected) {
+		return fmt.Errorf("%w: database is at version %d, expected %d", ErrSchemaBehind, version, expected)
+	}
+	return nil
+}
+
+// ExpectedVersion returns the version of the newest migration embedded in the binary.
+func ExpectedVersion() (uint, error) {
+	names, err := fs.Glob(files, "*.up.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var expected uint
+	for _, name := range names {
+		// Migration files are named <version>_<title>.up.sql
+		versionPart, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(versionPart, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration file name %q", name)
+		}
+		expected = max(expected, uint(version))
+	}
+	return expected, nil
+}
+
+// newMigrate returns a golang-migrate instance reading the embedded migrations and applying them to the database.
+func newMigrate(connectionString string) (*migrate.Migrate, error) {
+	source, err := iofs.New(files, ".")
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to read embedded migrations"))
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, connectionString)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to connect to database for migrations"))
+	}
+	return m, nil
+}
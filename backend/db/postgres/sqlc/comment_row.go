@@ -0,0 +1,59 @@
+package sqlc
+
+import "github.com/jackc/pgx/v5/pgtype"
+
+// CommentRow is a comment as the comment queries return it. They all select the same columns, so that the row type
+// sqlc generates for each of them converts to a CommentRow.
+type CommentRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+}
+
+// TopLevelCommentRow is a top-level comment as the paging queries return it: a CommentRow along with the key the
+// query sorts by, which page cursors carry.
+type TopLevelCommentRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+	SortKey         float64
+}
+
+// CommentRow returns the row without its sort key.
+func (row TopLevelCommentRow) CommentRow() CommentRow {
+	return CommentRow{
+		CommentID:       row.CommentID,
+		ListingID:       row.ListingID,
+		UserIp:          row.UserIp,
+		UserID:          row.UserID,
+		Username:        row.Username,
+		CommentText:     row.CommentText,
+		ParentCommentID: row.ParentCommentID,
+		Extract:         row.Extract,
+		EditedAt:        row.EditedAt,
+		RevisionCount:   row.RevisionCount,
+		DeletedAt:       row.DeletedAt,
+		DeletedBy:       row.DeletedBy,
+		Score:           row.Score,
+	}
+}
@@ -2,30 +2,27 @@ package sqlc
 
 //// Using [golang-migrate](https://github.com/golang-migrate/migrate)
 
-// To run migrate commands (from backend folder):
-// migrate -path db/migrations -database "<connection_string>" -verbose <command_to_be_executed>
+// The migrations are embedded in the binary, to run them (from backend folder):
+// go run . migrate up|down|status
 
 // To create a new migration (from backend folder):
-// migrate create -ext sql -dir db/migrations -seq <name_of_migration>
+// migrate create -ext sql -dir db/postgres/migrations -seq <name_of_migration>
+// then mirror the change in sql/schema.sql
 
 //sqlc generate
 //after having modified the query and schema files
 
 import (
 	"context"
-	"os"
 
 	"github.com/jackc/pgx/v5"
 
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
-// returns a queries struct that can be used to execute queries and a
-// function to close the connection linked to it
-func GetConnection() (*pgx.Conn, error) {
-	godotenv.Load()
-	connStr := os.Getenv("CONNECTION_STRING")
+// returns a connection to the database at the given connection string (see config.DatabaseConfig),
+// which New turns into queries
+func GetConnection(connStr string) (*pgx.Conn, error) {
 	conn, err := pgx.Connect(context.Background(), connStr)
 	if err != nil {
 		return nil, err
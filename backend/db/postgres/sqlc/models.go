@@ -8,6 +8,15 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AdminAuditLog struct {
+	AuditID     pgtype.UUID
+	Action      string
+	TargetID    string
+	Detail      string
+	AdminIp     string
+	DateCreated pgtype.Timestamp
+}
+
 type Blacklist struct {
 	BlacklistID pgtype.UUID
 	Cause       string
@@ -18,11 +27,94 @@ type Blacklist struct {
 }
 
 type Comment struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	DateCreated     pgtype.Timestamp
+	Hidden          bool
+	ParentCommentID pgtype.UUID
+	EditedAt        pgtype.Timestamp
+	RevisionCount   int32
+	DeletedAt       pgtype.Timestamp
+	DeletedBy       pgtype.Text
+	Upvotes         int32
+	Downvotes       int32
+	Score           int32
+	Controversy     float64
+	HiddenByReports bool
+}
+
+type CommentRevision struct {
+	RevisionID  pgtype.UUID
 	CommentID   pgtype.UUID
-	ListingID   string
-	UserIp      string
-	UserID      string
-	Username    string
 	CommentText string
+	WrittenAt   pgtype.Timestamp
+	ReplacedAt  pgtype.Timestamp
+}
+
+type CommentVote struct {
+	CommentID   pgtype.UUID
+	UserID      string
+	Vote        int16
+	DateCreated pgtype.Timestamp
+}
+
+type ListingSubscription struct {
+	ListingID      string
+	UserID         string
+	Email          string
+	EmailVerified  bool
+	LastCommentID  pgtype.UUID
+	DateCreated    pgtype.Timestamp
+	LastNotifiedAt pgtype.Timestamp
+}
+
+type Report struct {
+	ReportID    pgtype.UUID
+	CommentID   pgtype.UUID
+	ReporterID  string
+	Reason      string
+	Detail      string
+	Status      string
+	DateCreated pgtype.Timestamp
+	DateClosed  pgtype.Timestamp
+}
+
+type RateLimitBucket struct {
+	BucketKey string
+	Tokens    float64
+	UpdatedAt pgtype.Timestamptz
+}
+
+type Webhook struct {
+	WebhookID   pgtype.UUID
+	ListingID   pgtype.Text
+	TargetUrl   string
+	Secret      string
+	EventTypes  []string
+	DateCreated pgtype.Timestamp
+}
+
+type WebhookDelivery struct {
+	EventID       pgtype.UUID
+	WebhookID     pgtype.UUID
+	EventType     string
+	Payload       []byte
+	Status        string
+	AttemptCount  int32
+	NextAttemptAt pgtype.Timestamp
+	DateCreated   pgtype.Timestamp
+}
+
+type WebhookDeliveryAttempt struct {
+	EventID     pgtype.UUID
+	WebhookID   pgtype.UUID
+	Attempt     int32
+	StatusCode  pgtype.Int4
+	Error       string
+	DurationMs  int32
 	DateCreated pgtype.Timestamp
 }
@@ -11,39 +11,1810 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const getCommentsByListingID = `-- name: GetCommentsByListingID :many
-SELECT comment_id, listing_id, user_ip, user_id, username, comment_text, EXTRACT(EPOCH FROM date_created) FROM comments
-WHERE listing_id = $1
+const checkBlacklistTable = `-- name: CheckBlacklistTable :exec
+SELECT 1 FROM blacklist LIMIT 1
+`
+
+// Fails unless the blacklist table is reachable, for the readiness check.
+func (q *Queries) CheckBlacklistTable(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, checkBlacklistTable)
+	return err
+}
+
+const checkCommentsTable = `-- name: CheckCommentsTable :exec
+SELECT 1 FROM comments LIMIT 1
+`
+
+// Fails unless the comments table is reachable, for the readiness check.
+func (q *Queries) CheckCommentsTable(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, checkCommentsTable)
+	return err
+}
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries d SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1::float8)
+FROM webhooks w
+WHERE w.webhook_id = d.webhook_id AND (d.event_id, d.webhook_id) IN (
+    SELECT p.event_id, p.webhook_id FROM webhook_deliveries p
+    WHERE p.status = 'pending' AND p.next_attempt_at <= CURRENT_TIMESTAMP
+    ORDER BY p.next_attempt_at
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING d.event_id, d.webhook_id, d.event_type, d.payload, d.attempt_count, w.target_url, w.secret
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	LeaseSeconds float64
+	BatchSize    int32
+}
+
+type ClaimWebhookDeliveriesRow struct {
+	EventID      pgtype.UUID
+	WebhookID    pgtype.UUID
+	EventType    string
+	Payload      []byte
+	AttemptCount int32
+	TargetUrl    string
+	Secret       string
+}
+
+// Claims the pending deliveries that are due, oldest first, by pushing their next attempt back by the lease, so that
+// other instances skip them while they are being delivered.
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]ClaimWebhookDeliveriesRow, error) {
+	rows, err := q.db.Query(ctx, claimWebhookDeliveries, arg.LeaseSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimWebhookDeliveriesRow
+	for rows.Next() {
+		var i ClaimWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.EventID,
+			&i.WebhookID,
+			&i.EventType,
+			&i.Payload,
+			&i.AttemptCount,
+			&i.TargetUrl,
+			&i.Secret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const closeCommentReports = `-- name: CloseCommentReports :execrows
+UPDATE reports SET status = $1, date_closed = CURRENT_TIMESTAMP
+WHERE comment_id = $2 AND status = 'open'
+`
+
+type CloseCommentReportsParams struct {
+	Status    string
+	CommentID pgtype.UUID
+}
+
+// Closes every open report on a comment.
+func (q *Queries) CloseCommentReports(ctx context.Context, arg CloseCommentReportsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, closeCommentReports, arg.Status, arg.CommentID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const closeReport = `-- name: CloseReport :one
+UPDATE reports r SET status = $1, date_closed = CURRENT_TIMESTAMP
+FROM comments c
+WHERE r.report_id = $2 AND r.status = 'open' AND c.comment_id = r.comment_id
+RETURNING r.comment_id, r.reporter_id, c.user_id AS author_id
+`
+
+type CloseReportParams struct {
+	Status   string
+	ReportID pgtype.UUID
+}
+
+type CloseReportRow struct {
+	CommentID  pgtype.UUID
+	ReporterID string
+	AuthorID   string
+}
+
+// Closes an open report, returning the reported comment and the IDs of the reporter and of the comment's author.
+func (q *Queries) CloseReport(ctx context.Context, arg CloseReportParams) (CloseReportRow, error) {
+	row := q.db.QueryRow(ctx, closeReport, arg.Status, arg.ReportID)
+	var i CloseReportRow
+	err := row.Scan(
+		&i.CommentID,
+		&i.ReporterID,
+		&i.AuthorID,
+	)
+	return i, err
+}
+
+const createAuditLogEntry = `-- name: CreateAuditLogEntry :exec
+INSERT INTO admin_audit_log (audit_id, action, target_id, detail, admin_ip)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateAuditLogEntryParams struct {
+	AuditID  pgtype.UUID
+	Action   string
+	TargetID string
+	Detail   string
+	AdminIp  string
+}
+
+func (q *Queries) CreateAuditLogEntry(ctx context.Context, arg CreateAuditLogEntryParams) error {
+	_, err := q.db.Exec(ctx, createAuditLogEntry,
+		arg.AuditID,
+		arg.Action,
+		arg.TargetID,
+		arg.Detail,
+		arg.AdminIp,
+	)
+	return err
+}
+
+const createBlacklistEntry = `-- name: CreateBlacklistEntry :one
+INSERT INTO blacklist (blacklist_id, cause, user_ip, user_id, username)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING blacklist_id, cause, user_ip, user_id, username, date_created
+`
+
+type CreateBlacklistEntryParams struct {
+	BlacklistID pgtype.UUID
+	Cause       string
+	UserIp      string
+	UserID      pgtype.Text
+	Username    pgtype.Text
+}
+
+func (q *Queries) CreateBlacklistEntry(ctx context.Context, arg CreateBlacklistEntryParams) (Blacklist, error) {
+	row := q.db.QueryRow(ctx, createBlacklistEntry,
+		arg.BlacklistID,
+		arg.Cause,
+		arg.UserIp,
+		arg.UserID,
+		arg.Username,
+	)
+	var i Blacklist
+	err := row.Scan(
+		&i.BlacklistID,
+		&i.Cause,
+		&i.UserIp,
+		&i.UserID,
+		&i.Username,
+		&i.DateCreated,
+	)
+	return i, err
+}
+
+const createRateLimitBucket = `-- name: CreateRateLimitBucket :exec
+INSERT INTO rate_limit_buckets (bucket_key, tokens, updated_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (bucket_key) DO NOTHING
+`
+
+type CreateRateLimitBucketParams struct {
+	BucketKey string
+	Tokens    float64
+	UpdatedAt pgtype.Timestamptz
+}
+
+func (q *Queries) CreateRateLimitBucket(ctx context.Context, arg CreateRateLimitBucketParams) error {
+	_, err := q.db.Exec(ctx, createRateLimitBucket, arg.BucketKey, arg.Tokens, arg.UpdatedAt)
+	return err
+}
+
+const createReport = `-- name: CreateReport :one
+INSERT INTO reports (report_id, comment_id, reporter_id, reason, detail)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (comment_id, reporter_id) DO NOTHING
+RETURNING report_id, comment_id, reporter_id, reason, detail, status, date_created, date_closed
+`
+
+type CreateReportParams struct {
+	ReportID   pgtype.UUID
+	CommentID  pgtype.UUID
+	ReporterID string
+	Reason     string
+	Detail     string
+}
+
+// Returns no row if the reporter already reported the comment.
+func (q *Queries) CreateReport(ctx context.Context, arg CreateReportParams) (Report, error) {
+	row := q.db.QueryRow(ctx, createReport,
+		arg.ReportID,
+		arg.CommentID,
+		arg.ReporterID,
+		arg.Reason,
+		arg.Detail,
+	)
+	var i Report
+	err := row.Scan(
+		&i.ReportID,
+		&i.CommentID,
+		&i.ReporterID,
+		&i.Reason,
+		&i.Detail,
+		&i.Status,
+		&i.DateCreated,
+		&i.DateClosed,
+	)
+	return i, err
+}
+
+const createWebhook = `-- name: CreateWebhook :one
+INSERT INTO webhooks (webhook_id, listing_id, target_url, secret, event_types)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING webhook_id, listing_id, target_url, secret, event_types, date_created
+`
+
+type CreateWebhookParams struct {
+	WebhookID  pgtype.UUID
+	ListingID  pgtype.Text
+	TargetUrl  string
+	Secret     string
+	EventTypes []string
+}
+
+func (q *Queries) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	row := q.db.QueryRow(ctx, createWebhook,
+		arg.WebhookID,
+		arg.ListingID,
+		arg.TargetUrl,
+		arg.Secret,
+		arg.EventTypes,
+	)
+	var i Webhook
+	err := row.Scan(
+		&i.WebhookID,
+		&i.ListingID,
+		&i.TargetUrl,
+		&i.Secret,
+		&i.EventTypes,
+		&i.DateCreated,
+	)
+	return i, err
+}
+
+const createWebhookAttempt = `-- name: CreateWebhookAttempt :exec
+INSERT INTO webhook_delivery_attempts (event_id, webhook_id, attempt, status_code, error, duration_ms)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type CreateWebhookAttemptParams struct {
+	EventID    pgtype.UUID
+	WebhookID  pgtype.UUID
+	Attempt    int32
+	StatusCode pgtype.Int4
+	Error      string
+	DurationMs int32
+}
+
+func (q *Queries) CreateWebhookAttempt(ctx context.Context, arg CreateWebhookAttemptParams) error {
+	_, err := q.db.Exec(ctx, createWebhookAttempt,
+		arg.EventID,
+		arg.WebhookID,
+		arg.Attempt,
+		arg.StatusCode,
+		arg.Error,
+		arg.DurationMs,
+	)
+	return err
+}
+
+const deleteBlacklistEntry = `-- name: DeleteBlacklistEntry :execrows
+DELETE FROM blacklist
+WHERE blacklist_id = $1
+`
+
+func (q *Queries) DeleteBlacklistEntry(ctx context.Context, blacklistID pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteBlacklistEntry, blacklistID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteCommentVote = `-- name: DeleteCommentVote :exec
+DELETE FROM comment_votes
+WHERE comment_id = $1 AND user_id = $2
+`
+
+type DeleteCommentVoteParams struct {
+	CommentID pgtype.UUID
+	UserID    string
+}
+
+func (q *Queries) DeleteCommentVote(ctx context.Context, arg DeleteCommentVoteParams) error {
+	_, err := q.db.Exec(ctx, deleteCommentVote, arg.CommentID, arg.UserID)
+	return err
+}
+
+const deleteFinishedWebhookDeliveries = `-- name: DeleteFinishedWebhookDeliveries :execrows
+DELETE FROM webhook_deliveries
+WHERE status <> 'pending' AND date_created < $1
+`
+
+// Deletes the deliveries that were delivered or gave up before the given time, along with their attempts.
+func (q *Queries) DeleteFinishedWebhookDeliveries(ctx context.Context, dateCreated pgtype.Timestamp) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteFinishedWebhookDeliveries, dateCreated)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteRevisionsOfDeletedComments = `-- name: DeleteRevisionsOfDeletedComments :execrows
+DELETE FROM comment_revisions cr
+USING comments c
+WHERE cr.comment_id = c.comment_id AND c.deleted_at < $1
+`
+
+func (q *Queries) DeleteRevisionsOfDeletedComments(ctx context.Context, deletedAt pgtype.Timestamp) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteRevisionsOfDeletedComments, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteStaleRateLimitBuckets = `-- name: DeleteStaleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1
+`
+
+func (q *Queries) DeleteStaleRateLimitBuckets(ctx context.Context, updatedAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteStaleRateLimitBuckets, updatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteSubscription = `-- name: DeleteSubscription :execrows
+DELETE FROM listing_subscriptions
+WHERE listing_id = $1 AND user_id = $2
+`
+
+type DeleteSubscriptionParams struct {
+	ListingID string
+	UserID    string
+}
+
+func (q *Queries) DeleteSubscription(ctx context.Context, arg DeleteSubscriptionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteSubscription, arg.ListingID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteWebhook = `-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE webhook_id = $1
+`
+
+func (q *Queries) DeleteWebhook(ctx context.Context, webhookID pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWebhook, webhookID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const editComment = `-- name: EditComment :one
+WITH previous AS (
+    SELECT comment_id, comment_text, COALESCE(edited_at, date_created) AS written_at FROM comments
+    WHERE comment_id = $1 AND deleted_at IS NULL
+      AND date_created > CURRENT_TIMESTAMP - make_interval(secs => $2::float8)
+    FOR UPDATE
+), revision AS (
+    INSERT INTO comment_revisions (revision_id, comment_id, comment_text, written_at)
+    SELECT $3, comment_id, comment_text, written_at FROM previous
+    WHERE comment_text <> $4
+)
+UPDATE comments c SET comment_text = $4,
+    edited_at = CASE WHEN p.comment_text = $4 THEN c.edited_at ELSE CURRENT_TIMESTAMP END,
+    revision_count = c.revision_count + CASE WHEN p.comment_text = $4 THEN 0 ELSE 1 END
+FROM previous p
+WHERE c.comment_id = p.comment_id
+RETURNING c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score
+`
+
+type EditCommentParams struct {
+	CommentID         pgtype.UUID
+	EditWindowSeconds float64
+	RevisionID        pgtype.UUID
+	CommentText       string
+}
+
+type EditCommentRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+}
+
+// Replaces the text of a comment posted within the edit window, keeping the previous text as a revision. The comment
+// is locked first, so that concurrent edits each keep the text they replace. Deleted comments and comments past the
+// window are left alone, without a revision, and so is an unchanged text, which returns the comment as it is.
+func (q *Queries) EditComment(ctx context.Context, arg EditCommentParams) (EditCommentRow, error) {
+	row := q.db.QueryRow(ctx, editComment,
+		arg.CommentID,
+		arg.EditWindowSeconds,
+		arg.RevisionID,
+		arg.CommentText,
+	)
+	var i EditCommentRow
+	err := row.Scan(
+		&i.CommentID,
+		&i.ListingID,
+		&i.UserIp,
+		&i.UserID,
+		&i.Username,
+		&i.CommentText,
+		&i.ParentCommentID,
+		&i.Extract,
+		&i.EditedAt,
+		&i.RevisionCount,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.Score,
+	)
+	return i, err
+}
+
+const enqueueWebhookEvent = `-- name: EnqueueWebhookEvent :execrows
+INSERT INTO webhook_deliveries (event_id, webhook_id, event_type, payload)
+SELECT $1::uuid, w.webhook_id, $2::varchar, $3::jsonb FROM webhooks w
+WHERE (w.listing_id IS NULL OR w.listing_id = $4::varchar) AND $2::varchar = ANY(w.event_types)
+`
+
+type EnqueueWebhookEventParams struct {
+	EventID   pgtype.UUID
+	EventType string
+	Payload   []byte
+	ListingID string
+}
+
+// Queues an event for every webhook registered for its type, on its listing or on every listing.
+func (q *Queries) EnqueueWebhookEvent(ctx context.Context, arg EnqueueWebhookEventParams) (int64, error) {
+	result, err := q.db.Exec(ctx, enqueueWebhookEvent,
+		arg.EventID,
+		arg.EventType,
+		arg.Payload,
+		arg.ListingID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getBlacklistMatch = `-- name: GetBlacklistMatch :one
+SELECT blacklist_id, cause, user_ip, user_id, username, date_created FROM blacklist
+WHERE (user_ip <> '' AND user_ip = $1)
+OR user_id = $2
+OR lower(username) = lower($3::text)
+ORDER BY date_created DESC
+LIMIT 1
+`
+
+type GetBlacklistMatchParams struct {
+	UserIp   string
+	UserID   pgtype.Text
+	Username pgtype.Text
+}
+
+// Returns the newest blacklist entry matching the IP, user ID or username. Usernames match whatever their case.
+func (q *Queries) GetBlacklistMatch(ctx context.Context, arg GetBlacklistMatchParams) (Blacklist, error) {
+	row := q.db.QueryRow(ctx, getBlacklistMatch, arg.UserIp, arg.UserID, arg.Username)
+	var i Blacklist
+	err := row.Scan(
+		&i.BlacklistID,
+		&i.Cause,
+		&i.UserIp,
+		&i.UserID,
+		&i.Username,
+		&i.DateCreated,
+	)
+	return i, err
+}
+
+const getComment = `-- name: GetComment :one
+SELECT comment_id, listing_id, user_ip, user_id, username, comment_text, parent_comment_id, EXTRACT(EPOCH FROM date_created), EXTRACT(EPOCH FROM edited_at) AS edited_at, revision_count, EXTRACT(EPOCH FROM deleted_at) AS deleted_at, deleted_by, score FROM comments
+WHERE comment_id = $1 AND NOT hidden AND deleted_at IS NULL
+`
+
+type GetCommentRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+}
+
+func (q *Queries) GetComment(ctx context.Context, commentID pgtype.UUID) (GetCommentRow, error) {
+	row := q.db.QueryRow(ctx, getComment, commentID)
+	var i GetCommentRow
+	err := row.Scan(
+		&i.CommentID,
+		&i.ListingID,
+		&i.UserIp,
+		&i.UserID,
+		&i.Username,
+		&i.CommentText,
+		&i.ParentCommentID,
+		&i.Extract,
+		&i.EditedAt,
+		&i.RevisionCount,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.Score,
+	)
+	return i, err
+}
+
+const getCommentReplies = `-- name: GetCommentReplies :many
+WITH RECURSIVE replies AS (
+    SELECT comment_id, listing_id, user_ip, user_id, username, comment_text, parent_comment_id, date_created, edited_at, revision_count, deleted_at, deleted_by, score FROM comments
+    WHERE parent_comment_id = ANY($1::uuid[]) AND NOT hidden
+    UNION ALL
+    SELECT r.comment_id, r.listing_id, r.user_ip, r.user_id, r.username, r.comment_text, r.parent_comment_id, r.date_created, r.edited_at, r.revision_count, r.deleted_at, r.deleted_by, r.score FROM comments r
+    JOIN replies p ON r.parent_comment_id = p.comment_id
+    WHERE NOT r.hidden
+)
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score FROM replies c
+WHERE NOT $2::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+)
+ORDER BY c.comment_id DESC
+`
+
+type GetCommentRepliesParams struct {
+	ThreadIds       []pgtype.UUID
+	HideBlacklisted bool
+}
+
+type GetCommentRepliesRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+}
+
+// Returns every reply below the given top-level comments, newest first.
+func (q *Queries) GetCommentReplies(ctx context.Context, arg GetCommentRepliesParams) ([]GetCommentRepliesRow, error) {
+	rows, err := q.db.Query(ctx, getCommentReplies, arg.ThreadIds, arg.HideBlacklisted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCommentRepliesRow
+	for rows.Next() {
+		var i GetCommentRepliesRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.ListingID,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.CommentText,
+			&i.ParentCommentID,
+			&i.Extract,
+			&i.EditedAt,
+			&i.RevisionCount,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.Score,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCommentRevisions = `-- name: GetCommentRevisions :many
+SELECT revision_id, comment_text, EXTRACT(EPOCH FROM written_at) AS written_at, EXTRACT(EPOCH FROM replaced_at) AS replaced_at FROM comment_revisions
+WHERE comment_id = $1
+ORDER BY revision_id ASC
+`
+
+type GetCommentRevisionsRow struct {
+	RevisionID  pgtype.UUID
+	CommentText string
+	WrittenAt   pgtype.Numeric
+	ReplacedAt  pgtype.Numeric
+}
+
+// Returns the previous versions of a comment's text, oldest first.
+func (q *Queries) GetCommentRevisions(ctx context.Context, commentID pgtype.UUID) ([]GetCommentRevisionsRow, error) {
+	rows, err := q.db.Query(ctx, getCommentRevisions, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCommentRevisionsRow
+	for rows.Next() {
+		var i GetCommentRevisionsRow
+		if err := rows.Scan(
+			&i.RevisionID,
+			&i.CommentText,
+			&i.WrittenAt,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCommentThreadInfo = `-- name: GetCommentThreadInfo :one
+WITH RECURSIVE ancestors AS (
+    SELECT comment_id, parent_comment_id, listing_id, 0 AS depth, deleted_at IS NOT NULL AS deleted, hidden FROM comments
+    WHERE comment_id = $1
+    UNION ALL
+    SELECT c.comment_id, c.parent_comment_id, a.listing_id, a.depth + 1, a.deleted, c.hidden FROM comments c
+    JOIN ancestors a ON c.comment_id = a.parent_comment_id
+)
+SELECT listing_id, MAX(depth)::int AS depth, bool_and(deleted)::boolean AS deleted FROM ancestors
+GROUP BY listing_id
+HAVING NOT bool_or(hidden)
+`
+
+type GetCommentThreadInfoRow struct {
+	ListingID string
+	Depth     int32
+	Deleted   bool
+}
+
+// Returns the listing of a comment, its depth in its thread (0 for top-level comments), and whether it was deleted.
+// Hidden comments, and the ones below them, aren't returned, since they aren't shown.
+func (q *Queries) GetCommentThreadInfo(ctx context.Context, commentID pgtype.UUID) (GetCommentThreadInfoRow, error) {
+	row := q.db.QueryRow(ctx, getCommentThreadInfo, commentID)
+	var i GetCommentThreadInfoRow
+	err := row.Scan(
+		&i.ListingID,
+		&i.Depth,
+		&i.Deleted,
+	)
+	return i, err
+}
+
+const getListingCommentCounts = `-- name: GetListingCommentCounts :many
+SELECT c.listing_id, COUNT(*) AS comment_count, MAX(EXTRACT(EPOCH FROM c.date_created))::numeric AS latest_comment FROM comments c
+WHERE c.listing_id = ANY($1::varchar[]) AND NOT c.hidden AND c.deleted_at IS NULL
+AND (NOT $2::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+GROUP BY c.listing_id
+`
+
+type GetListingCommentCountsParams struct {
+	ListingIds      []string
+	HideBlacklisted bool
+}
+
+type GetListingCommentCountsRow struct {
+	ListingID     string
+	CommentCount  int64
+	LatestComment pgtype.Numeric
+}
+
+// Counts the visible comments, replies included, on each of the listings that has any, along with when the latest one was posted.
+func (q *Queries) GetListingCommentCounts(ctx context.Context, arg GetListingCommentCountsParams) ([]GetListingCommentCountsRow, error) {
+	rows, err := q.db.Query(ctx, getListingCommentCounts, arg.ListingIds, arg.HideBlacklisted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetListingCommentCountsRow
+	for rows.Next() {
+		var i GetListingCommentCountsRow
+		if err := rows.Scan(
+			&i.ListingID,
+			&i.CommentCount,
+			&i.LatestComment,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getListingCommentsSince = `-- name: GetListingCommentsSince :many
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score FROM comments c
+WHERE c.listing_id = $1 AND c.comment_id > $2::uuid AND NOT c.hidden AND c.deleted_at IS NULL
+AND (NOT $3::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.comment_id
+LIMIT $4
+`
+
+type GetListingCommentsSinceParams struct {
+	ListingID       string
+	Since           pgtype.UUID
+	HideBlacklisted bool
+	PageSize        int32
+}
+
+type GetListingCommentsSinceRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+}
+
+// Returns the visible comments on a listing, replies included, posted after the given one, oldest first.
+func (q *Queries) GetListingCommentsSince(ctx context.Context, arg GetListingCommentsSinceParams) ([]GetListingCommentsSinceRow, error) {
+	rows, err := q.db.Query(ctx, getListingCommentsSince,
+		arg.ListingID,
+		arg.Since,
+		arg.HideBlacklisted,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetListingCommentsSinceRow
+	for rows.Next() {
+		var i GetListingCommentsSinceRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.ListingID,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.CommentText,
+			&i.ParentCommentID,
+			&i.Extract,
+			&i.EditedAt,
+			&i.RevisionCount,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.Score,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPendingSubscriptions = `-- name: GetPendingSubscriptions :many
+SELECT s.listing_id, s.user_id, s.email, s.email_verified, s.last_comment_id, EXTRACT(EPOCH FROM s.date_created) FROM listing_subscriptions s
+WHERE (s.listing_id, s.user_id) > ($1::varchar, $2::varchar)
+AND EXISTS (
+    SELECT 1 FROM comments c
+    WHERE c.listing_id = s.listing_id AND c.comment_id > s.last_comment_id AND c.user_id <> s.user_id
+    AND NOT c.hidden AND c.deleted_at IS NULL
+    AND (NOT $3::boolean OR NOT EXISTS (
+        SELECT 1 FROM blacklist b
+        WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+        OR b.user_id = c.user_id
+        OR lower(b.username) = lower(c.username)
+    ))
+)
+ORDER BY s.listing_id, s.user_id
+LIMIT $4
+`
+
+type GetPendingSubscriptionsParams struct {
+	AfterListingID  string
+	AfterUserID     string
+	HideBlacklisted bool
+	PageSize        int32
+}
+
+type GetPendingSubscriptionsRow struct {
+	ListingID     string
+	UserID        string
+	Email         string
+	EmailVerified bool
+	LastCommentID pgtype.UUID
+	Extract       pgtype.Numeric
+}
+
+// Returns the subscriptions to listings with visible comments by others than the subscriber since they were last
+// notified, in key order after the given one. Comments by blacklisted authors don't count when they are hidden, like
+// GetListingCommentsSince leaves them out.
+func (q *Queries) GetPendingSubscriptions(ctx context.Context, arg GetPendingSubscriptionsParams) ([]GetPendingSubscriptionsRow, error) {
+	rows, err := q.db.Query(ctx, getPendingSubscriptions,
+		arg.AfterListingID,
+		arg.AfterUserID,
+		arg.HideBlacklisted,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPendingSubscriptionsRow
+	for rows.Next() {
+		var i GetPendingSubscriptionsRow
+		if err := rows.Scan(
+			&i.ListingID,
+			&i.UserID,
+			&i.Email,
+			&i.EmailVerified,
+			&i.LastCommentID,
+			&i.Extract,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRateLimitBucketForUpdate = `-- name: GetRateLimitBucketForUpdate :one
+SELECT bucket_key, tokens, updated_at FROM rate_limit_buckets
+WHERE bucket_key = $1
+FOR UPDATE
+`
+
+// Locks the bucket until the end of the transaction, so that concurrent requests take tokens one after the other.
+func (q *Queries) GetRateLimitBucketForUpdate(ctx context.Context, bucketKey string) (RateLimitBucket, error) {
+	row := q.db.QueryRow(ctx, getRateLimitBucketForUpdate, bucketKey)
+	var i RateLimitBucket
+	err := row.Scan(
+		&i.BucketKey,
+		&i.Tokens,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getRecentComments = `-- name: GetRecentComments :many
+SELECT comment_id, listing_id, user_ip, user_id, username, comment_text, hidden, deleted_at IS NOT NULL AS deleted, EXTRACT(EPOCH FROM date_created) FROM comments
+ORDER BY date_created DESC
+LIMIT $1
+`
+
+type GetRecentCommentsRow struct {
+	CommentID   pgtype.UUID
+	ListingID   string
+	UserIp      string
+	UserID      string
+	Username    string
+	CommentText string
+	Hidden      bool
+	Deleted     bool
+	Extract     pgtype.Numeric
+}
+
+func (q *Queries) GetRecentComments(ctx context.Context, limit int32) ([]GetRecentCommentsRow, error) {
+	rows, err := q.db.Query(ctx, getRecentComments, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecentCommentsRow
+	for rows.Next() {
+		var i GetRecentCommentsRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.ListingID,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.CommentText,
+			&i.Hidden,
+			&i.Deleted,
+			&i.Extract,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReportByReporter = `-- name: GetReportByReporter :one
+SELECT report_id, comment_id, reporter_id, reason, detail, status, date_created, date_closed FROM reports
+WHERE comment_id = $1 AND reporter_id = $2
+`
+
+type GetReportByReporterParams struct {
+	CommentID  pgtype.UUID
+	ReporterID string
+}
+
+func (q *Queries) GetReportByReporter(ctx context.Context, arg GetReportByReporterParams) (Report, error) {
+	row := q.db.QueryRow(ctx, getReportByReporter, arg.CommentID, arg.ReporterID)
+	var i Report
+	err := row.Scan(
+		&i.ReportID,
+		&i.CommentID,
+		&i.ReporterID,
+		&i.Reason,
+		&i.Detail,
+		&i.Status,
+		&i.DateCreated,
+		&i.DateClosed,
+	)
+	return i, err
+}
+
+const getSubscription = `-- name: GetSubscription :one
+SELECT listing_id, user_id, email, email_verified, last_comment_id, EXTRACT(EPOCH FROM date_created) FROM listing_subscriptions
+WHERE listing_id = $1 AND user_id = $2
+`
+
+type GetSubscriptionParams struct {
+	ListingID string
+	UserID    string
+}
+
+type GetSubscriptionRow struct {
+	ListingID     string
+	UserID        string
+	Email         string
+	EmailVerified bool
+	LastCommentID pgtype.UUID
+	Extract       pgtype.Numeric
+}
+
+func (q *Queries) GetSubscription(ctx context.Context, arg GetSubscriptionParams) (GetSubscriptionRow, error) {
+	row := q.db.QueryRow(ctx, getSubscription, arg.ListingID, arg.UserID)
+	var i GetSubscriptionRow
+	err := row.Scan(
+		&i.ListingID,
+		&i.UserID,
+		&i.Email,
+		&i.EmailVerified,
+		&i.LastCommentID,
+		&i.Extract,
+	)
+	return i, err
+}
+
+const getTopLevelCommentsAfter = `-- name: GetTopLevelCommentsAfter :many
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, 0::double precision AS sort_key FROM comments c
+WHERE c.listing_id = $1 AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND c.comment_id > $2::uuid
+AND (NOT $3::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.comment_id ASC
+LIMIT $4
+`
+
+type GetTopLevelCommentsAfterParams struct {
+	ListingID       string
+	After           pgtype.UUID
+	HideBlacklisted bool
+	PageSize        int32
+}
+
+type GetTopLevelCommentsAfterRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+	SortKey         float64
+}
+
+// Returns a page of top-level comments on a listing, oldest first, newer than the cursor.
+// Comment IDs sort by date, so the sort key is unused.
+func (q *Queries) GetTopLevelCommentsAfter(ctx context.Context, arg GetTopLevelCommentsAfterParams) ([]GetTopLevelCommentsAfterRow, error) {
+	rows, err := q.db.Query(ctx, getTopLevelCommentsAfter,
+		arg.ListingID,
+		arg.After,
+		arg.HideBlacklisted,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopLevelCommentsAfterRow
+	for rows.Next() {
+		var i GetTopLevelCommentsAfterRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.ListingID,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.CommentText,
+			&i.ParentCommentID,
+			&i.Extract,
+			&i.EditedAt,
+			&i.RevisionCount,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.Score,
+			&i.SortKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTopLevelCommentsBefore = `-- name: GetTopLevelCommentsBefore :many
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, 0::double precision AS sort_key FROM comments c
+WHERE c.listing_id = $1 AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND ($2::uuid IS NULL OR c.comment_id < $2::uuid)
+AND (NOT $3::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.comment_id DESC
+LIMIT $4
+`
+
+type GetTopLevelCommentsBeforeParams struct {
+	ListingID       string
+	Before          pgtype.UUID
+	HideBlacklisted bool
+	PageSize        int32
+}
+
+type GetTopLevelCommentsBeforeRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+	SortKey         float64
+}
+
+// Returns a page of top-level comments on a listing, newest first, older than the optional cursor.
+// Comment IDs sort by date, so the sort key is unused.
+func (q *Queries) GetTopLevelCommentsBefore(ctx context.Context, arg GetTopLevelCommentsBeforeParams) ([]GetTopLevelCommentsBeforeRow, error) {
+	rows, err := q.db.Query(ctx, getTopLevelCommentsBefore,
+		arg.ListingID,
+		arg.Before,
+		arg.HideBlacklisted,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopLevelCommentsBeforeRow
+	for rows.Next() {
+		var i GetTopLevelCommentsBeforeRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.ListingID,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.CommentText,
+			&i.ParentCommentID,
+			&i.Extract,
+			&i.EditedAt,
+			&i.RevisionCount,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.Score,
+			&i.SortKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTopLevelCommentsByControversyAfter = `-- name: GetTopLevelCommentsByControversyAfter :many
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, c.controversy AS sort_key FROM comments c
+WHERE c.listing_id = $1 AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND (c.controversy, c.comment_id) > ($2::double precision, $3::uuid)
+AND (NOT $4::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.controversy ASC, c.comment_id ASC
+LIMIT $5
+`
+
+type GetTopLevelCommentsByControversyAfterParams struct {
+	ListingID        string
+	AfterControversy float64
+	After            pgtype.UUID
+	HideBlacklisted  bool
+	PageSize         int32
+}
+
+type GetTopLevelCommentsByControversyAfterRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+	SortKey         float64
+}
+
+// Returns a page of top-level comments on a listing, in reverse order (most controversial last), before the cursor in that order.
+// The cursor holds the controversy its comment had when it was taken, so that votes since don't move it.
+func (q *Queries) GetTopLevelCommentsByControversyAfter(ctx context.Context, arg GetTopLevelCommentsByControversyAfterParams) ([]GetTopLevelCommentsByControversyAfterRow, error) {
+	rows, err := q.db.Query(ctx, getTopLevelCommentsByControversyAfter,
+		arg.ListingID,
+		arg.AfterControversy,
+		arg.After,
+		arg.HideBlacklisted,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopLevelCommentsByControversyAfterRow
+	for rows.Next() {
+		var i GetTopLevelCommentsByControversyAfterRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.ListingID,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.CommentText,
+			&i.ParentCommentID,
+			&i.Extract,
+			&i.EditedAt,
+			&i.RevisionCount,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.Score,
+			&i.SortKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTopLevelCommentsByControversyBefore = `-- name: GetTopLevelCommentsByControversyBefore :many
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, c.controversy AS sort_key FROM comments c
+WHERE c.listing_id = $1 AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND ($2::uuid IS NULL OR (c.controversy, c.comment_id) < ($3::double precision, $2::uuid))
+AND (NOT $4::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.controversy DESC, c.comment_id DESC
+LIMIT $5
+`
+
+type GetTopLevelCommentsByControversyBeforeParams struct {
+	ListingID         string
+	Before            pgtype.UUID
+	BeforeControversy pgtype.Float8
+	HideBlacklisted   bool
+	PageSize          int32
+}
+
+type GetTopLevelCommentsByControversyBeforeRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+	SortKey         float64
+}
+
+// Returns a page of top-level comments on a listing, most controversial first, after the optional cursor in that order.
+// The cursor holds the controversy its comment had when it was taken, so that votes since don't move it.
+func (q *Queries) GetTopLevelCommentsByControversyBefore(ctx context.Context, arg GetTopLevelCommentsByControversyBeforeParams) ([]GetTopLevelCommentsByControversyBeforeRow, error) {
+	rows, err := q.db.Query(ctx, getTopLevelCommentsByControversyBefore,
+		arg.ListingID,
+		arg.Before,
+		arg.BeforeControversy,
+		arg.HideBlacklisted,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopLevelCommentsByControversyBeforeRow
+	for rows.Next() {
+		var i GetTopLevelCommentsByControversyBeforeRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.ListingID,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.CommentText,
+			&i.ParentCommentID,
+			&i.Extract,
+			&i.EditedAt,
+			&i.RevisionCount,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.Score,
+			&i.SortKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTopLevelCommentsByScoreAfter = `-- name: GetTopLevelCommentsByScoreAfter :many
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, c.score::double precision AS sort_key FROM comments c
+WHERE c.listing_id = $1 AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND (c.score, c.comment_id) > ($2::int, $3::uuid)
+AND (NOT $4::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.score ASC, c.comment_id ASC
+LIMIT $5
+`
+
+type GetTopLevelCommentsByScoreAfterParams struct {
+	ListingID       string
+	AfterScore      int32
+	After           pgtype.UUID
+	HideBlacklisted bool
+	PageSize        int32
+}
+
+type GetTopLevelCommentsByScoreAfterRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+	SortKey         float64
+}
+
+// Returns a page of top-level comments on a listing, in reverse order (highest score last), before the cursor in that order.
+// The cursor holds the score its comment had when it was taken, so that votes since don't move it.
+func (q *Queries) GetTopLevelCommentsByScoreAfter(ctx context.Context, arg GetTopLevelCommentsByScoreAfterParams) ([]GetTopLevelCommentsByScoreAfterRow, error) {
+	rows, err := q.db.Query(ctx, getTopLevelCommentsByScoreAfter,
+		arg.ListingID,
+		arg.AfterScore,
+		arg.After,
+		arg.HideBlacklisted,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopLevelCommentsByScoreAfterRow
+	for rows.Next() {
+		var i GetTopLevelCommentsByScoreAfterRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.ListingID,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.CommentText,
+			&i.ParentCommentID,
+			&i.Extract,
+			&i.EditedAt,
+			&i.RevisionCount,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.Score,
+			&i.SortKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTopLevelCommentsByScoreBefore = `-- name: GetTopLevelCommentsByScoreBefore :many
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, c.score::double precision AS sort_key FROM comments c
+WHERE c.listing_id = $1 AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND ($2::uuid IS NULL OR (c.score, c.comment_id) < ($3::int, $2::uuid))
+AND (NOT $4::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.score DESC, c.comment_id DESC
+LIMIT $5
+`
+
+type GetTopLevelCommentsByScoreBeforeParams struct {
+	ListingID       string
+	Before          pgtype.UUID
+	BeforeScore     pgtype.Int4
+	HideBlacklisted bool
+	PageSize        int32
+}
+
+type GetTopLevelCommentsByScoreBeforeRow struct {
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
+	SortKey         float64
+}
+
+// Returns a page of top-level comments on a listing, highest score first, after the optional cursor in that order.
+// The cursor holds the score its comment had when it was taken, so that votes since don't move it.
+func (q *Queries) GetTopLevelCommentsByScoreBefore(ctx context.Context, arg GetTopLevelCommentsByScoreBeforeParams) ([]GetTopLevelCommentsByScoreBeforeRow, error) {
+	rows, err := q.db.Query(ctx, getTopLevelCommentsByScoreBefore,
+		arg.ListingID,
+		arg.Before,
+		arg.BeforeScore,
+		arg.HideBlacklisted,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopLevelCommentsByScoreBeforeRow
+	for rows.Next() {
+		var i GetTopLevelCommentsByScoreBeforeRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.ListingID,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.CommentText,
+			&i.ParentCommentID,
+			&i.Extract,
+			&i.EditedAt,
+			&i.RevisionCount,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.Score,
+			&i.SortKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserVotes = `-- name: GetUserVotes :many
+SELECT comment_id, vote FROM comment_votes
+WHERE user_id = $1 AND comment_id = ANY($2::uuid[])
+`
+
+type GetUserVotesParams struct {
+	UserID     string
+	CommentIds []pgtype.UUID
+}
+
+type GetUserVotesRow struct {
+	CommentID pgtype.UUID
+	Vote      int16
+}
+
+func (q *Queries) GetUserVotes(ctx context.Context, arg GetUserVotesParams) ([]GetUserVotesRow, error) {
+	rows, err := q.db.Query(ctx, getUserVotes, arg.UserID, arg.CommentIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserVotesRow
+	for rows.Next() {
+		var i GetUserVotesRow
+		if err := rows.Scan(
+			&i.CommentID,
+			&i.Vote,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hideReportedComment = `-- name: HideReportedComment :execrows
+UPDATE comments SET hidden = TRUE, hidden_by_reports = TRUE
+WHERE comment_id = $1 AND NOT hidden
+AND (SELECT COUNT(*) FROM reports r WHERE r.comment_id = $1 AND r.status = 'open' AND r.reporter_id <> 'filter') >= $2::bigint
+`
+
+type HideReportedCommentParams struct {
+	CommentID     pgtype.UUID
+	HideThreshold int64
+}
+
+// Hides a comment once it has at least hide_threshold open reports from users, unless it is already hidden. The
+// reports of the comment filters don't count.
+func (q *Queries) HideReportedComment(ctx context.Context, arg HideReportedCommentParams) (int64, error) {
+	result, err := q.db.Exec(ctx, hideReportedComment, arg.CommentID, arg.HideThreshold)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const listAuditLog = `-- name: ListAuditLog :many
+SELECT audit_id, action, target_id, detail, admin_ip, date_created FROM admin_audit_log
+ORDER BY date_created DESC
+LIMIT $1
+`
+
+func (q *Queries) ListAuditLog(ctx context.Context, limit int32) ([]AdminAuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditLog, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AdminAuditLog
+	for rows.Next() {
+		var i AdminAuditLog
+		if err := rows.Scan(
+			&i.AuditID,
+			&i.Action,
+			&i.TargetID,
+			&i.Detail,
+			&i.AdminIp,
+			&i.DateCreated,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBlacklist = `-- name: ListBlacklist :many
+SELECT blacklist_id, cause, user_ip, user_id, username, date_created FROM blacklist
 ORDER BY date_created DESC
 `
 
-type GetCommentsByListingIDRow struct {
+func (q *Queries) ListBlacklist(ctx context.Context) ([]Blacklist, error) {
+	rows, err := q.db.Query(ctx, listBlacklist)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Blacklist
+	for rows.Next() {
+		var i Blacklist
+		if err := rows.Scan(
+			&i.BlacklistID,
+			&i.Cause,
+			&i.UserIp,
+			&i.UserID,
+			&i.Username,
+			&i.DateCreated,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReports = `-- name: ListReports :many
+SELECT r.report_id, r.comment_id, r.reporter_id, r.reason, r.detail, r.status, r.date_created, r.date_closed,
+c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.hidden, c.deleted_at IS NOT NULL AS deleted,
+EXTRACT(EPOCH FROM c.date_created),
+(SELECT COUNT(*) FROM reports o WHERE o.comment_id = r.comment_id AND o.status = 'open') AS open_reports
+FROM reports r
+JOIN comments c ON c.comment_id = r.comment_id
+WHERE r.status = $1
+ORDER BY r.report_id ASC
+LIMIT $2
+`
+
+type ListReportsParams struct {
+	Status string
+	Limit  int32
+}
+
+type ListReportsRow struct {
+	ReportID    pgtype.UUID
 	CommentID   pgtype.UUID
+	ReporterID  string
+	Reason      string
+	Detail      string
+	Status      string
+	DateCreated pgtype.Timestamp
+	DateClosed  pgtype.Timestamp
 	ListingID   string
 	UserIp      string
 	UserID      string
 	Username    string
 	CommentText string
+	Hidden      bool
+	Deleted     bool
 	Extract     pgtype.Numeric
+	OpenReports int64
 }
 
-func (q *Queries) GetCommentsByListingID(ctx context.Context, listingID string) ([]GetCommentsByListingIDRow, error) {
-	rows, err := q.db.Query(ctx, getCommentsByListingID, listingID)
+// Returns the reports with the given status, oldest first, along with the reported comment and how many open
+// reports it has.
+func (q *Queries) ListReports(ctx context.Context, arg ListReportsParams) ([]ListReportsRow, error) {
+	rows, err := q.db.Query(ctx, listReports, arg.Status, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetCommentsByListingIDRow
+	var items []ListReportsRow
 	for rows.Next() {
-		var i GetCommentsByListingIDRow
+		var i ListReportsRow
 		if err := rows.Scan(
+			&i.ReportID,
 			&i.CommentID,
+			&i.ReporterID,
+			&i.Reason,
+			&i.Detail,
+			&i.Status,
+			&i.DateCreated,
+			&i.DateClosed,
 			&i.ListingID,
 			&i.UserIp,
 			&i.UserID,
 			&i.Username,
 			&i.CommentText,
+			&i.Hidden,
+			&i.Deleted,
 			&i.Extract,
+			&i.OpenReports,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookAttempts = `-- name: ListWebhookAttempts :many
+SELECT a.event_id, d.event_type, d.status, a.attempt, a.status_code, a.error, a.duration_ms, a.date_created FROM webhook_delivery_attempts a
+JOIN webhook_deliveries d ON d.event_id = a.event_id AND d.webhook_id = a.webhook_id
+WHERE a.webhook_id = $1
+ORDER BY a.date_created DESC, a.attempt DESC
+LIMIT $2
+`
+
+type ListWebhookAttemptsParams struct {
+	WebhookID pgtype.UUID
+	Limit     int32
+}
+
+type ListWebhookAttemptsRow struct {
+	EventID     pgtype.UUID
+	EventType   string
+	Status      string
+	Attempt     int32
+	StatusCode  pgtype.Int4
+	Error       string
+	DurationMs  int32
+	DateCreated pgtype.Timestamp
+}
+
+// Returns the latest delivery attempts of a webhook, with the status of their delivery.
+func (q *Queries) ListWebhookAttempts(ctx context.Context, arg ListWebhookAttemptsParams) ([]ListWebhookAttemptsRow, error) {
+	rows, err := q.db.Query(ctx, listWebhookAttempts, arg.WebhookID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListWebhookAttemptsRow
+	for rows.Next() {
+		var i ListWebhookAttemptsRow
+		if err := rows.Scan(
+			&i.EventID,
+			&i.EventType,
+			&i.Status,
+			&i.Attempt,
+			&i.StatusCode,
+			&i.Error,
+			&i.DurationMs,
+			&i.DateCreated,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhooks = `-- name: ListWebhooks :many
+SELECT webhook_id, listing_id, target_url, secret, event_types, date_created FROM webhooks
+ORDER BY date_created DESC
+`
+
+func (q *Queries) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := q.db.Query(ctx, listWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.WebhookID,
+			&i.ListingID,
+			&i.TargetUrl,
+			&i.Secret,
+			&i.EventTypes,
+			&i.DateCreated,
 		); err != nil {
 			return nil, err
 		}
@@ -55,29 +1826,66 @@ func (q *Queries) GetCommentsByListingID(ctx context.Context, listingID string)
 	return items, nil
 }
 
+const lockCommentForVote = `-- name: LockCommentForVote :one
+SELECT comment_id FROM comments
+WHERE comment_id = $1 AND NOT hidden AND deleted_at IS NULL
+FOR UPDATE
+`
+
+// Locks a votable comment until the end of the transaction, so that concurrent votes are counted one after the other.
+func (q *Queries) LockCommentForVote(ctx context.Context, commentID pgtype.UUID) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, lockCommentForVote, commentID)
+	var comment_id pgtype.UUID
+	err := row.Scan(&comment_id)
+	return comment_id, err
+}
+
+const markSubscriptionNotified = `-- name: MarkSubscriptionNotified :exec
+UPDATE listing_subscriptions SET last_comment_id = $3, last_notified_at = CURRENT_TIMESTAMP
+WHERE listing_id = $1 AND user_id = $2
+`
+
+type MarkSubscriptionNotifiedParams struct {
+	ListingID     string
+	UserID        string
+	LastCommentID pgtype.UUID
+}
+
+func (q *Queries) MarkSubscriptionNotified(ctx context.Context, arg MarkSubscriptionNotifiedParams) error {
+	_, err := q.db.Exec(ctx, markSubscriptionNotified, arg.ListingID, arg.UserID, arg.LastCommentID)
+	return err
+}
+
 const postComment = `-- name: PostComment :one
-INSERT INTO comments (comment_id, listing_id, user_ip, user_id, username, comment_text)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING comment_id, listing_id, user_ip, user_id, username, comment_text, EXTRACT(EPOCH FROM date_created)
+INSERT INTO comments (comment_id, listing_id, user_ip, user_id, username, comment_text, parent_comment_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING comment_id, listing_id, user_ip, user_id, username, comment_text, parent_comment_id, EXTRACT(EPOCH FROM date_created), EXTRACT(EPOCH FROM edited_at) AS edited_at, revision_count, EXTRACT(EPOCH FROM deleted_at) AS deleted_at, deleted_by, score
 `
 
 type PostCommentParams struct {
-	CommentID   pgtype.UUID
-	ListingID   string
-	UserIp      string
-	UserID      string
-	Username    string
-	CommentText string
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
 }
 
 type PostCommentRow struct {
-	CommentID   pgtype.UUID
-	ListingID   string
-	UserIp      string
-	UserID      string
-	Username    string
-	CommentText string
-	Extract     pgtype.Numeric
+	CommentID       pgtype.UUID
+	ListingID       string
+	UserIp          string
+	UserID          string
+	Username        string
+	CommentText     string
+	ParentCommentID pgtype.UUID
+	Extract         pgtype.Numeric
+	EditedAt        pgtype.Numeric
+	RevisionCount   int32
+	DeletedAt       pgtype.Numeric
+	DeletedBy       pgtype.Text
+	Score           int32
 }
 
 func (q *Queries) PostComment(ctx context.Context, arg PostCommentParams) (PostCommentRow, error) {
@@ -88,6 +1896,7 @@ func (q *Queries) PostComment(ctx context.Context, arg PostCommentParams) (PostC
 		arg.UserID,
 		arg.Username,
 		arg.CommentText,
+		arg.ParentCommentID,
 	)
 	var i PostCommentRow
 	err := row.Scan(
@@ -97,7 +1906,236 @@ func (q *Queries) PostComment(ctx context.Context, arg PostCommentParams) (PostC
 		&i.UserID,
 		&i.Username,
 		&i.CommentText,
+		&i.ParentCommentID,
+		&i.Extract,
+		&i.EditedAt,
+		&i.RevisionCount,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.Score,
+	)
+	return i, err
+}
+
+const purgeDeletedComments = `-- name: PurgeDeletedComments :execrows
+DELETE FROM comments c
+WHERE c.deleted_at < $1
+AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id)
+`
+
+// Permanently deletes the comments soft-deleted before the cutoff that have no replies.
+func (q *Queries) PurgeDeletedComments(ctx context.Context, deletedAt pgtype.Timestamp) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeDeletedComments, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const recountCommentVotes = `-- name: RecountCommentVotes :one
+UPDATE comments SET
+    upvotes = (SELECT COUNT(*) FROM comment_votes v WHERE v.comment_id = comments.comment_id AND v.vote = 1),
+    downvotes = (SELECT COUNT(*) FROM comment_votes v WHERE v.comment_id = comments.comment_id AND v.vote = -1)
+WHERE comment_id = $1
+RETURNING score
+`
+
+func (q *Queries) RecountCommentVotes(ctx context.Context, commentID pgtype.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, recountCommentVotes, commentID)
+	var score int32
+	err := row.Scan(&score)
+	return score, err
+}
+
+const scrubDeletedComments = `-- name: ScrubDeletedComments :execrows
+UPDATE comments SET comment_text = '', username = '', user_ip = '', user_id = ''
+WHERE deleted_at < $1
+AND (comment_text <> '' OR username <> '' OR user_ip <> '' OR user_id <> '')
+`
+
+// Erases the text and author of the comments soft-deleted before the cutoff that are kept as tombstones for their replies.
+func (q *Queries) ScrubDeletedComments(ctx context.Context, deletedAt pgtype.Timestamp) (int64, error) {
+	result, err := q.db.Exec(ctx, scrubDeletedComments, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setCommentHidden = `-- name: SetCommentHidden :execrows
+UPDATE comments SET hidden = $2, hidden_by_reports = FALSE
+WHERE comment_id = $1
+`
+
+type SetCommentHiddenParams struct {
+	CommentID pgtype.UUID
+	Hidden    bool
+}
+
+func (q *Queries) SetCommentHidden(ctx context.Context, arg SetCommentHiddenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setCommentHidden, arg.CommentID, arg.Hidden)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const softDeleteComment = `-- name: SoftDeleteComment :execrows
+UPDATE comments SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $2
+WHERE comment_id = $1 AND deleted_at IS NULL
+`
+
+type SoftDeleteCommentParams struct {
+	CommentID pgtype.UUID
+	DeletedBy pgtype.Text
+}
+
+func (q *Queries) SoftDeleteComment(ctx context.Context, arg SoftDeleteCommentParams) (int64, error) {
+	result, err := q.db.Exec(ctx, softDeleteComment, arg.CommentID, arg.DeletedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const unhideReportedComment = `-- name: UnhideReportedComment :execrows
+UPDATE comments SET hidden = FALSE, hidden_by_reports = FALSE
+WHERE comment_id = $1 AND hidden_by_reports
+AND (SELECT COUNT(*) FROM reports r WHERE r.comment_id = $1 AND r.status = 'open' AND r.reporter_id <> 'filter') < $2::bigint
+`
+
+type UnhideReportedCommentParams struct {
+	CommentID     pgtype.UUID
+	HideThreshold int64
+}
+
+// Shows a comment hidden by reports again once it has fewer than hide_threshold open reports from users.
+func (q *Queries) UnhideReportedComment(ctx context.Context, arg UnhideReportedCommentParams) (int64, error) {
+	result, err := q.db.Exec(ctx, unhideReportedComment, arg.CommentID, arg.HideThreshold)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateRateLimitBucket = `-- name: UpdateRateLimitBucket :exec
+UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3
+WHERE bucket_key = $1
+`
+
+type UpdateRateLimitBucketParams struct {
+	BucketKey string
+	Tokens    float64
+	UpdatedAt pgtype.Timestamptz
+}
+
+func (q *Queries) UpdateRateLimitBucket(ctx context.Context, arg UpdateRateLimitBucketParams) error {
+	_, err := q.db.Exec(ctx, updateRateLimitBucket, arg.BucketKey, arg.Tokens, arg.UpdatedAt)
+	return err
+}
+
+const updateWebhookDelivery = `-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries SET status = $1, attempt_count = $2, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3::float8)
+WHERE event_id = $4 AND webhook_id = $5
+`
+
+type UpdateWebhookDeliveryParams struct {
+	Status       string
+	AttemptCount int32
+	DelaySeconds float64
+	EventID      pgtype.UUID
+	WebhookID    pgtype.UUID
+}
+
+// Records the outcome of an attempt: the delivery is done if its status isn't 'pending', and retried after the
+// delay otherwise.
+func (q *Queries) UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) error {
+	_, err := q.db.Exec(ctx, updateWebhookDelivery,
+		arg.Status,
+		arg.AttemptCount,
+		arg.DelaySeconds,
+		arg.EventID,
+		arg.WebhookID,
+	)
+	return err
+}
+
+const upsertCommentVote = `-- name: UpsertCommentVote :exec
+INSERT INTO comment_votes (comment_id, user_id, vote)
+VALUES ($1, $2, $3)
+ON CONFLICT (comment_id, user_id) DO UPDATE SET vote = EXCLUDED.vote, date_created = CURRENT_TIMESTAMP
+`
+
+type UpsertCommentVoteParams struct {
+	CommentID pgtype.UUID
+	UserID    string
+	Vote      int16
+}
+
+func (q *Queries) UpsertCommentVote(ctx context.Context, arg UpsertCommentVoteParams) error {
+	_, err := q.db.Exec(ctx, upsertCommentVote, arg.CommentID, arg.UserID, arg.Vote)
+	return err
+}
+
+const upsertSubscription = `-- name: UpsertSubscription :one
+INSERT INTO listing_subscriptions (listing_id, user_id, email, last_comment_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (listing_id, user_id) DO UPDATE
+SET email = EXCLUDED.email, email_verified = listing_subscriptions.email_verified AND listing_subscriptions.email = EXCLUDED.email
+RETURNING listing_id, user_id, email, email_verified, last_comment_id, EXTRACT(EPOCH FROM date_created)
+`
+
+type UpsertSubscriptionParams struct {
+	ListingID     string
+	UserID        string
+	Email         string
+	LastCommentID pgtype.UUID
+}
+
+type UpsertSubscriptionRow struct {
+	ListingID     string
+	UserID        string
+	Email         string
+	EmailVerified bool
+	LastCommentID pgtype.UUID
+	Extract       pgtype.Numeric
+}
+
+// Subscribes a user to a listing, or changes the email of their subscription. A changed email has to be verified again.
+func (q *Queries) UpsertSubscription(ctx context.Context, arg UpsertSubscriptionParams) (UpsertSubscriptionRow, error) {
+	row := q.db.QueryRow(ctx, upsertSubscription,
+		arg.ListingID,
+		arg.UserID,
+		arg.Email,
+		arg.LastCommentID,
+	)
+	var i UpsertSubscriptionRow
+	err := row.Scan(
+		&i.ListingID,
+		&i.UserID,
+		&i.Email,
+		&i.EmailVerified,
+		&i.LastCommentID,
 		&i.Extract,
 	)
 	return i, err
 }
+
+const verifySubscriptionEmail = `-- name: VerifySubscriptionEmail :execrows
+UPDATE listing_subscriptions SET email_verified = TRUE
+WHERE listing_id = $1 AND user_id = $2 AND email = $3 AND email <> ''
+`
+
+type VerifySubscriptionEmailParams struct {
+	ListingID string
+	UserID    string
+	Email     string
+}
+
+func (q *Queries) VerifySubscriptionEmail(ctx context.Context, arg VerifySubscriptionEmailParams) (int64, error) {
+	result, err := q.db.Exec(ctx, verifySubscriptionEmail, arg.ListingID, arg.UserID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -1,9 +1,452 @@
--- name: GetCommentsByListingID :many
-SELECT comment_id, listing_id, user_ip, user_id, username, comment_text, EXTRACT(EPOCH FROM date_created) FROM comments
-WHERE listing_id = $1
+-- name: PostComment :one
+INSERT INTO comments (comment_id, listing_id, user_ip, user_id, username, comment_text, parent_comment_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING comment_id, listing_id, user_ip, user_id, username, comment_text, parent_comment_id, EXTRACT(EPOCH FROM date_created), EXTRACT(EPOCH FROM edited_at) AS edited_at, revision_count, EXTRACT(EPOCH FROM deleted_at) AS deleted_at, deleted_by, score;
+
+-- name: GetCommentThreadInfo :one
+-- Returns the listing of a comment, its depth in its thread (0 for top-level comments), and whether it was deleted.
+-- Hidden comments, and the ones below them, aren't returned, since they aren't shown.
+WITH RECURSIVE ancestors AS (
+    SELECT comment_id, parent_comment_id, listing_id, 0 AS depth, deleted_at IS NOT NULL AS deleted, hidden FROM comments
+    WHERE comment_id = $1
+    UNION ALL
+    SELECT c.comment_id, c.parent_comment_id, a.listing_id, a.depth + 1, a.deleted, c.hidden FROM comments c
+    JOIN ancestors a ON c.comment_id = a.parent_comment_id
+)
+SELECT listing_id, MAX(depth)::int AS depth, bool_and(deleted)::boolean AS deleted FROM ancestors
+GROUP BY listing_id
+HAVING NOT bool_or(hidden);
+
+-- name: GetTopLevelCommentsBefore :many
+-- Returns a page of top-level comments on a listing, newest first, older than the optional cursor.
+-- Comment IDs sort by date, so the sort key is unused.
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, 0::double precision AS sort_key FROM comments c
+WHERE c.listing_id = sqlc.arg(listing_id) AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND (sqlc.narg(before)::uuid IS NULL OR c.comment_id < sqlc.narg(before)::uuid)
+AND (NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.comment_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetTopLevelCommentsAfter :many
+-- Returns a page of top-level comments on a listing, oldest first, newer than the cursor.
+-- Comment IDs sort by date, so the sort key is unused.
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, 0::double precision AS sort_key FROM comments c
+WHERE c.listing_id = sqlc.arg(listing_id) AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND c.comment_id > sqlc.arg(after)::uuid
+AND (NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.comment_id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetTopLevelCommentsByScoreBefore :many
+-- Returns a page of top-level comments on a listing, highest score first, after the optional cursor in that order.
+-- The cursor holds the score its comment had when it was taken, so that votes since don't move it.
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, c.score::double precision AS sort_key FROM comments c
+WHERE c.listing_id = sqlc.arg(listing_id) AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND (sqlc.narg(before)::uuid IS NULL OR (c.score, c.comment_id) < (sqlc.narg(before_score)::int, sqlc.narg(before)::uuid))
+AND (NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.score DESC, c.comment_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetTopLevelCommentsByScoreAfter :many
+-- Returns a page of top-level comments on a listing, in reverse order (highest score last), before the cursor in that order.
+-- The cursor holds the score its comment had when it was taken, so that votes since don't move it.
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, c.score::double precision AS sort_key FROM comments c
+WHERE c.listing_id = sqlc.arg(listing_id) AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND (c.score, c.comment_id) > (sqlc.arg(after_score)::int, sqlc.arg(after)::uuid)
+AND (NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.score ASC, c.comment_id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetTopLevelCommentsByControversyBefore :many
+-- Returns a page of top-level comments on a listing, most controversial first, after the optional cursor in that order.
+-- The cursor holds the controversy its comment had when it was taken, so that votes since don't move it.
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, c.controversy AS sort_key FROM comments c
+WHERE c.listing_id = sqlc.arg(listing_id) AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND (sqlc.narg(before)::uuid IS NULL OR (c.controversy, c.comment_id) < (sqlc.narg(before_controversy)::double precision, sqlc.narg(before)::uuid))
+AND (NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.controversy DESC, c.comment_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetTopLevelCommentsByControversyAfter :many
+-- Returns a page of top-level comments on a listing, in reverse order (most controversial last), before the cursor in that order.
+-- The cursor holds the controversy its comment had when it was taken, so that votes since don't move it.
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score, c.controversy AS sort_key FROM comments c
+WHERE c.listing_id = sqlc.arg(listing_id) AND c.parent_comment_id IS NULL AND NOT c.hidden
+AND (c.deleted_at IS NULL OR EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id AND NOT r.hidden))
+AND (c.controversy, c.comment_id) > (sqlc.arg(after_controversy)::double precision, sqlc.arg(after)::uuid)
+AND (NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.controversy ASC, c.comment_id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetCommentReplies :many
+-- Returns every reply below the given top-level comments, newest first.
+WITH RECURSIVE replies AS (
+    SELECT comment_id, listing_id, user_ip, user_id, username, comment_text, parent_comment_id, date_created, edited_at, revision_count, deleted_at, deleted_by, score FROM comments
+    WHERE parent_comment_id = ANY(sqlc.arg(thread_ids)::uuid[]) AND NOT hidden
+    UNION ALL
+    SELECT r.comment_id, r.listing_id, r.user_ip, r.user_id, r.username, r.comment_text, r.parent_comment_id, r.date_created, r.edited_at, r.revision_count, r.deleted_at, r.deleted_by, r.score FROM comments r
+    JOIN replies p ON r.parent_comment_id = p.comment_id
+    WHERE NOT r.hidden
+)
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score FROM replies c
+WHERE NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+)
+ORDER BY c.comment_id DESC;
+
+-- name: GetBlacklistMatch :one
+-- Returns the newest blacklist entry matching the IP, user ID or username. Usernames match whatever their case.
+SELECT blacklist_id, cause, user_ip, user_id, username, date_created FROM blacklist
+WHERE (user_ip <> '' AND user_ip = sqlc.arg(user_ip))
+OR user_id = sqlc.arg(user_id)
+OR lower(username) = lower(sqlc.narg(username)::text)
+ORDER BY date_created DESC
+LIMIT 1;
+
+-- name: ListBlacklist :many
+SELECT blacklist_id, cause, user_ip, user_id, username, date_created FROM blacklist
 ORDER BY date_created DESC;
 
--- name: PostComment :one
-INSERT INTO comments (comment_id, listing_id, user_ip, user_id, username, comment_text)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING comment_id, listing_id, user_ip, user_id, username, comment_text, EXTRACT(EPOCH FROM date_created);
\ No newline at end of file
+-- name: CreateBlacklistEntry :one
+INSERT INTO blacklist (blacklist_id, cause, user_ip, user_id, username)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING blacklist_id, cause, user_ip, user_id, username, date_created;
+
+-- name: DeleteBlacklistEntry :execrows
+DELETE FROM blacklist
+WHERE blacklist_id = $1;
+
+-- name: GetRecentComments :many
+SELECT comment_id, listing_id, user_ip, user_id, username, comment_text, hidden, deleted_at IS NOT NULL AS deleted, EXTRACT(EPOCH FROM date_created) FROM comments
+ORDER BY date_created DESC
+LIMIT $1;
+
+-- name: SetCommentHidden :execrows
+UPDATE comments SET hidden = $2, hidden_by_reports = FALSE
+WHERE comment_id = $1;
+
+-- name: CreateAuditLogEntry :exec
+INSERT INTO admin_audit_log (audit_id, action, target_id, detail, admin_ip)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ListAuditLog :many
+SELECT audit_id, action, target_id, detail, admin_ip, date_created FROM admin_audit_log
+ORDER BY date_created DESC
+LIMIT $1;
+
+-- name: CreateRateLimitBucket :exec
+INSERT INTO rate_limit_buckets (bucket_key, tokens, updated_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (bucket_key) DO NOTHING;
+
+-- name: GetRateLimitBucketForUpdate :one
+-- Locks the bucket until the end of the transaction, so that concurrent requests take tokens one after the other.
+SELECT bucket_key, tokens, updated_at FROM rate_limit_buckets
+WHERE bucket_key = $1
+FOR UPDATE;
+
+-- name: UpdateRateLimitBucket :exec
+UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3
+WHERE bucket_key = $1;
+
+-- name: DeleteStaleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
+
+-- name: GetComment :one
+SELECT comment_id, listing_id, user_ip, user_id, username, comment_text, parent_comment_id, EXTRACT(EPOCH FROM date_created), EXTRACT(EPOCH FROM edited_at) AS edited_at, revision_count, EXTRACT(EPOCH FROM deleted_at) AS deleted_at, deleted_by, score FROM comments
+WHERE comment_id = $1 AND NOT hidden AND deleted_at IS NULL;
+
+-- name: EditComment :one
+-- Replaces the text of a comment posted within the edit window, keeping the previous text as a revision. The comment
+-- is locked first, so that concurrent edits each keep the text they replace. Deleted comments and comments past the
+-- window are left alone, without a revision, and so is an unchanged text, which returns the comment as it is.
+WITH previous AS (
+    SELECT comment_id, comment_text, COALESCE(edited_at, date_created) AS written_at FROM comments
+    WHERE comment_id = sqlc.arg(comment_id) AND deleted_at IS NULL
+      AND date_created > CURRENT_TIMESTAMP - make_interval(secs => sqlc.arg(edit_window_seconds)::float8)
+    FOR UPDATE
+), revision AS (
+    INSERT INTO comment_revisions (revision_id, comment_id, comment_text, written_at)
+    SELECT sqlc.arg(revision_id), comment_id, comment_text, written_at FROM previous
+    WHERE comment_text <> sqlc.arg(comment_text)
+)
+UPDATE comments c SET comment_text = sqlc.arg(comment_text),
+    edited_at = CASE WHEN p.comment_text = sqlc.arg(comment_text) THEN c.edited_at ELSE CURRENT_TIMESTAMP END,
+    revision_count = c.revision_count + CASE WHEN p.comment_text = sqlc.arg(comment_text) THEN 0 ELSE 1 END
+FROM previous p
+WHERE c.comment_id = p.comment_id
+RETURNING c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score;
+
+-- name: GetCommentRevisions :many
+-- Returns the previous versions of a comment's text, oldest first.
+SELECT revision_id, comment_text, EXTRACT(EPOCH FROM written_at) AS written_at, EXTRACT(EPOCH FROM replaced_at) AS replaced_at FROM comment_revisions
+WHERE comment_id = $1
+ORDER BY revision_id ASC;
+
+-- name: SoftDeleteComment :execrows
+UPDATE comments SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $2
+WHERE comment_id = $1 AND deleted_at IS NULL;
+
+-- name: PurgeDeletedComments :execrows
+-- Permanently deletes the comments soft-deleted before the cutoff that have no replies.
+DELETE FROM comments c
+WHERE c.deleted_at < $1
+AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id = c.comment_id);
+
+-- name: ScrubDeletedComments :execrows
+-- Erases the text and author of the comments soft-deleted before the cutoff that are kept as tombstones for their replies.
+UPDATE comments SET comment_text = '', username = '', user_ip = '', user_id = ''
+WHERE deleted_at < $1
+AND (comment_text <> '' OR username <> '' OR user_ip <> '' OR user_id <> '');
+
+-- name: DeleteRevisionsOfDeletedComments :execrows
+DELETE FROM comment_revisions cr
+USING comments c
+WHERE cr.comment_id = c.comment_id AND c.deleted_at < $1;
+
+-- name: LockCommentForVote :one
+-- Locks a votable comment until the end of the transaction, so that concurrent votes are counted one after the other.
+SELECT comment_id FROM comments
+WHERE comment_id = $1 AND NOT hidden AND deleted_at IS NULL
+FOR UPDATE;
+
+-- name: UpsertCommentVote :exec
+INSERT INTO comment_votes (comment_id, user_id, vote)
+VALUES ($1, $2, $3)
+ON CONFLICT (comment_id, user_id) DO UPDATE SET vote = EXCLUDED.vote, date_created = CURRENT_TIMESTAMP;
+
+-- name: DeleteCommentVote :exec
+DELETE FROM comment_votes
+WHERE comment_id = $1 AND user_id = $2;
+
+-- name: RecountCommentVotes :one
+UPDATE comments SET
+    upvotes = (SELECT COUNT(*) FROM comment_votes v WHERE v.comment_id = comments.comment_id AND v.vote = 1),
+    downvotes = (SELECT COUNT(*) FROM comment_votes v WHERE v.comment_id = comments.comment_id AND v.vote = -1)
+WHERE comment_id = $1
+RETURNING score;
+
+-- name: GetUserVotes :many
+SELECT comment_id, vote FROM comment_votes
+WHERE user_id = sqlc.arg(user_id) AND comment_id = ANY(sqlc.arg(comment_ids)::uuid[]);
+
+-- name: CreateReport :one
+-- Returns no row if the reporter already reported the comment.
+INSERT INTO reports (report_id, comment_id, reporter_id, reason, detail)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (comment_id, reporter_id) DO NOTHING
+RETURNING report_id, comment_id, reporter_id, reason, detail, status, date_created, date_closed;
+
+-- name: GetReportByReporter :one
+SELECT report_id, comment_id, reporter_id, reason, detail, status, date_created, date_closed FROM reports
+WHERE comment_id = $1 AND reporter_id = $2;
+
+-- name: HideReportedComment :execrows
+-- Hides a comment once it has at least hide_threshold open reports from users, unless it is already hidden. The
+-- reports of the comment filters don't count.
+UPDATE comments SET hidden = TRUE, hidden_by_reports = TRUE
+WHERE comment_id = sqlc.arg(comment_id) AND NOT hidden
+AND (SELECT COUNT(*) FROM reports r WHERE r.comment_id = sqlc.arg(comment_id) AND r.status = 'open' AND r.reporter_id <> 'filter') >= sqlc.arg(hide_threshold)::bigint;
+
+-- name: UnhideReportedComment :execrows
+-- Shows a comment hidden by reports again once it has fewer than hide_threshold open reports from users.
+UPDATE comments SET hidden = FALSE, hidden_by_reports = FALSE
+WHERE comment_id = sqlc.arg(comment_id) AND hidden_by_reports
+AND (SELECT COUNT(*) FROM reports r WHERE r.comment_id = sqlc.arg(comment_id) AND r.status = 'open' AND r.reporter_id <> 'filter') < sqlc.arg(hide_threshold)::bigint;
+
+-- name: ListReports :many
+-- Returns the reports with the given status, oldest first, along with the reported comment and how many open
+-- reports it has.
+SELECT r.report_id, r.comment_id, r.reporter_id, r.reason, r.detail, r.status, r.date_created, r.date_closed,
+c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.hidden, c.deleted_at IS NOT NULL AS deleted,
+EXTRACT(EPOCH FROM c.date_created),
+(SELECT COUNT(*) FROM reports o WHERE o.comment_id = r.comment_id AND o.status = 'open') AS open_reports
+FROM reports r
+JOIN comments c ON c.comment_id = r.comment_id
+WHERE r.status = sqlc.arg(status)
+ORDER BY r.report_id ASC
+LIMIT sqlc.arg(limit);
+
+-- name: CloseReport :one
+-- Closes an open report, returning the reported comment and the IDs of the reporter and of the comment's author.
+UPDATE reports r SET status = sqlc.arg(status), date_closed = CURRENT_TIMESTAMP
+FROM comments c
+WHERE r.report_id = sqlc.arg(report_id) AND r.status = 'open' AND c.comment_id = r.comment_id
+RETURNING r.comment_id, r.reporter_id, c.user_id AS author_id;
+
+-- name: CloseCommentReports :execrows
+-- Closes every open report on a comment.
+UPDATE reports SET status = sqlc.arg(status), date_closed = CURRENT_TIMESTAMP
+WHERE comment_id = sqlc.arg(comment_id) AND status = 'open';
+
+-- name: GetListingCommentCounts :many
+-- Counts the visible comments, replies included, on each of the listings that has any, along with when the latest one was posted.
+SELECT c.listing_id, COUNT(*) AS comment_count, MAX(EXTRACT(EPOCH FROM c.date_created))::numeric AS latest_comment FROM comments c
+WHERE c.listing_id = ANY(sqlc.arg(listing_ids)::varchar[]) AND NOT c.hidden AND c.deleted_at IS NULL
+AND (NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+GROUP BY c.listing_id;
+
+-- name: GetListingCommentsSince :many
+-- Returns the visible comments on a listing, replies included, posted after the given one, oldest first.
+SELECT c.comment_id, c.listing_id, c.user_ip, c.user_id, c.username, c.comment_text, c.parent_comment_id, EXTRACT(EPOCH FROM c.date_created), EXTRACT(EPOCH FROM c.edited_at) AS edited_at, c.revision_count, EXTRACT(EPOCH FROM c.deleted_at) AS deleted_at, c.deleted_by, c.score FROM comments c
+WHERE c.listing_id = sqlc.arg(listing_id) AND c.comment_id > sqlc.arg(since)::uuid AND NOT c.hidden AND c.deleted_at IS NULL
+AND (NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+    SELECT 1 FROM blacklist b
+    WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+    OR b.user_id = c.user_id
+    OR lower(b.username) = lower(c.username)
+))
+ORDER BY c.comment_id
+LIMIT sqlc.arg(page_size);
+
+-- name: GetSubscription :one
+SELECT listing_id, user_id, email, email_verified, last_comment_id, EXTRACT(EPOCH FROM date_created) FROM listing_subscriptions
+WHERE listing_id = $1 AND user_id = $2;
+
+-- name: UpsertSubscription :one
+-- Subscribes a user to a listing, or changes the email of their subscription. A changed email has to be verified again.
+INSERT INTO listing_subscriptions (listing_id, user_id, email, last_comment_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (listing_id, user_id) DO UPDATE
+SET email = EXCLUDED.email, email_verified = listing_subscriptions.email_verified AND listing_subscriptions.email = EXCLUDED.email
+RETURNING listing_id, user_id, email, email_verified, last_comment_id, EXTRACT(EPOCH FROM date_created);
+
+-- name: DeleteSubscription :execrows
+DELETE FROM listing_subscriptions
+WHERE listing_id = $1 AND user_id = $2;
+
+-- name: VerifySubscriptionEmail :execrows
+UPDATE listing_subscriptions SET email_verified = TRUE
+WHERE listing_id = $1 AND user_id = $2 AND email = $3 AND email <> '';
+
+-- name: GetPendingSubscriptions :many
+-- Returns the subscriptions to listings with visible comments by others than the subscriber since they were last
+-- notified, in key order after the given one. Comments by blacklisted authors don't count when they are hidden, like
+-- GetListingCommentsSince leaves them out.
+SELECT s.listing_id, s.user_id, s.email, s.email_verified, s.last_comment_id, EXTRACT(EPOCH FROM s.date_created) FROM listing_subscriptions s
+WHERE (s.listing_id, s.user_id) > (sqlc.arg(after_listing_id)::varchar, sqlc.arg(after_user_id)::varchar)
+AND EXISTS (
+    SELECT 1 FROM comments c
+    WHERE c.listing_id = s.listing_id AND c.comment_id > s.last_comment_id AND c.user_id <> s.user_id
+    AND NOT c.hidden AND c.deleted_at IS NULL
+    AND (NOT sqlc.arg(hide_blacklisted)::boolean OR NOT EXISTS (
+        SELECT 1 FROM blacklist b
+        WHERE (b.user_ip <> '' AND b.user_ip = c.user_ip)
+        OR b.user_id = c.user_id
+        OR lower(b.username) = lower(c.username)
+    ))
+)
+ORDER BY s.listing_id, s.user_id
+LIMIT sqlc.arg(page_size);
+
+-- name: MarkSubscriptionNotified :exec
+UPDATE listing_subscriptions SET last_comment_id = $3, last_notified_at = CURRENT_TIMESTAMP
+WHERE listing_id = $1 AND user_id = $2;
+
+-- name: CreateWebhook :one
+INSERT INTO webhooks (webhook_id, listing_id, target_url, secret, event_types)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING webhook_id, listing_id, target_url, secret, event_types, date_created;
+
+-- name: ListWebhooks :many
+SELECT webhook_id, listing_id, target_url, secret, event_types, date_created FROM webhooks
+ORDER BY date_created DESC;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE webhook_id = $1;
+
+-- name: EnqueueWebhookEvent :execrows
+-- Queues an event for every webhook registered for its type, on its listing or on every listing.
+INSERT INTO webhook_deliveries (event_id, webhook_id, event_type, payload)
+SELECT sqlc.arg(event_id)::uuid, w.webhook_id, sqlc.arg(event_type)::varchar, sqlc.arg(payload)::jsonb FROM webhooks w
+WHERE (w.listing_id IS NULL OR w.listing_id = sqlc.arg(listing_id)::varchar) AND sqlc.arg(event_type)::varchar = ANY(w.event_types);
+
+-- name: ClaimWebhookDeliveries :many
+-- Claims the pending deliveries that are due, oldest first, by pushing their next attempt back by the lease, so that
+-- other instances skip them while they are being delivered.
+UPDATE webhook_deliveries d SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => sqlc.arg(lease_seconds)::float8)
+FROM webhooks w
+WHERE w.webhook_id = d.webhook_id AND (d.event_id, d.webhook_id) IN (
+    SELECT p.event_id, p.webhook_id FROM webhook_deliveries p
+    WHERE p.status = 'pending' AND p.next_attempt_at <= CURRENT_TIMESTAMP
+    ORDER BY p.next_attempt_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING d.event_id, d.webhook_id, d.event_type, d.payload, d.attempt_count, w.target_url, w.secret;
+
+-- name: CreateWebhookAttempt :exec
+INSERT INTO webhook_delivery_attempts (event_id, webhook_id, attempt, status_code, error, duration_ms)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: UpdateWebhookDelivery :exec
+-- Records the outcome of an attempt: the delivery is done if its status isn't 'pending', and retried after the
+-- delay otherwise.
+UPDATE webhook_deliveries SET status = sqlc.arg(status), attempt_count = sqlc.arg(attempt_count), next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => sqlc.arg(delay_seconds)::float8)
+WHERE event_id = sqlc.arg(event_id) AND webhook_id = sqlc.arg(webhook_id);
+
+-- name: ListWebhookAttempts :many
+-- Returns the latest delivery attempts of a webhook, with the status of their delivery.
+SELECT a.event_id, d.event_type, d.status, a.attempt, a.status_code, a.error, a.duration_ms, a.date_created FROM webhook_delivery_attempts a
+JOIN webhook_deliveries d ON d.event_id = a.event_id AND d.webhook_id = a.webhook_id
+WHERE a.webhook_id = $1
+ORDER BY a.date_created DESC, a.attempt DESC
+LIMIT $2;
+
+-- name: DeleteFinishedWebhookDeliveries :execrows
+-- Deletes the deliveries that were delivered or gave up before the given time, along with their attempts.
+DELETE FROM webhook_deliveries
+WHERE status <> 'pending' AND date_created < $1;
+
+-- name: CheckCommentsTable :exec
+-- Fails unless the comments table is reachable, for the readiness check.
+SELECT 1 FROM comments LIMIT 1;
+
+-- name: CheckBlacklistTable :exec
+-- Fails unless the blacklist table is reachable, for the readiness check.
+SELECT 1 FROM blacklist LIMIT 1;
@@ -5,9 +5,34 @@ CREATE TABLE IF NOT EXISTS comments (
     user_id varchar(50) NOT NULL,
     username varchar(50) NOT NULL,
     comment_text varchar(300) NOT NULL,
-    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    parent_comment_id UUID REFERENCES comments (comment_id) ON DELETE CASCADE,
+    edited_at TIMESTAMP,
+    revision_count INTEGER NOT NULL DEFAULT 0,
+    deleted_at TIMESTAMP,
+    deleted_by varchar(10),
+    upvotes INTEGER NOT NULL DEFAULT 0,
+    downvotes INTEGER NOT NULL DEFAULT 0,
+    score INTEGER GENERATED ALWAYS AS (upvotes - downvotes) STORED NOT NULL,
+    controversy DOUBLE PRECISION GENERATED ALWAYS AS (
+        CASE WHEN upvotes = 0 OR downvotes = 0 THEN 0
+        ELSE (upvotes + downvotes)::double precision * LEAST(upvotes, downvotes) / GREATEST(upvotes, downvotes)
+        END
+    ) STORED NOT NULL,
+    hidden_by_reports BOOLEAN NOT NULL DEFAULT FALSE
 );
 
+CREATE INDEX IF NOT EXISTS comments_parent_comment_id_idx ON comments (parent_comment_id);
+
+CREATE INDEX IF NOT EXISTS comments_listing_id_comment_id_idx ON comments (listing_id, comment_id);
+
+CREATE INDEX IF NOT EXISTS comments_deleted_at_idx ON comments (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS comments_listing_score_idx ON comments (listing_id, score, comment_id) WHERE parent_comment_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS comments_listing_controversy_idx ON comments (listing_id, controversy, comment_id) WHERE parent_comment_id IS NULL;
+
 CREATE TABLE IF NOT EXISTS blacklist (
     blacklist_id UUID PRIMARY KEY,
     cause varchar(100) NOT NULL,
@@ -15,4 +40,114 @@ CREATE TABLE IF NOT EXISTS blacklist (
     user_id varchar(50),
     username varchar(50),
     date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file
+);
+
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    audit_id UUID PRIMARY KEY,
+    action varchar(50) NOT NULL,
+    target_id varchar(200) NOT NULL,
+    detail varchar(500) NOT NULL DEFAULT '',
+    admin_ip varchar(45) NOT NULL,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    bucket_key varchar(200) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_updated_at_idx ON rate_limit_buckets (updated_at);
+
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    revision_id UUID PRIMARY KEY,
+    comment_id UUID NOT NULL REFERENCES comments (comment_id) ON DELETE CASCADE,
+    comment_text varchar(300) NOT NULL,
+    written_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS comment_revisions_comment_id_idx ON comment_revisions (comment_id, revision_id);
+
+CREATE TABLE IF NOT EXISTS comment_votes (
+    comment_id UUID NOT NULL REFERENCES comments (comment_id) ON DELETE CASCADE,
+    user_id varchar(50) NOT NULL,
+    vote SMALLINT NOT NULL CHECK (vote IN (-1, 1)),
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS reports (
+    report_id UUID PRIMARY KEY,
+    comment_id UUID NOT NULL REFERENCES comments (comment_id) ON DELETE CASCADE,
+    reporter_id varchar(50) NOT NULL,
+    reason varchar(20) NOT NULL,
+    detail varchar(300) NOT NULL DEFAULT '',
+    status varchar(10) NOT NULL DEFAULT 'open',
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_closed TIMESTAMP,
+    UNIQUE (comment_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS reports_status_idx ON reports (status, report_id);
+
+CREATE OR REPLACE FUNCTION notify_comment_inserted() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('comment_inserted', json_build_object('listing_id', NEW.listing_id, 'comment_id', NEW.comment_id)::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comments_notify_insert
+AFTER INSERT ON comments
+FOR EACH ROW EXECUTE FUNCTION notify_comment_inserted();
+
+CREATE TABLE IF NOT EXISTS listing_subscriptions (
+    listing_id varchar(200) NOT NULL,
+    user_id varchar(50) NOT NULL,
+    email varchar(254) NOT NULL DEFAULT '',
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    last_comment_id UUID NOT NULL,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_notified_at TIMESTAMP,
+    PRIMARY KEY (listing_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    webhook_id UUID PRIMARY KEY,
+    listing_id varchar(200),
+    target_url varchar(2048) NOT NULL,
+    secret varchar(100) NOT NULL,
+    event_types varchar(50)[] NOT NULL,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_listing_id_idx ON webhooks (listing_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    event_id UUID NOT NULL,
+    webhook_id UUID NOT NULL REFERENCES webhooks (webhook_id) ON DELETE CASCADE,
+    event_type varchar(50) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(10) NOT NULL DEFAULT 'pending',
+    attempt_count INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, webhook_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    event_id UUID NOT NULL,
+    webhook_id UUID NOT NULL,
+    attempt INT NOT NULL,
+    status_code INT,
+    error varchar(500) NOT NULL DEFAULT '',
+    duration_ms INT NOT NULL,
+    date_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, webhook_id, attempt),
+    FOREIGN KEY (event_id, webhook_id) REFERENCES webhook_deliveries (event_id, webhook_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_webhook_idx ON webhook_delivery_attempts (webhook_id, date_created);
@@ -0,0 +1,189 @@
+// The filter package validates and cleans up comments before they are stored, through an ordered pipeline of
+// CommentFilter stages. Each stage can let a comment through, rewrite it (e.g. to mask a word), flag it for a
+// moderator to review, or reject it.
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is what a stage decides to do with a comment. Actions are ordered from the mildest to the most severe.
+type Action int
+
+const (
+	// Allow lets the comment through as is, or with changes that don't alter its meaning (e.g. normalization).
+	Allow Action = iota
+	// Flag lets the comment through, but asks a moderator to review it.
+	Flag
+	// Mask lets the comment through with the offending parts replaced.
+	Mask
+	// Reject refuses the comment.
+	Reject
+)
+
+func (action Action) String() string {
+	switch action {
+	case Allow:
+		return "allow"
+	case Flag:
+		return "flag"
+	case Mask:
+		return "mask"
+	case Reject:
+		return "reject"
+	default:
+		return fmt.Sprintf("Action(%d)", int(action))
+	}
+}
+
+// ParseAction parses the configurable actions of the wordlist and link stages: "flag", "mask" or "reject".
+func ParseAction(value string) (Action, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "flag":
+		return Flag, nil
+	case "mask":
+		return Mask, nil
+	case "reject":
+		return Reject, nil
+	default:
+		return Allow, fmt.Errorf("unknown action %q, must be flag, mask or reject", value)
+	}
+}
+
+// MarshalText formats the action with String, so that it is written to configuration files like it is read.
+func (action Action) MarshalText() ([]byte, error) {
+	return []byte(action.String()), nil
+}
+
+// UnmarshalText parses the action with ParseAction, so that it can be read from configuration files.
+func (action *Action) UnmarshalText(text []byte) error {
+	parsed, err := ParseAction(string(text))
+	if err != nil {
+		return err
+	}
+	*action = parsed
+	return nil
+}
+
+// Comment holds the user-written parts of a comment, which are what the stages look at.
+type Comment struct {
+	Username    string
+	CommentText string
+}
+
+// Decision is what a stage made of a comment.
+type Decision struct {
+	Action Action
+	// Reason is a machine-readable reason for anything but Allow, e.g. "comment_too_long" or "link".
+	Reason string
+	// Message explains a rejection to the client.
+	Message string
+}
+
+// CommentFilter is a stage of a Pipeline. Filter may rewrite the comment in place, both to clean it up and to mask
+// parts of it, and returns what it decided.
+type CommentFilter interface {
+	Filter(comment *Comment) Decision
+}
+
+// Result is the outcome of running a comment through a Pipeline.
+type Result struct {
+	// Comment is the comment as rewritten by the stages. It is only meant to be stored if the comment wasn't rejected.
+	Comment Comment
+	// Unmasked is the comment as cleaned up by the stages before any of them masked part of it, e.g. to match the
+	// username against the blacklist. It is the same as Comment if nothing was masked.
+	Unmasked Comment
+
+	// Rejected is set if a stage rejected the comment, with that stage's reason and message.
+	Rejected bool
+	Reason   string
+	Message  string
+
+	// Flags and Masks hold the reasons of the stages that flagged the comment for review or masked part of it.
+	Flags []string
+	Masks []string
+}
+
+// Pipeline runs a comment through its stages in order.
+type Pipeline []CommentFilter
+
+// Run runs a comment through every stage, each one seeing the comment as rewritten by the previous ones.
+// It stops at the first stage that rejects the comment.
+func (pipeline Pipeline) Run(comment Comment) Result {
+	result := Result{}
+	for _, stage := range pipeline {
+		before := comment
+		decision := stage.Filter(&comment)
+		switch decision.Action {
+		case Reject:
+			result.Comment = comment
+			if len(result.Masks) == 0 {
+				result.Unmasked = comment
+			}
+			result.Rejected = true
+			result.Reason = decision.Reason
+			result.Message = decision.Message
+			return result
+		case Mask:
+			if len(result.Masks) == 0 {
+				result.Unmasked = before
+			}
+			result.Masks = append(result.Masks, decision.Reason)
+		case Flag:
+			result.Flags = append(result.Flags, decision.Reason)
+		}
+	}
+	result.Comment = comment
+	if len(result.Masks) == 0 {
+		result.Unmasked = comment
+	}
+	return result
+}
+
+// Config holds the settings of the default pipeline.
+type Config struct {
+	// MaxCommentLength and MaxUsernameLength are in characters (runes), after normalization
+	MaxCommentLength  int
+	MaxUsernameLength int
+
+	// Wordlist holds the words that aren't allowed, and WordlistAction what to do with comments using them
+	Wordlist       []string
+	WordlistAction Action
+
+	// LinkAction is what to do with comments containing links to domains other than AllowedLinkDomains
+	LinkAction         Action
+	AllowedLinkDomains []string
+}
+
+// Default limits, matching the columns of the comments table
+const (
+	DefaultMaxCommentLength  = 300
+	DefaultMaxUsernameLength = 50
+)
+
+// DefaultConfig returns the settings used when nothing is configured: the built-in wordlist is masked, and links
+// to anywhere but Zillow are flagged for review.
+func DefaultConfig() Config {
+	return Config{
+		MaxCommentLength:   DefaultMaxCommentLength,
+		MaxUsernameLength:  DefaultMaxUsernameLength,
+		Wordlist:           DefaultWordlist(),
+		WordlistAction:     Mask,
+		LinkAction:         Flag,
+		AllowedLinkDomains: []string{"zillow.com"},
+	}
+}
+
+// NewPipeline returns the default pipeline: invisible characters are stripped and the text normalized, then the
+// wordlist and the links are checked on the cleaned-up text. The lengths are checked last, on the text as it will be
+// stored, since masking a short link makes the text longer.
+func NewPipeline(config Config) Pipeline {
+	return Pipeline{
+		StripInvisibleFilter{},
+		NormalizeFilter{},
+		NewWordlistFilter(config.Wordlist, config.WordlistAction),
+		LinkFilter{Action: config.LinkAction, AllowedDomains: config.AllowedLinkDomains},
+		LengthFilter{MaxCommentLength: config.MaxCommentLength, MaxUsernameLength: config.MaxUsernameLength},
+	}
+}
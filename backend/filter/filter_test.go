@@ -0,0 +1,74 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPipelineChecksLengthsAfterMasking(t *testing.T) {
+	config := DefaultConfig()
+	config.LinkAction = Mask
+	pipeline := NewPipeline(config)
+
+	// Masking a link shorter than "[link]" makes the text longer, past the limit
+	text := strings.Repeat("a", DefaultMaxCommentLength-5) + " a.io"
+	result := pipeline.Run(Comment{Username: "alice", CommentText: text})
+	if !result.Rejected || result.Reason != "comment_too_long" {
+		t.Errorf("Run() = %+v, want the masked comment rejected as too long", result)
+	}
+
+	text = strings.Repeat("a", DefaultMaxCommentLength-11) + " a.io"
+	result = pipeline.Run(Comment{Username: "alice", CommentText: text})
+	if result.Rejected || !strings.HasSuffix(result.Comment.CommentText, " [link]") {
+		t.Errorf("Run() = %+v, want the link masked", result)
+	}
+}
+
+func TestPipelineKeepsUnmaskedComment(t *testing.T) {
+	pipeline := NewPipeline(DefaultConfig())
+
+	// Zero-width characters are stripped before anything is masked
+	result := pipeline.Run(Comment{Username: "sh\u200bit", CommentText: "what a shit view"})
+	if result.Rejected {
+		t.Fatalf("Run() rejected the comment: %+v", result)
+	}
+	if result.Comment.Username != "****" || result.Comment.CommentText != "what a **** view" {
+		t.Errorf("Comment = %+v, want the words masked", result.Comment)
+	}
+	if result.Unmasked.Username != "shit" || result.Unmasked.CommentText != "what a shit view" {
+		t.Errorf("Unmasked = %+v, want the cleaned-up comment before masking", result.Unmasked)
+	}
+
+	result = pipeline.Run(Comment{Username: " alice ", CommentText: "nice view"})
+	if result.Unmasked != result.Comment {
+		t.Errorf("Unmasked = %+v, want the same as Comment %+v when nothing is masked", result.Unmasked, result.Comment)
+	}
+}
+
+func TestStripInvisibleKeepsJoiners(t *testing.T) {
+	england := "\U0001f3f4\U000e0067\U000e0062\U000e0065\U000e006e\U000e0067\U000e007f"
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"zero-width space", "sh\u200bit", "shit"},
+		{"joiners between latin letters", "sh\u200dit sh\u200cit", "shit shit"},
+		{"persian non-joiner", "می\u200cخواهم", "می\u200cخواهم"},
+		{"devanagari joiner", "क्\u200dष", "क्\u200dष"},
+		{"emoji family", "\U0001f469\u200d\U0001f469\u200d\U0001f467", "\U0001f469\u200d\U0001f469\u200d\U0001f467"},
+		{"skin tone before joiner", "\U0001f469\U0001f3fd\u200d\U0001f4bb", "\U0001f469\U0001f3fd\u200d\U0001f4bb"},
+		{"dangling joiner", "\U0001f469\u200d", "\U0001f469"},
+		{"subdivision flag", "go " + england + "!", "go " + england + "!"},
+		{"tags without a flag", "hi\U000e0068\U000e0069\U000e007f", "hi"},
+		{"flag with uppercase tags", "\U0001f3f4\U000e0047\U000e0042\U000e007f", "\U0001f3f4"},
+		{"flag without cancel tag", "\U0001f3f4\U000e0067\U000e0062", "\U0001f3f4"},
+		{"flag with too many tags", "\U0001f3f4" + strings.Repeat("\U000e0061", 8) + "\U000e007f", "\U0001f3f4"},
+		{"bidirectional override", "abc\u202edef", "abcdef"},
+	}
+	for _, test := range tests {
+		if got := stripInvisible(test.text, false); got != test.want {
+			t.Errorf("%s: stripInvisible(%+q) = %+q, want %+q", test.name, test.text, got, test.want)
+		}
+	}
+}
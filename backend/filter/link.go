@@ -0,0 +1,66 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// linkPattern matches URLs with a scheme, addresses starting with "www.", and bare domains with a common top-level
+// domain, like "example.com/page"
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://[^\s<>"]+|www\.[^\s<>"]+|(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+(?:com|net|org|info|biz|io|co|me|us|uk|ca|ly|gl|to|xyz|top|site|online|app|dev|ru|cn)\b(?:/[^\s<>"]*)?)`)
+
+// LinkFilter catches the links in comments, and flags, masks or rejects the comments linking anywhere but the
+// allowed domains (or their subdomains).
+type LinkFilter struct {
+	Action         Action
+	AllowedDomains []string
+}
+
+func (filter LinkFilter) Filter(comment *Comment) Decision {
+	found := false
+	masked := linkPattern.ReplaceAllStringFunc(comment.CommentText, func(link string) string {
+		if filter.allowed(link) {
+			return link
+		}
+		found = true
+		return "[link]"
+	})
+	if !found {
+		return Decision{Action: Allow}
+	}
+
+	decision := Decision{Action: filter.Action, Reason: "link"}
+	switch filter.Action {
+	case Mask:
+		comment.CommentText = masked
+	case Reject:
+		decision.Message = "Comments can't contain links"
+	}
+	return decision
+}
+
+// allowed reports whether a link points to one of the allowed domains.
+func (filter LinkFilter) allowed(link string) bool {
+	host := strings.ToLower(link)
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+len("://"):]
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	if i := strings.Index(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	for _, domain := range filter.AllowedDomains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
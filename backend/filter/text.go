@@ -0,0 +1,167 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// zeroWidthJoiner joins emoji into a single one (e.g. a family), and asks for the joined form of letters in
+	// scripts such as Arabic and Devanagari. zeroWidthNonJoiner asks for the separate forms, e.g. in Persian words.
+	zeroWidthJoiner    = '\u200d'
+	zeroWidthNonJoiner = '\u200c'
+
+	// blackFlag starts the flags of subdivisions such as England, which spell the subdivision in tag characters
+	// ending with cancelTag. Tag characters mirror ASCII without showing up, so they are only kept in those flags.
+	blackFlag       = '\U0001f3f4'
+	cancelTag       = '\U000e007f'
+	maxFlagTagCount = 7
+)
+
+// joiningScripts are the scripts whose letters zero-width joiners and non-joiners change the shape of
+var joiningScripts = []*unicode.RangeTable{
+	unicode.Arabic, unicode.Syriac, unicode.Nko, unicode.Mongolian,
+	unicode.Devanagari, unicode.Bengali, unicode.Gurmukhi, unicode.Gujarati, unicode.Oriya,
+	unicode.Tamil, unicode.Telugu, unicode.Kannada, unicode.Malayalam, unicode.Sinhala,
+}
+
+// fillers are letters that render as blank space, which are used to make empty-looking usernames and comments
+var fillers = map[rune]bool{
+	'\u115f': true, // Hangul choseong filler
+	'\u1160': true, // Hangul jungseong filler
+	'\u3164': true, // Hangul filler
+	'\uffa0': true, // Halfwidth Hangul filler
+	'\u2800': true, // Braille pattern blank
+}
+
+// StripInvisibleFilter removes the characters that don't show up but can hide text from the other stages or mess
+// with the page: control characters (except line breaks in the text), zero-width characters (except joiners where
+// they shape letters or emoji), bidirectional overrides, and blank fillers.
+type StripInvisibleFilter struct{}
+
+func (StripInvisibleFilter) Filter(comment *Comment) Decision {
+	comment.Username = stripInvisible(comment.Username, false)
+	comment.CommentText = stripInvisible(strings.ReplaceAll(comment.CommentText, "\r\n", "\n"), true)
+	return Decision{Action: Allow}
+}
+
+// stripInvisible removes control and format characters from text, keeping line breaks if keepNewlines is set.
+// Format characters that matter to how text shows up are kept where they do: zero-width joiners and non-joiners
+// between letters of a joining script, zero-width joiners in emoji sequences, and the tags of subdivision flags.
+func stripInvisible(text string, keepNewlines bool) string {
+	runes := []rune(text)
+	var builder strings.Builder
+	builder.Grow(len(text))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n' && keepNewlines:
+		case (r == zeroWidthJoiner || r == zeroWidthNonJoiner) && joinsScript(runes, i):
+		case r == zeroWidthJoiner && joinsEmoji(runes, i):
+		case r == blackFlag:
+			// Keep the tags of the flag along with it
+			tagCount := flagTagCount(runes[i+1:])
+			builder.WriteString(string(runes[i : i+1+tagCount]))
+			i += tagCount
+			continue
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r), fillers[r], r == utf8.RuneError:
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// joinsScript reports whether the joiner or non-joiner at index i is between two letters or marks of the same joining
+// script.
+func joinsScript(runes []rune, i int) bool {
+	if i == 0 || i == len(runes)-1 {
+		return false
+	}
+	before, after := runes[i-1], runes[i+1]
+	if !unicode.In(before, unicode.L, unicode.M) || !unicode.In(after, unicode.L, unicode.M) {
+		return false
+	}
+	for _, script := range joiningScripts {
+		if unicode.Is(script, before) && unicode.Is(script, after) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinsEmoji reports whether the joiner at index i is between two emoji, the first of which may end with a skin
+// tone or an emoji presentation selector.
+func joinsEmoji(runes []rune, i int) bool {
+	if i == 0 || i == len(runes)-1 {
+		return false
+	}
+	before := runes[i-1]
+	return (unicode.Is(unicode.So, before) || isSkinTone(before) || before == '\ufe0f') && unicode.Is(unicode.So, runes[i+1])
+}
+
+// isSkinTone reports whether r is one of the emoji modifiers setting a skin tone.
+func isSkinTone(r rune) bool {
+	return r >= '\U0001f3fb' && r <= '\U0001f3ff'
+}
+
+// flagTagCount returns how many of the runes following a black flag are the tags of a subdivision flag: digits or
+// lowercase letters as tags, ending with a cancel tag. It returns 0 if they aren't.
+func flagTagCount(runes []rune) int {
+	for i, r := range runes {
+		switch {
+		case i > maxFlagTagCount:
+			return 0
+		case r == cancelTag && i == 0:
+			return 0
+		case r == cancelTag:
+			return i + 1
+		case r >= '\U000e0030' && r <= '\U000e0039', r >= '\U000e0061' && r <= '\U000e007a':
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// NormalizeFilter puts the text in Unicode normalization form C, so that the same text is always stored the same
+// way and counted the same length, and trims the whitespace around it.
+type NormalizeFilter struct{}
+
+func (NormalizeFilter) Filter(comment *Comment) Decision {
+	comment.Username = strings.TrimSpace(norm.NFC.String(comment.Username))
+	comment.CommentText = strings.TrimSpace(norm.NFC.String(comment.CommentText))
+	return Decision{Action: Allow}
+}
+
+// LengthFilter rejects empty comments and usernames, and the ones longer than the limits. Lengths are counted in
+// characters (runes), like Postgres counts them for varchar columns.
+type LengthFilter struct {
+	MaxCommentLength  int
+	MaxUsernameLength int
+}
+
+func (filter LengthFilter) Filter(comment *Comment) Decision {
+	if comment.Username == "" || comment.CommentText == "" {
+		return Decision{Action: Reject, Reason: "missing_field", Message: "Invalid input data"}
+	}
+	if utf8.RuneCountInString(comment.CommentText) > filter.MaxCommentLength {
+		return Decision{
+			Action:  Reject,
+			Reason:  "comment_too_long",
+			Message: fmt.Sprintf("Comment text exceeds maximum length of %d characters", filter.MaxCommentLength),
+		}
+	}
+	if utf8.RuneCountInString(comment.Username) > filter.MaxUsernameLength {
+		return Decision{
+			Action:  Reject,
+			Reason:  "username_too_long",
+			Message: fmt.Sprintf("Username exceeds maximum length of %d characters", filter.MaxUsernameLength),
+		}
+	}
+	return Decision{Action: Allow}
+}
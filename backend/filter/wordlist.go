@@ -0,0 +1,204 @@
+package filter
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//go:embed wordlist.txt
+var defaultWordlist string
+
+// DefaultWordlist returns the built-in wordlist.
+func DefaultWordlist() []string {
+	words, _ := ParseWordlist(strings.NewReader(defaultWordlist))
+	return words
+}
+
+// ParseWordlist reads a wordlist with one word per line. Blank lines and lines starting with # are ignored.
+func ParseWordlist(r io.Reader) ([]string, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Join(err, errors.New("failed to read wordlist"))
+	}
+	return words, nil
+}
+
+// ReadWordlistFile reads a wordlist file in the format of ParseWordlist.
+func ReadWordlistFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to open wordlist"))
+	}
+	defer file.Close()
+	return ParseWordlist(file)
+}
+
+// leetspeak maps the digits and symbols commonly used in place of letters to those letters
+var leetspeak = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'9': 'g',
+	'@': 'a',
+	'$': 's',
+	'!': 'i',
+	'|': 'l',
+	'+': 't',
+	'€': 'e',
+}
+
+// Punctuation trimmed from the ends of a word before it is matched, so that "word!" matches but "w!rd" is folded
+const (
+	leadingPunctuation  = `("'[{<*_`
+	trailingPunctuation = `.,!?;:)"']}>*_`
+)
+
+// WordlistFilter catches the words of a wordlist, like profanity and slurs, and flags, masks or rejects the comments
+// using them. Words are matched as whole words, after lowercasing and folding accents and leetspeak, so "Sh!t" and
+// "shït" match "shit" but "Scunthorpe" doesn't match anything. A word with letters repeated ("shiiit") matches too.
+type WordlistFilter struct {
+	Action Action
+
+	// words holds the folded words, and collapsed maps each folded word with its repeated letters collapsed to the
+	// length of the shortest word it comes from
+	words     map[string]bool
+	collapsed map[string]int
+}
+
+// NewWordlistFilter returns a WordlistFilter catching the given words.
+func NewWordlistFilter(words []string, action Action) *WordlistFilter {
+	filter := &WordlistFilter{
+		Action:    action,
+		words:     map[string]bool{},
+		collapsed: map[string]int{},
+	}
+	for _, word := range words {
+		folded := foldWord(word)
+		if folded == "" {
+			continue
+		}
+		filter.words[folded] = true
+		key := collapseRepeats(folded)
+		if length, ok := filter.collapsed[key]; !ok || len(folded) < length {
+			filter.collapsed[key] = len(folded)
+		}
+	}
+	return filter
+}
+
+func (filter *WordlistFilter) Filter(comment *Comment) Decision {
+	username, usernameMatched := filter.mask(comment.Username)
+	commentText, textMatched := filter.mask(comment.CommentText)
+	if !usernameMatched && !textMatched {
+		return Decision{Action: Allow}
+	}
+
+	decision := Decision{Action: filter.Action, Reason: "profanity"}
+	switch filter.Action {
+	case Mask:
+		comment.Username = username
+		comment.CommentText = commentText
+	case Reject:
+		decision.Message = "Comment contains words that aren't allowed"
+	}
+	return decision
+}
+
+// mask returns the text with the words of the wordlist replaced by asterisks, and whether there were any.
+func (filter *WordlistFilter) mask(text string) (string, bool) {
+	runes := []rune(text)
+	matched := false
+	for start := 0; start < len(runes); {
+		if unicode.IsSpace(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+
+		// Leave the punctuation around the word alone
+		wordStart, wordEnd := start, end
+		for wordStart < wordEnd && strings.ContainsRune(leadingPunctuation, runes[wordStart]) {
+			wordStart++
+		}
+		for wordEnd > wordStart && strings.ContainsRune(trailingPunctuation, runes[wordEnd-1]) {
+			wordEnd--
+		}
+
+		if filter.matches(string(runes[wordStart:wordEnd])) {
+			matched = true
+			for i := wordStart; i < wordEnd; i++ {
+				runes[i] = '*'
+			}
+		}
+		start = end
+	}
+	return string(runes), matched
+}
+
+// matches reports whether a word is in the wordlist, or is a word of the wordlist with letters repeated.
+func (filter *WordlistFilter) matches(word string) bool {
+	folded := foldWord(word)
+	if folded == "" {
+		return false
+	}
+	if filter.words[folded] {
+		return true
+	}
+	length, ok := filter.collapsed[collapseRepeats(folded)]
+	return ok && len(folded) > length
+}
+
+// foldWord lowercases a word, removes its accents, replaces leetspeak with the letters it stands for, and drops
+// anything else that isn't a letter.
+func foldWord(word string) string {
+	var builder strings.Builder
+	for _, r := range norm.NFKD.String(word) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if letter, ok := leetspeak[r]; ok {
+			r = letter
+		}
+		if unicode.IsLetter(r) {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// collapseRepeats replaces every run of the same letter with a single one.
+func collapseRepeats(word string) string {
+	var builder strings.Builder
+	var previous rune
+	for i, r := range word {
+		if i > 0 && r == previous {
+			continue
+		}
+		builder.WriteRune(r)
+		previous = r
+	}
+	return builder.String()
+}
@@ -0,0 +1,135 @@
+// The listing package turns the listing URLs and IDs sent by clients into canonical listing keys, like
+// "zillow:12345", so that the comments on a listing are found whichever way the client referred to it.
+package listing
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalid is returned for URLs and IDs that don't refer to a listing on a supported site.
+var ErrInvalid = errors.New("invalid listing")
+
+// Key identifies a listing on a site. Its string form, "<site>:<id>", is what comments are stored under.
+type Key struct {
+	Site string
+	ID   string
+}
+
+func (key Key) String() string {
+	return key.Site + ":" + key.ID
+}
+
+// site describes how to recognize the listings of a real estate site. Supporting another site means adding it
+// to sites.
+type site struct {
+	// name is the site part of the keys
+	name string
+
+	// domain is the site's domain. URLs on it and its subdomains are parsed with pathPatterns.
+	domain string
+
+	// pathPatterns match the paths of listing URLs, with the listing ID as their first group
+	pathPatterns []*regexp.Regexp
+
+	// idPattern matches a valid listing ID
+	idPattern *regexp.Regexp
+}
+
+// sites lists the supported sites
+var sites = []site{
+	{
+		// https://www.zillow.com/homedetails/123-Main-St-Springfield-IL-62701/12345_zpid/
+		name:         "zillow",
+		domain:       "zillow.com",
+		pathPatterns: []*regexp.Regexp{regexp.MustCompile(`/(\d{1,15})_zpid(?:/|$)`)},
+		idPattern:    regexp.MustCompile(`^\d{1,15}$`),
+	},
+	{
+		// https://www.redfin.com/IL/Springfield/123-Main-St-62701/home/12345
+		name:         "redfin",
+		domain:       "redfin.com",
+		pathPatterns: []*regexp.Regexp{regexp.MustCompile(`/home/(\d{1,15})(?:/|$)`)},
+		idPattern:    regexp.MustCompile(`^\d{1,15}$`),
+	},
+	{
+		// https://www.realtor.com/realestateandhomes-detail/123-Main-St_Springfield_IL_62701_M12345-67890
+		name:         "realtor",
+		domain:       "realtor.com",
+		pathPatterns: []*regexp.Regexp{regexp.MustCompile(`/realestateandhomes-detail/[^/]*_(M\d{1,15}-\d{1,15})(?:/|$)`)},
+		idPattern:    regexp.MustCompile(`^M\d{1,15}-\d{1,15}$`),
+	},
+	{
+		// https://www.trulia.com/p/il/springfield/123-main-st-springfield-il-62701--12345
+		// https://www.trulia.com/home/123-main-st-springfield-il-62701-12345
+		// The ID of /p/ pages comes after a double dash, so that the ZIP code of an address alone isn't taken for it.
+		name:   "trulia",
+		domain: "trulia.com",
+		pathPatterns: []*regexp.Regexp{
+			regexp.MustCompile(`^/p/[^/]+/[^/]+/[^/]*--(\d{1,15})/?$`),
+			regexp.MustCompile(`^/home/[^/]*[^\d/](\d{1,15})/?$`),
+		},
+		idPattern: regexp.MustCompile(`^\d{1,15}$`),
+	},
+}
+
+// Parse canonicalizes a listing URL, a listing key, or a bare Zillow listing ID (zpid), which is what clients sent
+// before listing keys existed.
+func Parse(value string) (Key, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.Contains(value, "/"):
+		return ParseURL(value)
+	case strings.Contains(value, ":"):
+		return ParseKey(value)
+	default:
+		return ParseKey("zillow:" + value)
+	}
+}
+
+// ParseKey parses a listing key, as returned by Key.String.
+func ParseKey(value string) (Key, error) {
+	name, id, ok := strings.Cut(value, ":")
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %q is not a listing key", ErrInvalid, value)
+	}
+	for _, site := range sites {
+		if strings.EqualFold(name, site.name) {
+			if !site.idPattern.MatchString(id) {
+				return Key{}, fmt.Errorf("%w: %q is not a %s listing ID", ErrInvalid, id, site.name)
+			}
+			return Key{Site: site.name, ID: id}, nil
+		}
+	}
+	return Key{}, fmt.Errorf("%w: unsupported site %q", ErrInvalid, name)
+}
+
+// ParseURL parses the URL of a listing page. URLs without a scheme, like "zillow.com/homedetails/12345_zpid/",
+// are accepted too.
+func ParseURL(value string) (Key, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return Key{}, fmt.Errorf("%w: %q is not a listing URL", ErrInvalid, value)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	for _, site := range sites {
+		if host != site.domain && !strings.HasSuffix(host, "."+site.domain) {
+			continue
+		}
+		for _, pathPattern := range site.pathPatterns {
+			if match := pathPattern.FindStringSubmatch(parsed.Path); match != nil {
+				return Key{Site: site.name, ID: match[1]}, nil
+			}
+		}
+		return Key{}, fmt.Errorf("%w: %q is not a %s listing page", ErrInvalid, value, site.name)
+	}
+	return Key{}, fmt.Errorf("%w: unsupported site %q", ErrInvalid, host)
+}
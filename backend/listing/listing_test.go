@@ -0,0 +1,59 @@
+package listing
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		// Listing keys and bare Zillow IDs
+		{"zillow:12345", "zillow:12345"},
+		{"Redfin:12345", "redfin:12345"},
+		{"realtor:M12345-67890", "realtor:M12345-67890"},
+		{" 12345 ", "zillow:12345"},
+
+		// Listing URLs, with or without a scheme
+		{"https://www.zillow.com/homedetails/123-Main-St-Springfield-IL-62701/12345_zpid/", "zillow:12345"},
+		{"zillow.com/homedetails/12345_zpid", "zillow:12345"},
+		{"https://www.redfin.com/IL/Springfield/123-Main-St-62701/home/12345", "redfin:12345"},
+		{"https://www.realtor.com/realestateandhomes-detail/123-Main-St_Springfield_IL_62701_M12345-67890", "realtor:M12345-67890"},
+		{"https://www.trulia.com/p/il/springfield/123-main-st-springfield-il-62701--12345", "trulia:12345"},
+		{"https://www.trulia.com/home/123-main-st-springfield-il-62701-12345", "trulia:12345"},
+		{"http://WWW.TRULIA.COM./home/123-main-st-springfield-il-62701-12345/", "trulia:12345"},
+	}
+	for _, test := range tests {
+		key, err := Parse(test.value)
+		if err != nil || key.String() != test.want {
+			t.Errorf("Parse(%q) = %v, %v, want %s", test.value, key, err, test.want)
+		}
+	}
+}
+
+func TestParseRejectsOtherValues(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"abc",
+		"zillow:",
+		"zillow:12a",
+		"realtor:12345",
+		"craigslist:12345",
+		"1234567890123456",
+		"ftp://www.zillow.com/homedetails/12345_zpid/",
+		"https://www.zillow.com/homes/Springfield-IL/",
+		"https://www.zillow.com.example.com/homedetails/12345_zpid/",
+		"https://evilzillow.com/homedetails/12345_zpid/",
+		// Without the double dash, the number is the ZIP code of the address
+		"https://www.trulia.com/p/il/springfield/123-main-st-springfield-il-62701",
+		"https://www.trulia.com/p/il/springfield/123-main-st-springfield-il-62701-12345",
+		"https://www.example.com/home/12345",
+	} {
+		key, err := Parse(value)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %v, %v, want ErrInvalid", value, key, err)
+		}
+	}
+}
@@ -1,38 +1,262 @@
 package main
 
 import (
-	//"fmt"
-	//"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	//server_app "server/router"
-
-	"log"
+	"zillow-commenter.com/m/api"
+	"zillow-commenter.com/m/buildinfo"
+	"zillow-commenter.com/m/config"
+	"zillow-commenter.com/m/db/postgres/migrations"
+	"zillow-commenter.com/m/logging"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"zillow-commenter.com/m/api"
+	"github.com/gin-gonic/gin"
 )
 
-var server *api.Server
+// shutdownTimeout is how long in-flight requests get to finish once the standalone server is asked to stop
+const shutdownTimeout = 15 * time.Second
+
+// readHeaderTimeout is how long clients of the standalone server get to send a request's headers, so that slow
+// clients can't hold connections open forever
+const readHeaderTimeout = 10 * time.Second
+
+func main() {
+	// Load the settings from the config file, .env and the environment before reading the defaults of the flags
+	cfg, err := config.Load()
+
+	// Log as JSON, with the default settings if they couldn't be loaded. Gin's own debug output isn't JSON, so it is
+	// only shown when asked for through GIN_MODE.
+	logConfig := config.Default().Log
+	if err == nil {
+		logConfig = cfg.Log
+	}
+	logging.Setup(os.Stdout, logConfig.Level, logConfig.HashKey)
+	if err != nil {
+		fatal("Could not load the configuration", err)
+	}
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Flags take precedence over the config
+	flag.StringVar(&cfg.Server.Mode, "mode", cfg.Server.Mode, "how to serve the API: lambda, http or https (env SERVER_MODE)")
+	flag.StringVar(&cfg.Server.Address, "addr", cfg.Server.Address, "address to listen on in http and https modes (env SERVER_ADDRESS)")
+	flag.StringVar(&cfg.Server.TLSCertFile, "cert", cfg.Server.TLSCertFile, "TLS certificate file for https mode (env TLS_CERT_FILE)")
+	flag.StringVar(&cfg.Server.TLSKeyFile, "key", cfg.Server.TLSKeyFile, "TLS private key file for https mode (env TLS_KEY_FILE)")
+	flag.BoolVar(&cfg.Database.AutoMigrate, "auto-migrate", cfg.Database.AutoMigrate, "apply pending migrations before starting the server (env AUTO_MIGRATE)")
+	flag.Parse()
+
+	// Print the settings, with their secrets redacted, rather than serving the API
+	if flag.Arg(0) == "print-config" {
+		fmt.Print(cfg)
+		if err := cfg.Validate(); err != nil {
+			fatal("Invalid configuration", err)
+		}
+		return
+	}
+
+	// Migrations //
+	connectionString := cfg.Database.ConnectionString
+	if flag.Arg(0) == "migrate" {
+		err = runMigrate(connectionString, flag.Arg(1))
+		if err != nil {
+			fatal("Could not run migrations", err)
+		}
+		return
+	}
+	if cfg.Database.AutoMigrate && connectionString != "" {
+		err = migrations.Up(connectionString)
+		if err != nil {
+			fatal("Could not migrate the database", err)
+		}
+	}
 
-func init() {
 	// Server //
-	var err error
-	server, err = api.GetNewServer()
+	server, err := api.GetNewServer(cfg)
 	if err != nil {
-		log.Fatal("Could not start the server")
+		fatal("Could not start the server", err)
+	}
+
+	// Run the retention job once, e.g. from a scheduled task, rather than serving the API
+	if flag.Arg(0) == "purge-deleted" {
+		purged, err := server.PurgeDeletedComments(context.Background())
+		server.Close()
+		if err != nil {
+			fatal("Could not purge deleted comments", err)
+		}
+		slog.Info("purged deleted comments", slog.Int64("purged", purged))
+		return
+	}
+
+	// Send the subscription digests once, e.g. from a scheduled task, rather than serving the API
+	if flag.Arg(0) == "send-digests" {
+		sent, err := server.SendDigests(context.Background())
+		server.Close()
+		if err != nil {
+			fatal("Could not send digests", err)
+		}
+		slog.Info("sent digests", slog.Int("sent", sent))
+		return
+	}
+
+	// Send the due webhook deliveries once, e.g. from a scheduled task, rather than serving the API
+	if flag.Arg(0) == "deliver-webhooks" {
+		attempted, err := server.DeliverWebhooks(context.Background())
+		server.Close()
+		if err != nil {
+			fatal("Could not deliver webhooks", err)
+		}
+		slog.Info("delivered webhooks", slog.Int("attempted", attempted))
+		return
+	}
+
+	switch cfg.Server.Mode {
+	case config.ModeLambda:
+		// Proxy the server to AWS Lambda
+		if server.LambdaAdapter == nil {
+			fatal("LambdaAdapter is not initialized", nil)
+		}
+		// CloudWatch picks the metrics out of the logs
+		server.WriteEMFMetrics(os.Stdout, cfg.Metrics.Namespace)
+		lambda.Start(server.LambdaAdapter.ProxyWithContext)
+	case config.ModeHTTP, config.ModeHTTPS:
+		server.ServePrometheusMetrics()
+		err = runStandalone(server, cfg.Server)
+		if err != nil {
+			fatal("Server stopped with error", err)
+		}
+	default:
+		fatal(fmt.Sprintf("Unknown server mode %q: must be %s, %s or %s", cfg.Server.Mode, config.ModeLambda, config.ModeHTTP, config.ModeHTTPS), nil)
 	}
 }
 
-func main() {
-	/* // Start server listening on port 3000 for HTTPS connections
-	server.Router.RunTLS(":3000", "./ssl/public_certificate.pem", "./ssl/private_key.pem")
+// runStandalone serves the router over HTTP or HTTPS until SIGINT or SIGTERM, then drains in-flight requests
+// and closes the server's resources.
+func runStandalone(server *api.Server, serverConfig config.ServerConfig) error {
+	// There is no WriteTimeout, which would cut the SSE streams off
+	httpServer := &http.Server{
+		Addr:              serverConfig.Address,
+		Handler:           server.Router,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	// Start listening in the background so that we can wait for a shutdown signal
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("serving", slog.String("mode", serverConfig.Mode), slog.String("address", serverConfig.Address), slog.String("commit", buildinfo.Get().Commit))
+		if serverConfig.Mode == config.ModeHTTPS {
+			serveErr <- httpServer.ListenAndServeTLS(serverConfig.TLSCertFile, serverConfig.TLSKeyFile)
+		} else {
+			serveErr <- httpServer.ListenAndServe()
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Long-running servers purge the expired deleted comments themselves
+	retentionDone := make(chan struct{})
+	go func() {
+		server.RunRetentionJob(ctx)
+		close(retentionDone)
+	}()
+
+	// The Lambda adapter can't hold streams open, so only the standalone server streams comments
+	streamDone := make(chan struct{})
+	go func() {
+		server.RunCommentStream(ctx)
+		close(streamDone)
+	}()
+
+	// Long-running servers send the subscription digests themselves, if they can send emails
+	digestDone := make(chan struct{})
+	go func() {
+		server.RunDigestJob(ctx)
+		close(digestDone)
+	}()
+
+	// Long-running servers deliver the queued webhook events themselves
+	webhookDone := make(chan struct{})
+	go func() {
+		server.RunWebhookDispatcher(ctx)
+		close(webhookDone)
+	}()
+
+	select {
+	case err := <-serveErr:
+		// The server failed to start or stopped on its own
+		stop()
+		<-retentionDone
+		<-streamDone
+		<-digestDone
+		<-webhookDone
+		server.Close()
+		return err
+	case <-ctx.Done():
+		slog.Info("shutting down, waiting for in-flight requests to finish")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := httpServer.Shutdown(shutdownCtx)
+
+	// Close the database pool only once no request or job can use it anymore
+	<-retentionDone
+	<-streamDone
+	<-digestDone
+	<-webhookDone
+	server.Close()
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return err
+}
+
+// runMigrate runs a migrate subcommand (up, down or status) against the database and prints the resulting status.
+func runMigrate(connectionString, command string) error {
+	if connectionString == "" {
+		return errors.New("CONNECTION_STRING must be set to run migrations")
+	}
+
+	var err error
+	switch command {
+	case "up":
+		err = migrations.Up(connectionString)
+	case "down":
+		err = migrations.Down(connectionString)
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q: must be up, down or status", command)
+	}
 	if err != nil {
-		log.Fatal("Could not start the server")
-	} */
+		return err
+	}
+
+	status, err := migrations.GetStatus(connectionString)
+	if err != nil {
+		return err
+	}
+	slog.Info("database schema", slog.Uint64("version", uint64(status.Version)), slog.Uint64("expected", uint64(status.Expected)),
+		slog.Bool("dirty", status.Dirty), slog.String("status", status.String()))
+	return nil
+}
 
-	// Proxy the server to AWS Lambda
-	if server.LambdaAdapter == nil {
-		log.Fatal("LambdaAdapter is not initialized")
+// fatal logs the error that keeps the application from running and exits.
+func fatal(message string, err error) {
+	if err != nil {
+		slog.Error(message, logging.Error(err))
+	} else {
+		slog.Error(message)
 	}
-	lambda.Start(server.LambdaAdapter.ProxyWithContext)
+	os.Exit(1)
 }
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"zillow-commenter.com/m/logging"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// emfPoolInterval is how often the EMF recorder writes the statistics of the pool, along with a request
+const emfPoolInterval = time.Minute
+
+// EMF is a Recorder that writes every metric as a CloudWatch Embedded Metric Format line, for Lambda, where CloudWatch
+// turns the lines it finds in the logs into metrics.
+type EMF struct {
+	namespace string
+
+	mu sync.Mutex
+	w  io.Writer
+
+	// pool is the pool whose statistics are written, and lastPool what they were when last written, to write the
+	// counters as deltas
+	pool          *pgxpool.Pool
+	lastPoolWrite time.Time
+	lastPool      poolCounters
+}
+
+// poolCounters are the cumulative statistics of a pool
+type poolCounters struct {
+	acquires        int64
+	emptyAcquires   int64
+	acquireDuration time.Duration
+}
+
+// emfMetric is a metric of an EMF line, with its value
+type emfMetric struct {
+	name  string
+	unit  string
+	value float64
+}
+
+// NewEMF returns an EMF recorder writing to w, under the given CloudWatch namespace.
+func NewEMF(w io.Writer, namespace string) *EMF {
+	return &EMF{
+		namespace: namespace,
+		w:         w,
+	}
+}
+
+// RegisterPool adds the statistics of a Postgres pool to the metrics. They are written at most every
+// emfPoolInterval, when a request is handled, since Lambda runs nothing in between.
+func (recorder *EMF) RegisterPool(pool *pgxpool.Pool) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.pool = pool
+}
+
+func (recorder *EMF) ObserveRequest(method, route string, status int, duration time.Duration) {
+	recorder.write(map[string]string{"Method": method, "Route": route, "Status": strconv.Itoa(status)},
+		emfMetric{"Requests", "Count", 1},
+		emfMetric{"Latency", "Milliseconds", float64(duration.Microseconds()) / 1000},
+	)
+	recorder.writePoolIfDue()
+}
+
+func (recorder *EMF) CommentPosted(listingID string) {
+	site, bucket := listingBucket(listingID)
+	recorder.write(map[string]string{"Site": site, "ListingBucket": bucket}, emfMetric{"CommentsPosted", "Count", 1})
+}
+
+func (recorder *EMF) CommentRejected(reason string) {
+	recorder.write(map[string]string{"Reason": reason}, emfMetric{"CommentPostsRejected", "Count", 1})
+}
+
+// writePoolIfDue writes the statistics of the pool if they weren't written for emfPoolInterval. Counters are
+// written as their increase since the last time.
+func (recorder *EMF) writePoolIfDue() {
+	recorder.mu.Lock()
+	if recorder.pool == nil || time.Since(recorder.lastPoolWrite) < emfPoolInterval {
+		recorder.mu.Unlock()
+		return
+	}
+	stat := recorder.pool.Stat()
+	counters := poolCounters{
+		acquires:        stat.AcquireCount(),
+		emptyAcquires:   stat.EmptyAcquireCount(),
+		acquireDuration: stat.AcquireDuration(),
+	}
+	last := recorder.lastPool
+	recorder.lastPoolWrite = time.Now()
+	recorder.lastPool = counters
+	recorder.mu.Unlock()
+
+	recorder.write(nil,
+		emfMetric{"DBAcquiredConnections", "Count", float64(stat.AcquiredConns())},
+		emfMetric{"DBIdleConnections", "Count", float64(stat.IdleConns())},
+		emfMetric{"DBTotalConnections", "Count", float64(stat.TotalConns())},
+		emfMetric{"DBAcquires", "Count", float64(counters.acquires - last.acquires)},
+		emfMetric{"DBEmptyAcquires", "Count", float64(counters.emptyAcquires - last.emptyAcquires)},
+		emfMetric{"DBAcquireDuration", "Milliseconds", float64((counters.acquireDuration - last.acquireDuration).Microseconds()) / 1000},
+	)
+}
+
+// write writes an EMF line with the given dimensions and metrics. Failing to write is only logged.
+func (recorder *EMF) write(dimensions map[string]string, metrics ...emfMetric) {
+	dimensionNames := []string{}
+	line := map[string]any{}
+	for name, value := range dimensions {
+		dimensionNames = append(dimensionNames, name)
+		line[name] = value
+	}
+	slices.Sort(dimensionNames)
+
+	definitions := make([]map[string]string, 0, len(metrics))
+	for _, metric := range metrics {
+		definitions = append(definitions, map[string]string{"Name": metric.name, "Unit": metric.unit})
+		line[metric.name] = metric.value
+	}
+
+	line["_aws"] = map[string]any{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]any{{
+			"Namespace":  recorder.namespace,
+			"Dimensions": [][]string{dimensionNames},
+			"Metrics":    definitions,
+		}},
+	}
+
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		slog.Warn("failed to encode EMF metrics", logging.Error(err))
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	_, err = recorder.w.Write(append(encoded, '\n'))
+	if err != nil {
+		slog.Warn("failed to write EMF metrics", logging.Error(err))
+	}
+}
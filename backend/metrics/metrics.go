@@ -0,0 +1,44 @@
+// The metrics package records what the API is doing: the requests it handles, the comments posted and rejected, and
+// the state of the Postgres pool. The standalone server exposes them to Prometheus, and Lambda writes them as
+// CloudWatch Embedded Metric Format log lines.
+package metrics
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// listingBuckets is how many buckets the listings of each site are spread over. Labeling comments with a bucket
+// rather than their listing keeps the number of series bounded, while still showing when a few listings get most of
+// the comments.
+const listingBuckets = 16
+
+// Recorder records the metrics of the API. Its methods must be safe to call concurrently.
+type Recorder interface {
+	// ObserveRequest records a handled request. route is the route pattern, e.g. "/api/v1/comments/:listing_id".
+	ObserveRequest(method, route string, status int, duration time.Duration)
+	// CommentPosted records a comment posted on a listing.
+	CommentPosted(listingID string)
+	// CommentRejected records a post refused for the given reason, e.g. "comment_too_long" or "rate_limited".
+	CommentRejected(reason string)
+}
+
+// Nop is a Recorder that records nothing, for servers that don't expose metrics.
+type Nop struct{}
+
+func (Nop) ObserveRequest(string, string, int, time.Duration) {}
+func (Nop) CommentPosted(string)                              {}
+func (Nop) CommentRejected(string)                            {}
+
+// listingBucket returns the site of a listing key and the bucket it falls in.
+func listingBucket(listingID string) (site, bucket string) {
+	site, _, ok := strings.Cut(listingID, ":")
+	if !ok {
+		site = "unknown"
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(listingID))
+	return site, fmt.Sprintf("%02d", hash.Sum32()%listingBuckets)
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of the Prometheus metrics
+const namespace = "commenter"
+
+// Prometheus is a Recorder that keeps the metrics in a Prometheus registry, along with the Go runtime and process
+// metrics, for Handler to serve.
+type Prometheus struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	commentsPosted   *prometheus.CounterVec
+	commentsRejected *prometheus.CounterVec
+}
+
+// NewPrometheus returns a Prometheus recorder with a registry of its own.
+func NewPrometheus() *Prometheus {
+	recorder := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Requests handled, by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle requests, by method, route and status.",
+			Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}, []string{"method", "route", "status"}),
+		commentsPosted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "comments_posted_total",
+			Help:      "Comments posted, by listing site and bucket of listings.",
+		}, []string{"site", "listing_bucket"}),
+		commentsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "comment_posts_rejected_total",
+			Help:      "Comment posts refused, by reason.",
+		}, []string{"reason"}),
+	}
+
+	recorder.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		recorder.requests,
+		recorder.requestDuration,
+		recorder.commentsPosted,
+		recorder.commentsRejected,
+	)
+	return recorder
+}
+
+// RegisterPool adds the statistics of a Postgres pool to the metrics.
+func (recorder *Prometheus) RegisterPool(pool *pgxpool.Pool) {
+	recorder.registry.MustRegister(newPoolCollector(pool))
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (recorder *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(recorder.registry, promhttp.HandlerOpts{})
+}
+
+func (recorder *Prometheus) ObserveRequest(method, route string, status int, duration time.Duration) {
+	statusLabel := strconv.Itoa(status)
+	recorder.requests.WithLabelValues(method, route, statusLabel).Inc()
+	recorder.requestDuration.WithLabelValues(method, route, statusLabel).Observe(duration.Seconds())
+}
+
+func (recorder *Prometheus) CommentPosted(listingID string) {
+	site, bucket := listingBucket(listingID)
+	recorder.commentsPosted.WithLabelValues(site, bucket).Inc()
+}
+
+func (recorder *Prometheus) CommentRejected(reason string) {
+	recorder.commentsRejected.WithLabelValues(reason).Inc()
+}
+
+// poolCollector reads the statistics of a Postgres pool whenever the metrics are collected.
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns    *prometheus.Desc
+	idleConns        *prometheus.Desc
+	totalConns       *prometheus.Desc
+	maxConns         *prometheus.Desc
+	acquires         *prometheus.Desc
+	emptyAcquires    *prometheus.Desc
+	canceledAcquires *prometheus.Desc
+	acquireDuration  *prometheus.Desc
+	emptyAcquireWait *prometheus.Desc
+}
+
+func newPoolCollector(pool *pgxpool.Pool) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		pool:             pool,
+		acquiredConns:    desc("acquired_connections", "Connections currently in use."),
+		idleConns:        desc("idle_connections", "Connections currently idle."),
+		totalConns:       desc("total_connections", "Connections currently open, in use, idle or being opened."),
+		maxConns:         desc("max_connections", "Most connections the pool opens."),
+		acquires:         desc("acquires_total", "Connections acquired from the pool."),
+		emptyAcquires:    desc("empty_acquires_total", "Acquires that had to wait for a connection to be opened or released."),
+		canceledAcquires: desc("canceled_acquires_total", "Acquires canceled by their context."),
+		acquireDuration:  desc("acquire_duration_seconds_total", "Time spent acquiring connections, waits included."),
+		emptyAcquireWait: desc("empty_acquire_wait_seconds_total", "Time spent waiting for a connection in empty acquires."),
+	}
+}
+
+func (collector *poolCollector) Describe(descs chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(collector, descs)
+}
+
+func (collector *poolCollector) Collect(metrics chan<- prometheus.Metric) {
+	stat := collector.pool.Stat()
+	metrics <- prometheus.MustNewConstMetric(collector.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	metrics <- prometheus.MustNewConstMetric(collector.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	metrics <- prometheus.MustNewConstMetric(collector.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	metrics <- prometheus.MustNewConstMetric(collector.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	metrics <- prometheus.MustNewConstMetric(collector.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	metrics <- prometheus.MustNewConstMetric(collector.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	metrics <- prometheus.MustNewConstMetric(collector.canceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	metrics <- prometheus.MustNewConstMetric(collector.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	metrics <- prometheus.MustNewConstMetric(collector.emptyAcquireWait, prometheus.CounterValue, stat.EmptyAcquireWaitTime().Seconds())
+}
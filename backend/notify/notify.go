@@ -0,0 +1,33 @@
+// The notify package delivers the notifications of listing subscriptions: the digests of new comments, and the
+// messages asking subscribers to verify their email.
+package notify
+
+import (
+	"context"
+
+	"zillow-commenter.com/m/api/models"
+)
+
+// Digest holds the comments posted on a listing since its subscriber was last notified, oldest first.
+// Email is only set if the subscriber verified it.
+type Digest struct {
+	ListingID      string
+	UserID         string
+	Email          string
+	Comments       []models.Comment
+	UnsubscribeURL string
+}
+
+// Verification asks a subscriber to verify the email of their subscription by following VerifyURL.
+type Verification struct {
+	ListingID string
+	Email     string
+	VerifyURL string
+}
+
+// Notifier delivers the notifications of listing subscriptions. A Notifier that can't reach a subscriber, e.g.
+// an email notifier for a digest without an email, skips it without error.
+type Notifier interface {
+	SendDigest(ctx context.Context, digest Digest) error
+	SendVerification(ctx context.Context, verification Verification) error
+}
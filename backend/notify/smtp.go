@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTPConfig holds the settings of an SMTPNotifier. Username and Password are optional; if set, the server must
+// offer STARTTLS unless it is on localhost, since net/smtp refuses to send them in the clear.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// smtpTimeout bounds each email sent, so that an unresponsive server doesn't hold up the digest job
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier sends the notifications as plain text emails through an SMTP server.
+type SMTPNotifier struct {
+	host    string
+	address string
+	auth    smtp.Auth
+	from    *mail.Address
+}
+
+// NewSMTPNotifier returns an SMTPNotifier sending through the configured server.
+func NewSMTPNotifier(config SMTPConfig) (*SMTPNotifier, error) {
+	if config.Host == "" {
+		return nil, errors.New("missing SMTP host")
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP sender %q: %w", config.From, err)
+	}
+
+	notifier := &SMTPNotifier{
+		host:    config.Host,
+		address: net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		from:    from,
+	}
+	if config.Username != "" {
+		notifier.auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	return notifier, nil
+}
+
+func (notifier *SMTPNotifier) SendDigest(ctx context.Context, digest Digest) error {
+	if digest.Email == "" || len(digest.Comments) == 0 {
+		return nil
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "New comments on listing %s:\n\n", digest.ListingID)
+	for _, comment := range digest.Comments {
+		posted := time.UnixMicro(comment.Timestamp).UTC().Format("Jan 2, 15:04 MST")
+		fmt.Fprintf(&body, "%s (%s):\n%s\n\n", comment.Username, posted, comment.CommentText)
+	}
+	fmt.Fprintf(&body, "-- \nYou get these emails because you subscribed to this listing. Unsubscribe: %s\n", digest.UnsubscribeURL)
+
+	subject := fmt.Sprintf("%d new comments on a listing you follow", len(digest.Comments))
+	if len(digest.Comments) == 1 {
+		subject = "A new comment on a listing you follow"
+	}
+	headers := map[string]string{
+		// Let mail clients offer a one-click unsubscribe (RFC 8058)
+		"List-Unsubscribe":      "<" + digest.UnsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	return notifier.send(ctx, digest.Email, subject, headers, body.String())
+}
+
+func (notifier *SMTPNotifier) SendVerification(ctx context.Context, verification Verification) error {
+	body := fmt.Sprintf("Someone subscribed this address to the comments on listing %s.\n\n"+
+		"To get the new comments by email, verify your address: %s\n\n"+
+		"If it wasn't you, ignore this email and you won't hear from us again.\n",
+		verification.ListingID, verification.VerifyURL)
+	return notifier.send(ctx, verification.Email, "Verify your email address", nil, body)
+}
+
+// send sends a plain text email.
+func (notifier *SMTPNotifier) send(ctx context.Context, to, subject string, headers map[string]string, body string) error {
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	message, err := notifier.buildMessage(recipient, subject, headers, body)
+	if err != nil {
+		return err
+	}
+	err = notifier.deliver(ctx, recipient.Address, message)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to send email"))
+	}
+	return nil
+}
+
+// deliver sends a message to a single recipient, like smtp.SendMail but within smtpTimeout and the context.
+func (notifier *SMTPNotifier) deliver(ctx context.Context, recipient string, message []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", notifier.address)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, notifier.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: notifier.host})
+		if err != nil {
+			return err
+		}
+	}
+	if notifier.auth != nil {
+		err = client.Auth(notifier.auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(notifier.from.Address)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(recipient)
+	if err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(message)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage formats an email with a quoted-printable UTF-8 body, so that any comment text can go in it.
+func (notifier *SMTPNotifier) buildMessage(recipient *mail.Address, subject string, headers map[string]string, body string) ([]byte, error) {
+	messageID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	_, domain, _ := strings.Cut(notifier.from.Address, "@")
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", notifier.from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", recipient.String())
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <%s@%s>\r\n", messageID, domain)
+	for key, value := range headers {
+		fmt.Fprintf(&message, "%s: %s\r\n", key, value)
+	}
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	writer := quotedprintable.NewWriter(&message)
+	_, err = writer.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
@@ -0,0 +1,320 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+)
+
+// fakeSMTPServer is an SMTP server that accepts every message, and keeps the commands and messages it got, the
+// messages with LF line endings. Like a local relay, it doesn't offer STARTTLS.
+type fakeSMTPServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	commands []string
+	messages []string
+}
+
+// newFakeSMTPServer starts a fakeSMTPServer on a free port of the loopback interface, until the test ends.
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTPServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// config returns the settings of an SMTPNotifier sending through the server.
+func (server *fakeSMTPServer) config() SMTPConfig {
+	address := server.listener.Addr().(*net.TCPAddr)
+	return SMTPConfig{
+		Host:     address.IP.String(),
+		Port:     address.Port,
+		Username: "mailer",
+		Password: "secret",
+		From:     "Zillow Commenter <notify@example.com>",
+	}
+}
+
+// serve speaks just enough SMTP to one client for net/smtp.
+func (server *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP fake")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		server.mu.Lock()
+		server.commands = append(server.commands, line)
+		server.mu.Unlock()
+
+		verb, _, _ := strings.Cut(strings.ToUpper(line), " ")
+		switch verb {
+		case "EHLO":
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			text.PrintfLine("235 2.7.0 Authentication successful")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.messages = append(server.messages, string(data))
+			server.mu.Unlock()
+			text.PrintfLine("250 2.0.0 Ok: queued")
+		case "QUIT":
+			text.PrintfLine("221 2.0.0 Bye")
+			return
+		case "STARTTLS":
+			text.PrintfLine("454 4.7.0 TLS not available")
+		default:
+			text.PrintfLine("250 2.0.0 Ok")
+		}
+	}
+}
+
+// received returns the commands and messages the server got so far.
+func (server *fakeSMTPServer) received() ([]string, []string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]string(nil), server.commands...), append([]string(nil), server.messages...)
+}
+
+// readMessage parses an email, and decodes its quoted-printable body.
+func readMessage(t *testing.T, raw string) (*mail.Message, string) {
+	t.Helper()
+	message, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("invalid message: %v\n%s", err, raw)
+	}
+	if encoding := message.Header.Get("Content-Transfer-Encoding"); encoding != "quoted-printable" {
+		t.Fatalf("Content-Transfer-Encoding = %q, want quoted-printable", encoding)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(message.Body))
+	if err != nil {
+		t.Fatalf("invalid quoted-printable body: %v", err)
+	}
+	return message, string(body)
+}
+
+func TestSMTPNotifierSendDigest(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	notifier, err := NewSMTPNotifier(server.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Long, non-ASCII and "=" text needs quoted-printable soft line breaks and escapes
+	commentText := "Très joli jardin, mais 2 + 2 = 4 et le prix est élevé. " + strings.Repeat("家", 40)
+	digest := Digest{
+		ListingID: "zillow:12345",
+		UserID:    "alice",
+		Email:     "alice@example.com",
+		Comments: []models.Comment{
+			{Username: "bob", CommentText: commentText, Timestamp: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC).UnixMicro()},
+		},
+		UnsubscribeURL: "https://comments.example.com/api/v1/listings/unsubscribe?token=abc",
+	}
+	err = notifier.SendDigest(context.Background(), digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commands, messages := server.received()
+	wantCommands := []string{
+		"AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00mailer\x00secret")),
+		"MAIL FROM:<notify@example.com>",
+		"RCPT TO:<alice@example.com>",
+		"DATA",
+		"QUIT",
+	}
+	if len(commands) != len(wantCommands)+1 || !strings.HasPrefix(commands[0], "EHLO ") {
+		t.Fatalf("commands = %q, want EHLO then %q", commands, wantCommands)
+	}
+	for i, want := range wantCommands {
+		if commands[i+1] != want {
+			t.Errorf("command %d = %q, want %q", i+1, commands[i+1], want)
+		}
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+
+	// Every line of the raw message fits the 78 characters of RFC 5322, the body's being quoted-printable
+	for _, line := range strings.Split(messages[0], "\n") {
+		if len(line) > 78 && !strings.HasPrefix(line, "List-Unsubscribe:") {
+			t.Errorf("line too long: %q", line)
+		}
+	}
+	if !strings.Contains(messages[0], "Tr=C3=A8s") || !strings.Contains(messages[0], "2 + 2 =3D 4") {
+		t.Errorf("body isn't quoted-printable:\n%s", messages[0])
+	}
+
+	message, body := readMessage(t, messages[0])
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHeaders := map[string]string{
+		"From":                  `"Zillow Commenter" <notify@example.com>`,
+		"To":                    "<alice@example.com>",
+		"Subject":               "A new comment on a listing you follow",
+		"MIME-Version":          "1.0",
+		"Content-Type":          "text/plain; charset=utf-8",
+		"List-Unsubscribe":      "<https://comments.example.com/api/v1/listings/unsubscribe?token=abc>",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	for key, want := range wantHeaders {
+		got := message.Header.Get(key)
+		if key == "Subject" {
+			got = subject
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if messageID := message.Header.Get("Message-ID"); !strings.HasSuffix(messageID, "@example.com>") {
+		t.Errorf("Message-ID = %q, want one at example.com", messageID)
+	}
+	if _, err := message.Header.Date(); err != nil {
+		t.Errorf("invalid Date: %v", err)
+	}
+
+	for _, want := range []string{
+		"New comments on listing zillow:12345:\n",
+		"bob (May 1, 12:30 UTC):\n" + commentText + "\n",
+		"Unsubscribe: https://comments.example.com/api/v1/listings/unsubscribe?token=abc\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSMTPNotifierSendVerification(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	config := server.config()
+	config.Username = ""
+	notifier, err := NewSMTPNotifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = notifier.SendVerification(context.Background(), Verification{
+		ListingID: "zillow:12345",
+		Email:     "alice@example.com",
+		VerifyURL: "https://comments.example.com/api/v1/listings/verify-email?token=abc",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commands, messages := server.received()
+	for _, command := range commands {
+		if strings.HasPrefix(command, "AUTH") || command == "STARTTLS" {
+			t.Errorf("unexpected command %q", command)
+		}
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	message, body := readMessage(t, messages[0])
+	if subject := message.Header.Get("Subject"); subject != "Verify your email address" {
+		t.Errorf("Subject = %q, want %q", subject, "Verify your email address")
+	}
+	if message.Header.Get("List-Unsubscribe") != "" {
+		t.Error("verification has a List-Unsubscribe header")
+	}
+	if !strings.Contains(body, "https://comments.example.com/api/v1/listings/verify-email?token=abc") {
+		t.Errorf("body doesn't contain the verification link:\n%s", body)
+	}
+}
+
+func TestSMTPNotifierSkipsDigestsWithoutEmail(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	notifier, err := NewSMTPNotifier(server.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = notifier.SendDigest(context.Background(), Digest{
+		ListingID: "zillow:12345",
+		Comments:  []models.Comment{{Username: "bob", CommentText: "hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commands, _ := server.received(); len(commands) != 0 {
+		t.Errorf("commands = %q, want no connection", commands)
+	}
+}
+
+func TestSMTPNotifierFailsOnRefusedRecipient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost ESMTP fake")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "RCPT") {
+				text.PrintfLine("550 5.1.1 No such user")
+				continue
+			}
+			text.PrintfLine("250 Ok")
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	notifier, err := NewSMTPNotifier(SMTPConfig{Host: "127.0.0.1", Port: port, From: "notify@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = notifier.SendVerification(context.Background(), Verification{Email: "nobody@example.com", VerifyURL: "https://example.com"})
+	if err == nil || !strings.Contains(err.Error(), "No such user") {
+		t.Errorf("SendVerification() error = %v, want the refusal of the recipient", err)
+	}
+}
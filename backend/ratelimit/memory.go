@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxMemoryBuckets is how many buckets the MemoryStore keeps before it starts dropping the ones that are full again
+const maxMemoryBuckets = 10000
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	limit     Limit
+}
+
+// MemoryStore keeps the token buckets in memory. Limits are only enforced per instance of the API,
+// which is fine for the standalone server but not under Lambda.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (store *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	current, ok := store.buckets[key]
+	if !ok {
+		if len(store.buckets) >= maxMemoryBuckets {
+			store.dropFullBuckets(now)
+		}
+		current = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		store.buckets[key] = current
+	}
+
+	var result Result
+	current.tokens, result = take(current.tokens, current.updatedAt, limit, now)
+	current.updatedAt = now
+	current.limit = limit
+
+	return result, nil
+}
+
+// dropFullBuckets removes the buckets that have refilled completely, since they behave like missing ones.
+// The caller must hold the lock.
+func (store *MemoryStore) dropFullBuckets(now time.Time) {
+	for key, current := range store.buckets {
+		if now.Sub(current.updatedAt) >= current.limit.Period {
+			delete(store.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"zillow-commenter.com/m/db/postgres/sqlc"
+	"zillow-commenter.com/m/logging"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// staleBucketAge is how long a bucket may go unused before it is deleted. Since no limit has a longer period,
+	// the bucket is full by then, which is the same as not existing.
+	staleBucketAge = MaxPeriod
+
+	// pruneInterval is how often each instance deletes the stale buckets
+	pruneInterval = time.Hour
+)
+
+// PostgresStore keeps the token buckets in the rate_limit_buckets table, so that every instance of the API
+// shares the same limits.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// NewPostgresStore returns a Store that keeps its buckets in the database behind the given pool.
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{
+		pool: pool,
+	}
+}
+
+func (store *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	store.pruneIfDue(ctx, now)
+
+	tx, err := store.pool.Begin(ctx)
+	if err != nil {
+		return Result{}, errors.Join(err, errors.New("failed to begin rate limit transaction"))
+	}
+	defer tx.Rollback(ctx)
+	queries := sqlc.New(tx)
+
+	// Make sure the bucket exists, then lock it
+	err = queries.CreateRateLimitBucket(ctx, sqlc.CreateRateLimitBucketParams{
+		BucketKey: key,
+		Tokens:    float64(limit.Burst),
+		UpdatedAt: pgtype.Timestamptz{Time: now, Valid: true},
+	})
+	if err != nil {
+		return Result{}, errors.Join(err, errors.New("failed to create rate limit bucket"))
+	}
+	row, err := queries.GetRateLimitBucketForUpdate(ctx, key)
+	if err != nil {
+		return Result{}, errors.Join(err, errors.New("failed to get rate limit bucket"))
+	}
+
+	tokens, result := take(row.Tokens, row.UpdatedAt.Time, limit, now)
+
+	err = queries.UpdateRateLimitBucket(ctx, sqlc.UpdateRateLimitBucketParams{
+		BucketKey: key,
+		Tokens:    tokens,
+		UpdatedAt: pgtype.Timestamptz{Time: now, Valid: true},
+	})
+	if err != nil {
+		return Result{}, errors.Join(err, errors.New("failed to update rate limit bucket"))
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return Result{}, errors.Join(err, errors.New("failed to commit rate limit transaction"))
+	}
+	return result, nil
+}
+
+// pruneIfDue deletes the stale buckets if this instance hasn't done so for pruneInterval.
+// Failing to prune is only logged, since it doesn't affect the limits.
+func (store *PostgresStore) pruneIfDue(ctx context.Context, now time.Time) {
+	store.mu.Lock()
+	if now.Sub(store.lastPruned) < pruneInterval {
+		store.mu.Unlock()
+		return
+	}
+	store.lastPruned = now
+	store.mu.Unlock()
+
+	_, err := sqlc.New(store.pool).DeleteStaleRateLimitBuckets(ctx, pgtype.Timestamptz{Time: now.Add(-staleBucketAge), Valid: true})
+	if err != nil {
+		slog.Warn("failed to prune rate limit buckets", logging.Error(err))
+	}
+}
@@ -0,0 +1,107 @@
+// The ratelimit package implements token-bucket rate limiting on top of a pluggable bucket store, so that limits can
+// be shared between instances of the API (e.g. Lambda instances) through Postgres.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPeriod is the longest period a limit can have. Stores may forget the buckets left unused for that long, which
+// are full again by then.
+const MaxPeriod = 24 * time.Hour
+
+// Limit is a token bucket: it holds up to Burst tokens and is refilled at Burst tokens per Period.
+// Every request takes one token, and is refused when the bucket is empty.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// Enabled reports whether the limit restricts anything. The zero Limit lets every request through.
+func (limit Limit) Enabled() bool {
+	return limit.Burst > 0 && limit.Period > 0
+}
+
+func (limit Limit) String() string {
+	if !limit.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", limit.Burst, limit.Period)
+}
+
+// ParseLimit parses a limit of the form "<burst>/<period>", e.g. "10/1m" for 10 requests per minute.
+// "off" and "0" disable the limit. The period can't be longer than MaxPeriod.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" || value == "0" {
+		return Limit{}, nil
+	}
+
+	burstPart, periodPart, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: must be of the form <burst>/<period>", value)
+	}
+	burst, err := strconv.Atoi(burstPart)
+	if err != nil || burst <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", value)
+	}
+	period, err := time.ParseDuration(periodPart)
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", value)
+	}
+	if period > MaxPeriod {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: period must be at most %s", value, MaxPeriod)
+	}
+
+	return Limit{Burst: burst, Period: period}, nil
+}
+
+// MarshalText formats the limit with String, so that it is written to configuration files like it is read.
+func (limit Limit) MarshalText() ([]byte, error) {
+	return []byte(limit.String()), nil
+}
+
+// UnmarshalText parses the limit with ParseLimit, so that it can be read from configuration files.
+func (limit *Limit) UnmarshalText(text []byte) error {
+	parsed, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*limit = parsed
+	return nil
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed bool
+
+	// RetryAfter is how long to wait before the bucket holds a token again. It is zero when the request is allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets.
+type Store interface {
+	// Take takes a token from the bucket with the given key, creating a full bucket if it doesn't exist yet.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// take refills a bucket holding the given tokens since it was last updated, then takes a token from it if it can.
+// It returns the tokens left in the bucket and the result.
+func take(tokens float64, updatedAt time.Time, limit Limit, now time.Time) (float64, Result) {
+	perSecond := float64(limit.Burst) / limit.Period.Seconds()
+
+	elapsed := max(now.Sub(updatedAt).Seconds(), 0)
+	tokens = math.Min(float64(limit.Burst), tokens+elapsed*perSecond)
+
+	if tokens >= 1 {
+		return tokens - 1, Result{Allowed: true}
+	}
+
+	retryAfter := time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	return tokens, Result{Allowed: false, RetryAfter: retryAfter}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{"10/1m", Limit{Burst: 10, Period: time.Minute}, false},
+		{" 20/10m ", Limit{Burst: 20, Period: 10 * time.Minute}, false},
+		{"1/24h", Limit{Burst: 1, Period: 24 * time.Hour}, false},
+		{"off", Limit{}, false},
+		{"0", Limit{}, false},
+		{"10", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"-1/1m", Limit{}, true},
+		{"ten/1m", Limit{}, true},
+		{"10/0s", Limit{}, true},
+		{"10/minute", Limit{}, true},
+		{"10/25h", Limit{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseLimit(test.value)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("ParseLimit(%q) = %v, %v, want %v, error %t", test.value, got, err, test.want, test.wantErr)
+		}
+		if err == nil && got.Enabled() {
+			reparsed, err := ParseLimit(got.String())
+			if err != nil || reparsed != got {
+				t.Errorf("ParseLimit(%q) = %v, %v, want %v back", got.String(), reparsed, err, got)
+			}
+		}
+	}
+}
+
+func TestTake(t *testing.T) {
+	limit := Limit{Burst: 2, Period: time.Minute}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// A full bucket lets the burst through, then refuses until a token is back, 30 seconds later
+	tokens, result := take(2, start, limit, start)
+	if !result.Allowed || tokens != 1 {
+		t.Fatalf("first take = %v, %+v, want allowed with 1 token left", tokens, result)
+	}
+	tokens, result = take(tokens, start, limit, start)
+	if !result.Allowed || tokens != 0 {
+		t.Fatalf("second take = %v, %+v, want allowed with 0 tokens left", tokens, result)
+	}
+	tokens, result = take(tokens, start, limit, start.Add(10*time.Second))
+	if result.Allowed || result.RetryAfter != 20*time.Second {
+		t.Fatalf("third take = %v, %+v, want refused for 20s", tokens, result)
+	}
+	_, result = take(tokens, start.Add(10*time.Second), limit, start.Add(30*time.Second))
+	if !result.Allowed {
+		t.Fatalf("take once refilled = %+v, want allowed", result)
+	}
+
+	// Buckets refill up to the burst, and not at all if the clock goes back
+	tokens, _ = take(0, start, limit, start.Add(time.Hour))
+	if tokens != 1 {
+		t.Errorf("tokens after an hour = %v, want the burst minus the one taken", tokens)
+	}
+	tokens, result = take(0, start, limit, start.Add(-time.Hour))
+	if result.Allowed || tokens != 0 {
+		t.Errorf("take with the clock gone back = %v, %+v, want refused", tokens, result)
+	}
+}
+
+func TestMemoryStoreKeepsBucketsApart(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	limit := Limit{Burst: 1, Period: time.Hour}
+
+	for _, key := range []string{"ip:192.0.2.1", "ip:192.0.2.2"} {
+		result, err := store.Take(ctx, key, limit)
+		if err != nil || !result.Allowed {
+			t.Errorf("first Take(%q) = %+v, %v, want allowed", key, result, err)
+		}
+	}
+	result, err := store.Take(ctx, "ip:192.0.2.1", limit)
+	if err != nil || result.Allowed || result.RetryAfter <= 0 {
+		t.Errorf("second Take() = %+v, %v, want refused with a delay", result, err)
+	}
+}
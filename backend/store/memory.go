@@ -0,0 +1,635 @@
+package store
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is a CommentStore that keeps everything in memory. It is safe for concurrent use, and is meant for
+// running the API locally or in tests without a database. Nothing survives a restart.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	// comments maps a listing ID to the comments on that listing, in no particular order
+	comments map[string][]models.Comment
+
+	// revisions maps a comment ID to the previous versions of its text, oldest first
+	revisions map[uuid.UUID][]models.CommentRevision
+
+	// votes maps a comment ID to the votes on it, keyed by user ID
+	votes map[uuid.UUID]map[string]int
+
+	// reports maps a comment ID to the reports of it, and hidden holds the comments hidden because of their reports
+	reports map[uuid.UUID][]models.Report
+	hidden  map[uuid.UUID]bool
+
+	// subscriptions maps a listing ID to the subscriptions to that listing, keyed by user ID
+	subscriptions map[string]map[string]models.Subscription
+
+	blacklist []models.BlacklistEntry
+}
+
+// NewMemoryStore returns a MemoryStore seeded with a copy of the given comments, keyed by listing ID
+// (e.g. models.TempCommentDB).
+func NewMemoryStore(seed map[string][]models.Comment) *MemoryStore {
+	comments := make(map[string][]models.Comment, len(seed))
+	for listingID, listingComments := range seed {
+		comments[listingID] = slices.Clone(listingComments)
+	}
+
+	return &MemoryStore{
+		comments:  comments,
+		revisions: map[uuid.UUID][]models.CommentRevision{},
+		votes:     map[uuid.UUID]map[string]int{},
+		reports:   map[uuid.UUID][]models.Report{},
+		hidden:    map[uuid.UUID]bool{},
+
+		subscriptions: map[string]map[string]models.Subscription{},
+	}
+}
+
+// AddBlacklistEntry adds an entry to the in-memory blacklist.
+func (store *MemoryStore) AddBlacklistEntry(entry models.BlacklistEntry) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.blacklist = append(store.blacklist, entry)
+}
+
+func (store *MemoryStore) GetComments(ctx context.Context, listingID string, page PageRequest) (*Page, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	listingComments := store.comments[listingID]
+	hasReplies := map[uuid.UUID]bool{}
+	for _, comment := range listingComments {
+		if comment.ParentID != nil && !store.hidden[comment.CommentID] {
+			hasReplies[*comment.ParentID] = true
+		}
+	}
+
+	// Collect the top-level comments on the right side of the cursor, along with their own cursors.
+	// Deleted comments are only kept as tombstones if they have replies.
+	type positioned struct {
+		comment models.Comment
+		cursor  Cursor
+	}
+	var candidates []positioned
+	for _, comment := range listingComments {
+		if comment.ParentID != nil || store.hidden[comment.CommentID] || (comment.DeletedAt != 0 && !hasReplies[comment.CommentID]) {
+			continue
+		}
+		cursor := store.cursorOf(comment, page.Sort)
+		if page.Before != nil && compareCursors(cursor, *page.Before) <= 0 {
+			continue
+		}
+		if page.After != nil && compareCursors(cursor, *page.After) >= 0 {
+			continue
+		}
+		if page.HideBlacklisted && store.matchBlacklist(comment.UserIP, comment.UserID, comment.Username) != nil {
+			continue
+		}
+		candidates = append(candidates, positioned{comment, cursor})
+	}
+
+	// Keep the comments closest to the cursor, then put them in the sort order
+	compare := func(a, b positioned) int { return compareCursors(a.cursor, b.cursor) }
+	if page.After != nil {
+		slices.SortFunc(candidates, func(a, b positioned) int { return compare(b, a) })
+	} else {
+		slices.SortFunc(candidates, compare)
+	}
+	hasMore := len(candidates) > page.Limit
+	if hasMore {
+		candidates = candidates[:page.Limit]
+	}
+	slices.SortFunc(candidates, compare)
+	var topLevel []models.Comment
+	var cursors []Cursor
+	for _, candidate := range candidates {
+		topLevel = append(topLevel, candidate.comment)
+		cursors = append(cursors, candidate.cursor)
+	}
+
+	// Walk down the threads to collect every reply below the page's top-level comments
+	inThread := map[uuid.UUID]bool{}
+	for _, comment := range topLevel {
+		inThread[comment.CommentID] = true
+	}
+	var replies []models.Comment
+	for found := true; found; {
+		found = false
+		for _, comment := range listingComments {
+			if comment.ParentID == nil || store.hidden[comment.CommentID] || inThread[comment.CommentID] || !inThread[*comment.ParentID] {
+				continue
+			}
+			inThread[comment.CommentID] = true
+			found = true
+			if page.HideBlacklisted && store.matchBlacklist(comment.UserIP, comment.UserID, comment.Username) != nil {
+				continue
+			}
+			replies = append(replies, comment)
+		}
+	}
+	sortNewestFirst(replies)
+
+	return &Page{
+		TopLevel: topLevel,
+		Cursors:  cursors,
+		Replies:  replies,
+		HasMore:  hasMore,
+	}, nil
+}
+
+func (store *MemoryStore) GetThreadInfo(ctx context.Context, commentID uuid.UUID) (*ThreadInfo, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	comment, ok := store.findComment(commentID)
+	if !ok || store.hidden[commentID] {
+		return nil, ErrNotFound
+	}
+
+	// Count the ancestors of the comment, which isn't shown if any of them is hidden
+	depth := 0
+	for current := comment; current.ParentID != nil; depth++ {
+		parent, ok := store.findComment(*current.ParentID)
+		if !ok {
+			break
+		}
+		if store.hidden[parent.CommentID] {
+			return nil, ErrNotFound
+		}
+		current = parent
+	}
+
+	return &ThreadInfo{
+		ListingID: comment.TargetListing,
+		Depth:     depth,
+		Deleted:   comment.DeletedAt != 0,
+	}, nil
+}
+
+func (store *MemoryStore) PostComment(ctx context.Context, comment models.Comment) (*models.Comment, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// Timestamps are in microseconds, like the ones from the database
+	comment.Timestamp = time.Now().UnixMicro()
+	store.comments[comment.TargetListing] = append(store.comments[comment.TargetListing], comment)
+
+	return &comment, nil
+}
+
+func (store *MemoryStore) GetComment(ctx context.Context, commentID uuid.UUID) (*models.Comment, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	comment, ok := store.findComment(commentID)
+	if !ok || comment.DeletedAt != 0 || store.hidden[commentID] {
+		return nil, ErrNotFound
+	}
+	return &comment, nil
+}
+
+func (store *MemoryStore) EditComment(ctx context.Context, commentID uuid.UUID, commentText string, window time.Duration) (*models.Comment, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	comment, ok := store.findComment(commentID)
+	if !ok || comment.DeletedAt != 0 || store.hidden[commentID] {
+		return nil, ErrNotFound
+	}
+	if time.Since(time.UnixMicro(comment.Timestamp)) >= window {
+		return nil, ErrEditWindowClosed
+	}
+	if comment.CommentText == commentText {
+		return &comment, nil
+	}
+	revisionID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the previous text, which was written when the comment was posted or last edited
+	now := time.Now().UnixMicro()
+	writtenAt := comment.Timestamp
+	if comment.EditedAt != 0 {
+		writtenAt = comment.EditedAt
+	}
+	store.revisions[commentID] = append(store.revisions[commentID], models.CommentRevision{
+		RevisionID:  revisionID,
+		CommentText: comment.CommentText,
+		WrittenAt:   writtenAt,
+		ReplacedAt:  now,
+	})
+
+	comment.CommentText = commentText
+	comment.EditedAt = now
+	comment.RevisionCount++
+	store.replaceComment(comment)
+
+	return &comment, nil
+}
+
+func (store *MemoryStore) GetCommentRevisions(ctx context.Context, commentID uuid.UUID) ([]models.CommentRevision, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return slices.Clone(store.revisions[commentID]), nil
+}
+
+func (store *MemoryStore) DeleteComment(ctx context.Context, commentID uuid.UUID, deletedBy string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	comment, ok := store.findComment(commentID)
+	if !ok || comment.DeletedAt != 0 {
+		return ErrNotFound
+	}
+
+	comment.DeletedAt = time.Now().UnixMicro()
+	comment.DeletedBy = deletedBy
+	store.replaceComment(comment)
+
+	return nil
+}
+
+func (store *MemoryStore) PurgeDeletedComments(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	cutoff := deletedBefore.UnixMicro()
+	var purged int64
+	for listingID, listingComments := range store.comments {
+		// Remove the expired tombstones without replies, until removing one doesn't leave its parent without replies
+		for {
+			hasReplies := map[uuid.UUID]bool{}
+			for _, comment := range listingComments {
+				if comment.ParentID != nil {
+					hasReplies[*comment.ParentID] = true
+				}
+			}
+			before := len(listingComments)
+			listingComments = slices.DeleteFunc(listingComments, func(c models.Comment) bool {
+				if c.DeletedAt == 0 || c.DeletedAt >= cutoff || hasReplies[c.CommentID] {
+					return false
+				}
+				delete(store.revisions, c.CommentID)
+				delete(store.votes, c.CommentID)
+				delete(store.reports, c.CommentID)
+				delete(store.hidden, c.CommentID)
+				return true
+			})
+			if len(listingComments) == before {
+				break
+			}
+			purged += int64(before - len(listingComments))
+		}
+
+		// Scrub the expired tombstones kept for their replies
+		for i, comment := range listingComments {
+			if comment.DeletedAt != 0 && comment.DeletedAt < cutoff {
+				listingComments[i].UserIP = ""
+				listingComments[i].UserID = ""
+				listingComments[i].Username = ""
+				listingComments[i].CommentText = ""
+				delete(store.revisions, comment.CommentID)
+			}
+		}
+
+		store.comments[listingID] = listingComments
+	}
+
+	return purged, nil
+}
+
+func (store *MemoryStore) Vote(ctx context.Context, commentID uuid.UUID, userID string, vote int) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	comment, ok := store.findComment(commentID)
+	if !ok || comment.DeletedAt != 0 || store.hidden[commentID] {
+		return 0, ErrNotFound
+	}
+
+	if vote == 0 {
+		delete(store.votes[commentID], userID)
+	} else {
+		if store.votes[commentID] == nil {
+			store.votes[commentID] = map[string]int{}
+		}
+		store.votes[commentID][userID] = vote
+	}
+
+	upvotes, downvotes := store.countVotes(commentID)
+	comment.Score = upvotes - downvotes
+	store.replaceComment(comment)
+
+	return comment.Score, nil
+}
+
+func (store *MemoryStore) GetUserVotes(ctx context.Context, userID string, commentIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	votes := map[uuid.UUID]int{}
+	for _, commentID := range commentIDs {
+		if vote, ok := store.votes[commentID][userID]; ok {
+			votes[commentID] = vote
+		}
+	}
+	return votes, nil
+}
+
+func (store *MemoryStore) GetCommentsSince(ctx context.Context, listingID string, since uuid.UUID, limit int, hideBlacklisted bool) ([]models.Comment, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var comments []models.Comment
+	for _, comment := range store.comments[listingID] {
+		if bytes.Compare(comment.CommentID[:], since[:]) <= 0 || comment.DeletedAt != 0 || store.hidden[comment.CommentID] {
+			continue
+		}
+		if hideBlacklisted && store.matchBlacklist(comment.UserIP, comment.UserID, comment.Username) != nil {
+			continue
+		}
+		comments = append(comments, comment)
+	}
+
+	slices.SortFunc(comments, func(a, b models.Comment) int {
+		return bytes.Compare(a.CommentID[:], b.CommentID[:])
+	})
+	if len(comments) > limit {
+		comments = comments[:limit]
+	}
+	return comments, nil
+}
+
+func (store *MemoryStore) GetCommentCounts(ctx context.Context, listingIDs []string, hideBlacklisted bool) (map[string]models.ListingCommentCount, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	counts := map[string]models.ListingCommentCount{}
+	for _, listingID := range listingIDs {
+		count := models.ListingCommentCount{}
+		for _, comment := range store.comments[listingID] {
+			if comment.DeletedAt != 0 || store.hidden[comment.CommentID] {
+				continue
+			}
+			if hideBlacklisted && store.matchBlacklist(comment.UserIP, comment.UserID, comment.Username) != nil {
+				continue
+			}
+			count.CommentCount++
+			if count.LatestTimestamp == nil || comment.Timestamp > *count.LatestTimestamp {
+				latest := comment.Timestamp
+				count.LatestTimestamp = &latest
+			}
+		}
+		if count.CommentCount > 0 {
+			counts[listingID] = count
+		}
+	}
+	return counts, nil
+}
+
+func (store *MemoryStore) ReportComment(ctx context.Context, report models.Report, hideThreshold int) (*ReportResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	comment, ok := store.findComment(report.CommentID)
+	if !ok || comment.DeletedAt != 0 || store.hidden[report.CommentID] {
+		return nil, ErrNotFound
+	}
+
+	// Each reporter can only report a comment once
+	openReports := 0
+	for _, existing := range store.reports[report.CommentID] {
+		if existing.ReporterID == report.ReporterID {
+			return &ReportResult{Report: existing}, nil
+		}
+		// The reports of the comment filters don't count towards hiding the comment
+		if existing.Status == models.ReportStatusOpen && existing.ReporterID != models.FilterReporterID {
+			openReports++
+		}
+	}
+
+	report.Status = models.ReportStatusOpen
+	report.Timestamp = time.Now().UnixMicro()
+	store.reports[report.CommentID] = append(store.reports[report.CommentID], report)
+	if report.ReporterID != models.FilterReporterID {
+		openReports++
+	}
+
+	hidden := hideThreshold > 0 && openReports >= hideThreshold
+	if hidden {
+		store.hidden[report.CommentID] = true
+	}
+
+	return &ReportResult{
+		Report:  report,
+		Created: true,
+		Hidden:  hidden,
+	}, nil
+}
+
+func (store *MemoryStore) Subscribe(ctx context.Context, subscription models.Subscription) (*SubscribeResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.subscriptions[subscription.ListingID] == nil {
+		store.subscriptions[subscription.ListingID] = map[string]models.Subscription{}
+	}
+	previous, exists := store.subscriptions[subscription.ListingID][subscription.UserID]
+	if exists {
+		// Keep the progress of the existing subscription, and its verification if the email is the same
+		subscription.LastCommentID = previous.LastCommentID
+		subscription.Timestamp = previous.Timestamp
+		subscription.EmailVerified = previous.EmailVerified && previous.Email == subscription.Email
+	} else {
+		subscription.Timestamp = time.Now().UnixMicro()
+		subscription.EmailVerified = false
+	}
+	store.subscriptions[subscription.ListingID][subscription.UserID] = subscription
+
+	return &SubscribeResult{
+		Subscription: subscription,
+		Created:      !exists,
+		EmailChanged: !exists || previous.Email != subscription.Email,
+	}, nil
+}
+
+func (store *MemoryStore) Unsubscribe(ctx context.Context, listingID, userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.subscriptions[listingID][userID]; !ok {
+		return ErrNotFound
+	}
+	delete(store.subscriptions[listingID], userID)
+	return nil
+}
+
+func (store *MemoryStore) VerifySubscriptionEmail(ctx context.Context, listingID, userID, email string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	subscription, ok := store.subscriptions[listingID][userID]
+	if !ok || subscription.Email == "" || subscription.Email != email {
+		return ErrNotFound
+	}
+	subscription.EmailVerified = true
+	store.subscriptions[listingID][userID] = subscription
+	return nil
+}
+
+func (store *MemoryStore) GetPendingSubscriptions(ctx context.Context, afterListingID, afterUserID string, limit int, hideBlacklisted bool) ([]models.Subscription, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var pending []models.Subscription
+	for listingID, subscriptions := range store.subscriptions {
+		for userID, subscription := range subscriptions {
+			if cmp.Or(cmp.Compare(listingID, afterListingID), cmp.Compare(userID, afterUserID)) <= 0 {
+				continue
+			}
+			hasNewComments := slices.ContainsFunc(store.comments[listingID], func(comment models.Comment) bool {
+				return bytes.Compare(comment.CommentID[:], subscription.LastCommentID[:]) > 0 && comment.UserID != userID &&
+					comment.DeletedAt == 0 && !store.hidden[comment.CommentID] &&
+					(!hideBlacklisted || store.matchBlacklist(comment.UserIP, comment.UserID, comment.Username) == nil)
+			})
+			if hasNewComments {
+				pending = append(pending, subscription)
+			}
+		}
+	}
+
+	slices.SortFunc(pending, func(a, b models.Subscription) int {
+		return cmp.Or(cmp.Compare(a.ListingID, b.ListingID), cmp.Compare(a.UserID, b.UserID))
+	})
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (store *MemoryStore) MarkSubscriptionNotified(ctx context.Context, listingID, userID string, lastCommentID uuid.UUID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	subscription, ok := store.subscriptions[listingID][userID]
+	if !ok {
+		return nil
+	}
+	subscription.LastCommentID = lastCommentID
+	store.subscriptions[listingID][userID] = subscription
+	return nil
+}
+
+func (store *MemoryStore) FindBlacklistEntry(ctx context.Context, userIP, userID, username string) (*models.BlacklistEntry, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.matchBlacklist(userIP, userID, username), nil
+}
+
+// matchBlacklist returns the newest blacklist entry matching the IP, user ID, or username, whatever the case of the
+// username. The caller must hold the lock.
+func (store *MemoryStore) matchBlacklist(userIP, userID, username string) *models.BlacklistEntry {
+	for i := len(store.blacklist) - 1; i >= 0; i-- {
+		entry := store.blacklist[i]
+		if (userIP != "" && entry.UserIP == userIP) ||
+			(userID != "" && entry.UserID == userID) ||
+			(username != "" && strings.EqualFold(entry.Username, username)) {
+			return &entry
+		}
+	}
+	return nil
+}
+
+// replaceComment overwrites the stored comment with the same ID. The caller must hold the lock.
+func (store *MemoryStore) replaceComment(comment models.Comment) {
+	listingComments := store.comments[comment.TargetListing]
+	for i := range listingComments {
+		if listingComments[i].CommentID == comment.CommentID {
+			listingComments[i] = comment
+			return
+		}
+	}
+}
+
+// findComment looks a comment up by ID across every listing. The caller must hold the lock.
+func (store *MemoryStore) findComment(commentID uuid.UUID) (models.Comment, bool) {
+	for _, listingComments := range store.comments {
+		for _, comment := range listingComments {
+			if comment.CommentID == commentID {
+				return comment, true
+			}
+		}
+	}
+	return models.Comment{}, false
+}
+
+// countVotes returns the number of upvotes and downvotes on a comment. The caller must hold the lock.
+func (store *MemoryStore) countVotes(commentID uuid.UUID) (upvotes, downvotes int) {
+	for _, vote := range store.votes[commentID] {
+		if vote > 0 {
+			upvotes++
+		} else {
+			downvotes++
+		}
+	}
+	return upvotes, downvotes
+}
+
+// controversy rates how controversial a comment is, like the controversy column of the comments table.
+// The caller must hold the lock.
+func (store *MemoryStore) controversy(commentID uuid.UUID) float64 {
+	upvotes, downvotes := store.countVotes(commentID)
+	if upvotes == 0 || downvotes == 0 {
+		return 0
+	}
+	return float64(upvotes+downvotes) * float64(min(upvotes, downvotes)) / float64(max(upvotes, downvotes))
+}
+
+// cursorOf returns the cursor of a top-level comment in the given sort order, like the sort_key column of the
+// database queries. The caller must hold the lock.
+func (store *MemoryStore) cursorOf(comment models.Comment, sort Sort) Cursor {
+	switch sort {
+	case SortTop:
+		return Cursor{Key: float64(comment.Score), CommentID: comment.CommentID}
+	case SortControversial:
+		return Cursor{Key: store.controversy(comment.CommentID), CommentID: comment.CommentID}
+	default:
+		return Cursor{CommentID: comment.CommentID}
+	}
+}
+
+// compareCursors orders cursors like pages are sorted: highest key first, with ties broken by putting the newest
+// comment first, like the database queries.
+func compareCursors(a, b Cursor) int {
+	if c := cmp.Compare(b.Key, a.Key); c != 0 {
+		return c
+	}
+	return compareIDs(b.CommentID, a.CommentID)
+}
+
+// compareIDs orders comment IDs, which for V7 UUIDs is chronological order.
+func compareIDs(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+func sortNewestFirst(comments []models.Comment) {
+	slices.SortFunc(comments, func(a, b models.Comment) int {
+		return compareIDs(b.CommentID, a.CommentID)
+	})
+}
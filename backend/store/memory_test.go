@@ -0,0 +1,294 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+
+	"github.com/google/uuid"
+)
+
+const testListingID = "zillow:1"
+
+// postTestComment posts a comment on testListingID, as a reply to parent unless it is nil, and returns it.
+func postTestComment(t *testing.T, store *MemoryStore, userID, username string, parent *models.Comment) models.Comment {
+	t.Helper()
+	commentID, err := uuid.NewV7()
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment := models.Comment{
+		TargetListing: testListingID,
+		CommentID:     commentID,
+		UserIP:        "192.0.2.1",
+		UserID:        userID,
+		Username:      username,
+		CommentText:   "comment by " + username,
+	}
+	if parent != nil {
+		comment.ParentID = &parent.CommentID
+	}
+	posted, err := store.PostComment(context.Background(), comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *posted
+}
+
+// getPage returns the first page of comments on testListingID, newest first.
+func getPage(t *testing.T, store *MemoryStore, hideBlacklisted bool) *Page {
+	t.Helper()
+	page, err := store.GetComments(context.Background(), testListingID, PageRequest{Limit: 10, Sort: SortNew, HideBlacklisted: hideBlacklisted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+// commentIDs returns the IDs of comments, in order.
+func commentIDs(comments []models.Comment) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.CommentID)
+	}
+	return ids
+}
+
+// assertIDs fails the test if comments aren't the wanted ones, in order.
+func assertIDs(t *testing.T, what string, comments []models.Comment, want ...models.Comment) {
+	t.Helper()
+	if got, wantIDs := commentIDs(comments), commentIDs(want); !slices.Equal(got, wantIDs) {
+		t.Errorf("%s = %v, want %v", what, got, wantIDs)
+	}
+}
+
+func TestMemoryStoreHidesBlacklistedComments(t *testing.T) {
+	store := NewMemoryStore(nil)
+	thread := postTestComment(t, store, "alice", "alice", nil)
+	spam := postTestComment(t, store, "spammer-1", "Spammer", &thread)
+	answer := postTestComment(t, store, "carol", "carol", &spam)
+	spamThread := postTestComment(t, store, "spammer-2", "SPAMMER", nil)
+	spamThreadReply := postTestComment(t, store, "carol", "carol", &spamThread)
+
+	// Usernames match whatever their case
+	store.AddBlacklistEntry(models.BlacklistEntry{Cause: "spam", Username: "spammer"})
+
+	page := getPage(t, store, false)
+	assertIDs(t, "top-level comments", page.TopLevel, spamThread, thread)
+	assertIDs(t, "replies", page.Replies, spamThreadReply, answer, spam)
+
+	// Blacklisted replies are left out, but not the replies to them, which are kept in their thread. Blacklisted
+	// top-level comments are left out along with their thread.
+	page = getPage(t, store, true)
+	assertIDs(t, "top-level comments", page.TopLevel, thread)
+	assertIDs(t, "replies", page.Replies, answer)
+
+	since, err := store.GetCommentsSince(context.Background(), testListingID, uuid.Nil, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, "comments since", since, thread, answer, spamThreadReply)
+
+	counts, err := store.GetCommentCounts(context.Background(), []string{testListingID}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counts[testListingID].CommentCount; got != 3 {
+		t.Errorf("comment count = %d, want 3", got)
+	}
+
+	entry, err := store.FindBlacklistEntry(context.Background(), "", "", "SpAmMeR")
+	if err != nil || entry == nil {
+		t.Errorf("FindBlacklistEntry() = %v, %v, want the entry", entry, err)
+	}
+	entry, err = store.FindBlacklistEntry(context.Background(), "", "", "")
+	if err != nil || entry != nil {
+		t.Errorf("FindBlacklistEntry() of nothing = %v, %v, want none", entry, err)
+	}
+}
+
+func TestMemoryStoreKeepsTombstonesWithReplies(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(nil)
+	thread := postTestComment(t, store, "alice", "alice", nil)
+	reply := postTestComment(t, store, "bob", "bob", &thread)
+	lonely := postTestComment(t, store, "alice", "alice", nil)
+
+	for _, comment := range []models.Comment{thread, lonely} {
+		err := store.DeleteComment(ctx, comment.CommentID, models.DeletedByAuthor)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.DeleteComment(ctx, lonely.CommentID, models.DeletedByAuthor); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting twice = %v, want ErrNotFound", err)
+	}
+
+	// The deleted comment with a reply stays as a tombstone, the one without is gone
+	page := getPage(t, store, false)
+	assertIDs(t, "top-level comments", page.TopLevel, thread)
+	assertIDs(t, "replies", page.Replies, reply)
+	if page.TopLevel[0].DeletedAt == 0 || page.TopLevel[0].DeletedBy != models.DeletedByAuthor {
+		t.Errorf("tombstone = %+v, want it deleted by its author", page.TopLevel[0])
+	}
+
+	// Tombstones can't be read, edited or voted on
+	if _, err := store.GetComment(ctx, thread.CommentID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetComment() of a tombstone = %v, want ErrNotFound", err)
+	}
+	if _, err := store.EditComment(ctx, thread.CommentID, "edited", time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Errorf("EditComment() of a tombstone = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Vote(ctx, thread.CommentID, "carol", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Vote() on a tombstone = %v, want ErrNotFound", err)
+	}
+	info, err := store.GetThreadInfo(ctx, reply.CommentID)
+	if err != nil || info.Depth != 1 {
+		t.Errorf("GetThreadInfo() of the reply = %+v, %v, want depth 1", info, err)
+	}
+
+	// Purging removes the tombstones without replies, and scrubs the ones kept for their replies
+	purged, err := store.PurgeDeletedComments(ctx, time.Now().Add(time.Hour))
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeDeletedComments() = %d, %v, want 1", purged, err)
+	}
+	page = getPage(t, store, false)
+	assertIDs(t, "top-level comments after purge", page.TopLevel, thread)
+	if tombstone := page.TopLevel[0]; tombstone.CommentText != "" || tombstone.Username != "" || tombstone.UserID != "" || tombstone.UserIP != "" {
+		t.Errorf("purged tombstone = %+v, want it scrubbed", tombstone)
+	}
+
+	// Once its last reply is deleted and purged, the tombstone goes too
+	err = store.DeleteComment(ctx, reply.CommentID, models.DeletedByAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	purged, err = store.PurgeDeletedComments(ctx, time.Now().Add(time.Hour))
+	if err != nil || purged != 2 {
+		t.Fatalf("PurgeDeletedComments() = %d, %v, want 2", purged, err)
+	}
+	assertIDs(t, "top-level comments after the last purge", getPage(t, store, false).TopLevel)
+}
+
+func TestMemoryStoreRecountsVotes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(nil)
+	comment := postTestComment(t, store, "alice", "alice", nil)
+
+	steps := []struct {
+		userID string
+		vote   int
+		score  int
+	}{
+		{"bob", 1, 1},
+		{"carol", 1, 2},
+		{"dave", -1, 1},
+		{"bob", 1, 1},   // Voting the same again changes nothing
+		{"dave", 1, 3},  // Changing a vote replaces it
+		{"carol", 0, 2}, // Taking a vote back removes it
+		{"carol", 0, 2}, // Even if there is none
+		{"bob", -1, 0},
+	}
+	for _, step := range steps {
+		score, err := store.Vote(ctx, comment.CommentID, step.userID, step.vote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if score != step.score {
+			t.Fatalf("score after %s votes %d = %d, want %d", step.userID, step.vote, score, step.score)
+		}
+	}
+
+	stored, err := store.GetComment(ctx, comment.CommentID)
+	if err != nil || stored.Score != 0 {
+		t.Errorf("GetComment() = %+v, %v, want a score of 0", stored, err)
+	}
+	votes, err := store.GetUserVotes(ctx, "dave", []uuid.UUID{comment.CommentID})
+	if err != nil || votes[comment.CommentID] != 1 {
+		t.Errorf("GetUserVotes() = %v, %v, want an upvote", votes, err)
+	}
+	votes, err = store.GetUserVotes(ctx, "carol", []uuid.UUID{comment.CommentID})
+	if err != nil || len(votes) != 0 {
+		t.Errorf("GetUserVotes() after taking the vote back = %v, %v, want none", votes, err)
+	}
+	if _, err := store.Vote(ctx, uuid.New(), "bob", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Vote() on a missing comment = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreHidesReportedComments(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(nil)
+	comment := postTestComment(t, store, "alice", "alice", nil)
+	reply := postTestComment(t, store, "bob", "bob", &comment)
+	report := func(commentID uuid.UUID, reporterID string, threshold int) *ReportResult {
+		t.Helper()
+		reportID, err := uuid.NewV7()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := store.ReportComment(ctx, models.Report{ReportID: reportID, CommentID: commentID, ReporterID: reporterID, Reason: "spam"}, threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// Neither the report of the comment filters nor reporting twice counts towards hiding the comment
+	report(comment.CommentID, models.FilterReporterID, 0)
+	first := report(comment.CommentID, "carol", 2)
+	if !first.Created || first.Hidden {
+		t.Errorf("first report = %+v, want it created without hiding the comment", first)
+	}
+	again := report(comment.CommentID, "carol", 2)
+	if again.Created || again.Hidden || again.Report.ReportID != first.Report.ReportID {
+		t.Errorf("second report by the same reporter = %+v, want the first one back", again)
+	}
+	assertIDs(t, "top-level comments", getPage(t, store, false).TopLevel, comment)
+
+	// Reaching the threshold hides the comment, and the replies below it
+	second := report(comment.CommentID, "dave", 2)
+	if !second.Created || !second.Hidden {
+		t.Errorf("report reaching the threshold = %+v, want it to hide the comment", second)
+	}
+	page := getPage(t, store, false)
+	assertIDs(t, "top-level comments", page.TopLevel)
+	assertIDs(t, "replies", page.Replies)
+	if _, err := store.GetComment(ctx, comment.CommentID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetComment() of a hidden comment = %v, want ErrNotFound", err)
+	}
+	if _, err := store.ReportComment(ctx, models.Report{CommentID: comment.CommentID, ReporterID: "erin"}, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("reporting a hidden comment = %v, want ErrNotFound", err)
+	}
+
+	// Reports never hide comments with a threshold of 0
+	for _, reporterID := range []string{"carol", "dave", "erin"} {
+		if result := report(reply.CommentID, reporterID, 0); result.Hidden {
+			t.Errorf("report by %s with no threshold hid the comment", reporterID)
+		}
+	}
+}
+
+func TestMemoryStoreEditsWithinWindow(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(nil)
+	comment := postTestComment(t, store, "alice", "alice", nil)
+
+	// An unchanged text records no revision
+	unchanged, err := store.EditComment(ctx, comment.CommentID, comment.CommentText, time.Hour)
+	if err != nil || unchanged.RevisionCount != 0 {
+		t.Errorf("EditComment() with the same text = %+v, %v, want no revision", unchanged, err)
+	}
+	edited, err := store.EditComment(ctx, comment.CommentID, "edited", time.Hour)
+	if err != nil || edited.RevisionCount != 1 || edited.CommentText != "edited" {
+		t.Errorf("EditComment() = %+v, %v, want the edited comment", edited, err)
+	}
+
+	if _, err := store.EditComment(ctx, comment.CommentID, "too late", 0); !errors.Is(err, ErrEditWindowClosed) {
+		t.Errorf("EditComment() past the window = %v, want ErrEditWindowClosed", err)
+	}
+}
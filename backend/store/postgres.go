@@ -0,0 +1,638 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+	"zillow-commenter.com/m/db/postgres/sqlc"
+	"zillow-commenter.com/m/webhook"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore is a CommentStore backed by the Postgres database, through the sqlc queries.
+type PostgresStore struct {
+	pool    *pgxpool.Pool
+	queries *sqlc.Queries
+}
+
+// NewPostgresStore returns a CommentStore that runs its queries on connections from the given pool.
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{
+		pool:    pool,
+		queries: sqlc.New(pool),
+	}
+}
+
+func (store *PostgresStore) GetComments(ctx context.Context, listingID string, page PageRequest) (*Page, error) {
+	// Query the database for the page of top-level comments, fetching one extra row to find out whether there are more
+	topLevelRows, err := store.getTopLevelRows(ctx, listingID, page)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to retrieve comments from database"))
+	}
+
+	// Drop the extra row, which is the furthest from the cursor
+	hasMore := len(topLevelRows) > page.Limit
+	if hasMore {
+		topLevelRows = topLevelRows[:page.Limit]
+	}
+	// Rows before an after cursor come back in reverse order, so put them back in the sort order
+	if page.After != nil {
+		slices.Reverse(topLevelRows)
+	}
+
+	// Query the database for the replies below the page's top-level comments
+	var replyRows []sqlc.CommentRow
+	if len(topLevelRows) > 0 {
+		threadIDs := make([]pgtype.UUID, 0, len(topLevelRows))
+		for _, row := range topLevelRows {
+			threadIDs = append(threadIDs, row.CommentID)
+		}
+
+		rows, err := store.queries.GetCommentReplies(ctx, sqlc.GetCommentRepliesParams{
+			ThreadIds:       threadIDs,
+			HideBlacklisted: page.HideBlacklisted,
+		})
+		if err != nil {
+			return nil, errors.Join(err, errors.New("failed to retrieve replies from database"))
+		}
+		for _, row := range rows {
+			replyRows = append(replyRows, sqlc.CommentRow(row))
+		}
+	}
+
+	// Convert the sqlc.CommentRow structs to models.Comment structs, keeping the cursor of each top-level comment
+	topLevelCommentRows := make([]sqlc.CommentRow, 0, len(topLevelRows))
+	cursors := make([]Cursor, 0, len(topLevelRows))
+	for _, row := range topLevelRows {
+		topLevelCommentRows = append(topLevelCommentRows, row.CommentRow())
+		cursors = append(cursors, Cursor{Key: row.SortKey, CommentID: uuid.UUID(row.CommentID.Bytes)})
+	}
+	topLevel, err := models.CommentRowsToComments(topLevelCommentRows)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to convert comment rows to models.Comment structs"))
+	}
+	replies, err := models.CommentRowsToComments(replyRows)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to convert reply rows to models.Comment structs"))
+	}
+
+	return &Page{
+		TopLevel: topLevel,
+		Cursors:  cursors,
+		Replies:  replies,
+		HasMore:  hasMore,
+	}, nil
+}
+
+// getTopLevelRows runs the query matching the sort order and direction of a page request, fetching one more row
+// than the page's limit. Rows before an after cursor come back in reverse sort order, starting from the cursor.
+func (store *PostgresStore) getTopLevelRows(ctx context.Context, listingID string, page PageRequest) ([]sqlc.TopLevelCommentRow, error) {
+	pageSize := int32(page.Limit + 1)
+	var before pgtype.UUID
+	var beforeKey float64
+	if page.Before != nil {
+		before = pgtype.UUID{Bytes: [16]byte(page.Before.CommentID), Valid: true}
+		beforeKey = page.Before.Key
+	}
+
+	// Every query returns the same columns, so their rows all convert to TopLevelCommentRow
+	var topLevelRows []sqlc.TopLevelCommentRow
+	switch {
+	case page.Sort == SortTop && page.After != nil:
+		rows, err := store.queries.GetTopLevelCommentsByScoreAfter(ctx, sqlc.GetTopLevelCommentsByScoreAfterParams{
+			ListingID:       listingID,
+			AfterScore:      int32(page.After.Key),
+			After:           pgtype.UUID{Bytes: [16]byte(page.After.CommentID), Valid: true},
+			HideBlacklisted: page.HideBlacklisted,
+			PageSize:        pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			topLevelRows = append(topLevelRows, sqlc.TopLevelCommentRow(row))
+		}
+	case page.Sort == SortTop:
+		rows, err := store.queries.GetTopLevelCommentsByScoreBefore(ctx, sqlc.GetTopLevelCommentsByScoreBeforeParams{
+			ListingID:       listingID,
+			Before:          before,
+			BeforeScore:     pgtype.Int4{Int32: int32(beforeKey), Valid: before.Valid},
+			HideBlacklisted: page.HideBlacklisted,
+			PageSize:        pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			topLevelRows = append(topLevelRows, sqlc.TopLevelCommentRow(row))
+		}
+	case page.Sort == SortControversial && page.After != nil:
+		rows, err := store.queries.GetTopLevelCommentsByControversyAfter(ctx, sqlc.GetTopLevelCommentsByControversyAfterParams{
+			ListingID:        listingID,
+			AfterControversy: page.After.Key,
+			After:            pgtype.UUID{Bytes: [16]byte(page.After.CommentID), Valid: true},
+			HideBlacklisted:  page.HideBlacklisted,
+			PageSize:         pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			topLevelRows = append(topLevelRows, sqlc.TopLevelCommentRow(row))
+		}
+	case page.Sort == SortControversial:
+		rows, err := store.queries.GetTopLevelCommentsByControversyBefore(ctx, sqlc.GetTopLevelCommentsByControversyBeforeParams{
+			ListingID:         listingID,
+			Before:            before,
+			BeforeControversy: pgtype.Float8{Float64: beforeKey, Valid: before.Valid},
+			HideBlacklisted:   page.HideBlacklisted,
+			PageSize:          pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			topLevelRows = append(topLevelRows, sqlc.TopLevelCommentRow(row))
+		}
+	case page.After != nil:
+		rows, err := store.queries.GetTopLevelCommentsAfter(ctx, sqlc.GetTopLevelCommentsAfterParams{
+			ListingID:       listingID,
+			After:           pgtype.UUID{Bytes: [16]byte(page.After.CommentID), Valid: true},
+			HideBlacklisted: page.HideBlacklisted,
+			PageSize:        pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			topLevelRows = append(topLevelRows, sqlc.TopLevelCommentRow(row))
+		}
+	default:
+		rows, err := store.queries.GetTopLevelCommentsBefore(ctx, sqlc.GetTopLevelCommentsBeforeParams{
+			ListingID:       listingID,
+			Before:          before,
+			HideBlacklisted: page.HideBlacklisted,
+			PageSize:        pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			topLevelRows = append(topLevelRows, sqlc.TopLevelCommentRow(row))
+		}
+	}
+
+	return topLevelRows, nil
+}
+
+func (store *PostgresStore) GetThreadInfo(ctx context.Context, commentID uuid.UUID) (*ThreadInfo, error) {
+	threadInfo, err := store.queries.GetCommentThreadInfo(ctx, pgtype.UUID{Bytes: [16]byte(commentID), Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to retrieve comment thread info"))
+	}
+
+	return &ThreadInfo{
+		ListingID: threadInfo.ListingID,
+		Depth:     int(threadInfo.Depth),
+		Deleted:   threadInfo.Deleted,
+	}, nil
+}
+
+func (store *PostgresStore) PostComment(ctx context.Context, comment models.Comment) (*models.Comment, error) {
+	newComment := sqlc.PostCommentParams{
+		CommentID:       pgtype.UUID{Bytes: [16]byte(comment.CommentID), Valid: true},
+		ListingID:       comment.TargetListing,
+		UserIp:          comment.UserIP,
+		UserID:          comment.UserID,
+		Username:        comment.Username,
+		CommentText:     comment.CommentText,
+		ParentCommentID: toPgUUID(toNullUUID(comment.ParentID)),
+	}
+
+	tx, err := store.pool.Begin(ctx)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to begin comment transaction"))
+	}
+	defer tx.Rollback(ctx)
+	queries := store.queries.WithTx(tx)
+
+	postCommentRow, err := queries.PostComment(ctx, newComment)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to insert comment into database"))
+	}
+
+	// PostCommentRow has the same columns as a CommentRow, so it converts the same way
+	postedComment, err := models.CommentRowToComment(sqlc.CommentRow(postCommentRow))
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to convert comment row to models.Comment struct"))
+	}
+
+	// Queue the webhook event with the comment, so that neither is kept without the other
+	event, err := webhook.NewCommentCreatedEvent(*postedComment)
+	if err != nil {
+		return nil, err
+	}
+	_, err = webhook.Enqueue(ctx, queries, event)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to commit comment transaction"))
+	}
+	return postedComment, nil
+}
+
+func (store *PostgresStore) GetComment(ctx context.Context, commentID uuid.UUID) (*models.Comment, error) {
+	row, err := store.queries.GetComment(ctx, pgtype.UUID{Bytes: [16]byte(commentID), Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to retrieve comment from database"))
+	}
+
+	comment, err := models.CommentRowToComment(sqlc.CommentRow(row))
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to convert comment row to models.Comment struct"))
+	}
+	return comment, nil
+}
+
+func (store *PostgresStore) EditComment(ctx context.Context, commentID uuid.UUID, commentText string, window time.Duration) (*models.Comment, error) {
+	// Revision IDs are V7 UUIDs, so that revisions sort chronologically
+	revisionID, err := uuid.NewV7()
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to generate revision UUID"))
+	}
+
+	row, err := store.queries.EditComment(ctx, sqlc.EditCommentParams{
+		CommentID:         pgtype.UUID{Bytes: [16]byte(commentID), Valid: true},
+		EditWindowSeconds: window.Seconds(),
+		RevisionID:        pgtype.UUID{Bytes: [16]byte(revisionID), Valid: true},
+		CommentText:       commentText,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The comment is either gone or past the window, which its own query tells apart
+		if _, err := store.GetComment(ctx, commentID); err != nil {
+			return nil, err
+		}
+		return nil, ErrEditWindowClosed
+	}
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to edit comment in database"))
+	}
+
+	editedComment, err := models.CommentRowToComment(sqlc.CommentRow(row))
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to convert comment row to models.Comment struct"))
+	}
+	return editedComment, nil
+}
+
+func (store *PostgresStore) GetCommentRevisions(ctx context.Context, commentID uuid.UUID) ([]models.CommentRevision, error) {
+	rows, err := store.queries.GetCommentRevisions(ctx, pgtype.UUID{Bytes: [16]byte(commentID), Valid: true})
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to retrieve comment revisions from database"))
+	}
+	return models.RevisionRowsToRevisions(rows), nil
+}
+
+func (store *PostgresStore) DeleteComment(ctx context.Context, commentID uuid.UUID, deletedBy string) error {
+	rowsAffected, err := store.queries.SoftDeleteComment(ctx, sqlc.SoftDeleteCommentParams{
+		CommentID: pgtype.UUID{Bytes: [16]byte(commentID), Valid: true},
+		DeletedBy: pgtype.Text{String: deletedBy, Valid: true},
+	})
+	if err != nil {
+		return errors.Join(err, errors.New("failed to delete comment in database"))
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *PostgresStore) PurgeDeletedComments(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	cutoff := pgtype.Timestamp{Time: deletedBefore, Valid: true}
+
+	// Purging a tombstone can leave its parent tombstone without replies, so keep going until nothing is purged
+	var purged int64
+	for {
+		rowsAffected, err := store.queries.PurgeDeletedComments(ctx, cutoff)
+		if err != nil {
+			return purged, errors.Join(err, errors.New("failed to purge deleted comments"))
+		}
+		if rowsAffected == 0 {
+			break
+		}
+		purged += rowsAffected
+	}
+
+	// The remaining tombstones are kept for their replies, so only erase what identified them
+	_, err := store.queries.ScrubDeletedComments(ctx, cutoff)
+	if err != nil {
+		return purged, errors.Join(err, errors.New("failed to scrub deleted comments"))
+	}
+	_, err = store.queries.DeleteRevisionsOfDeletedComments(ctx, cutoff)
+	if err != nil {
+		return purged, errors.Join(err, errors.New("failed to delete revisions of deleted comments"))
+	}
+
+	return purged, nil
+}
+
+func (store *PostgresStore) Vote(ctx context.Context, commentID uuid.UUID, userID string, vote int) (int, error) {
+	tx, err := store.pool.Begin(ctx)
+	if err != nil {
+		return 0, errors.Join(err, errors.New("failed to begin vote transaction"))
+	}
+	defer tx.Rollback(ctx)
+	queries := store.queries.WithTx(tx)
+	pgCommentID := pgtype.UUID{Bytes: [16]byte(commentID), Valid: true}
+
+	// Lock the comment first, so that the recount below sees the votes of every transaction that locked it before
+	_, err = queries.LockCommentForVote(ctx, pgCommentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, errors.Join(err, errors.New("failed to lock comment for vote"))
+	}
+
+	if vote == 0 {
+		err = queries.DeleteCommentVote(ctx, sqlc.DeleteCommentVoteParams{
+			CommentID: pgCommentID,
+			UserID:    userID,
+		})
+	} else {
+		err = queries.UpsertCommentVote(ctx, sqlc.UpsertCommentVoteParams{
+			CommentID: pgCommentID,
+			UserID:    userID,
+			Vote:      int16(vote),
+		})
+	}
+	if err != nil {
+		return 0, errors.Join(err, errors.New("failed to record vote"))
+	}
+
+	score, err := queries.RecountCommentVotes(ctx, pgCommentID)
+	if err != nil {
+		return 0, errors.Join(err, errors.New("failed to recount votes"))
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, errors.Join(err, errors.New("failed to commit vote transaction"))
+	}
+	return int(score), nil
+}
+
+func (store *PostgresStore) GetUserVotes(ctx context.Context, userID string, commentIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	votes := map[uuid.UUID]int{}
+	if userID == "" || len(commentIDs) == 0 {
+		return votes, nil
+	}
+
+	pgCommentIDs := make([]pgtype.UUID, 0, len(commentIDs))
+	for _, commentID := range commentIDs {
+		pgCommentIDs = append(pgCommentIDs, pgtype.UUID{Bytes: [16]byte(commentID), Valid: true})
+	}
+	rows, err := store.queries.GetUserVotes(ctx, sqlc.GetUserVotesParams{
+		UserID:     userID,
+		CommentIds: pgCommentIDs,
+	})
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to retrieve votes from database"))
+	}
+
+	for _, row := range rows {
+		votes[uuid.UUID(row.CommentID.Bytes)] = int(row.Vote)
+	}
+	return votes, nil
+}
+
+func (store *PostgresStore) GetCommentsSince(ctx context.Context, listingID string, since uuid.UUID, limit int, hideBlacklisted bool) ([]models.Comment, error) {
+	rows, err := store.queries.GetListingCommentsSince(ctx, sqlc.GetListingCommentsSinceParams{
+		ListingID:       listingID,
+		Since:           pgtype.UUID{Bytes: [16]byte(since), Valid: true},
+		HideBlacklisted: hideBlacklisted,
+		PageSize:        int32(limit),
+	})
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to retrieve comments from database"))
+	}
+
+	commentRows := make([]sqlc.CommentRow, 0, len(rows))
+	for _, row := range rows {
+		commentRows = append(commentRows, sqlc.CommentRow(row))
+	}
+	comments, err := models.CommentRowsToComments(commentRows)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to convert comment rows to models.Comment structs"))
+	}
+	return comments, nil
+}
+
+func (store *PostgresStore) GetCommentCounts(ctx context.Context, listingIDs []string, hideBlacklisted bool) (map[string]models.ListingCommentCount, error) {
+	if len(listingIDs) == 0 {
+		return map[string]models.ListingCommentCount{}, nil
+	}
+
+	rows, err := store.queries.GetListingCommentCounts(ctx, sqlc.GetListingCommentCountsParams{
+		ListingIds:      listingIDs,
+		HideBlacklisted: hideBlacklisted,
+	})
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to count comments in database"))
+	}
+	return models.ListingCountRowsToCounts(rows), nil
+}
+
+func (store *PostgresStore) ReportComment(ctx context.Context, report models.Report, hideThreshold int) (*ReportResult, error) {
+	commentID := pgtype.UUID{Bytes: [16]byte(report.CommentID), Valid: true}
+
+	// Only visible comments can be reported
+	_, err := store.queries.GetComment(ctx, commentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to retrieve comment from database"))
+	}
+
+	// Creating the report returns no row if the reporter already reported the comment, so return that report instead
+	row, err := store.queries.CreateReport(ctx, sqlc.CreateReportParams{
+		ReportID:   pgtype.UUID{Bytes: [16]byte(report.ReportID), Valid: true},
+		CommentID:  commentID,
+		ReporterID: report.ReporterID,
+		Reason:     report.Reason,
+		Detail:     report.Detail,
+	})
+	created := true
+	if errors.Is(err, pgx.ErrNoRows) {
+		created = false
+		row, err = store.queries.GetReportByReporter(ctx, sqlc.GetReportByReporterParams{
+			CommentID:  commentID,
+			ReporterID: report.ReporterID,
+		})
+	}
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to record report in database"))
+	}
+	storedReport, err := models.ReportRowToReport(row)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to convert report row to models.Report struct"))
+	}
+
+	hidden := false
+	if created && hideThreshold > 0 {
+		rowsAffected, err := store.queries.HideReportedComment(ctx, sqlc.HideReportedCommentParams{
+			CommentID:     commentID,
+			HideThreshold: int64(hideThreshold),
+		})
+		if err != nil {
+			return nil, errors.Join(err, errors.New("failed to hide reported comment"))
+		}
+		hidden = rowsAffected > 0
+	}
+
+	return &ReportResult{
+		Report:  *storedReport,
+		Created: created,
+		Hidden:  hidden,
+	}, nil
+}
+
+func (store *PostgresStore) Subscribe(ctx context.Context, subscription models.Subscription) (*SubscribeResult, error) {
+	previous, err := store.queries.GetSubscription(ctx, sqlc.GetSubscriptionParams{
+		ListingID: subscription.ListingID,
+		UserID:    subscription.UserID,
+	})
+	created := errors.Is(err, pgx.ErrNoRows)
+	if err != nil && !created {
+		return nil, errors.Join(err, errors.New("failed to retrieve subscription from database"))
+	}
+
+	row, err := store.queries.UpsertSubscription(ctx, sqlc.UpsertSubscriptionParams{
+		ListingID:     subscription.ListingID,
+		UserID:        subscription.UserID,
+		Email:         subscription.Email,
+		LastCommentID: pgtype.UUID{Bytes: [16]byte(subscription.LastCommentID), Valid: true},
+	})
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to record subscription in database"))
+	}
+	stored, err := models.SubscriptionRowToSubscription(sqlc.GetSubscriptionRow(row))
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to convert subscription row to models.Subscription struct"))
+	}
+
+	return &SubscribeResult{
+		Subscription: *stored,
+		Created:      created,
+		EmailChanged: created || previous.Email != stored.Email,
+	}, nil
+}
+
+func (store *PostgresStore) Unsubscribe(ctx context.Context, listingID, userID string) error {
+	rowsAffected, err := store.queries.DeleteSubscription(ctx, sqlc.DeleteSubscriptionParams{
+		ListingID: listingID,
+		UserID:    userID,
+	})
+	if err != nil {
+		return errors.Join(err, errors.New("failed to delete subscription from database"))
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *PostgresStore) VerifySubscriptionEmail(ctx context.Context, listingID, userID, email string) error {
+	rowsAffected, err := store.queries.VerifySubscriptionEmail(ctx, sqlc.VerifySubscriptionEmailParams{
+		ListingID: listingID,
+		UserID:    userID,
+		Email:     email,
+	})
+	if err != nil {
+		return errors.Join(err, errors.New("failed to verify subscription email in database"))
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *PostgresStore) GetPendingSubscriptions(ctx context.Context, afterListingID, afterUserID string, limit int, hideBlacklisted bool) ([]models.Subscription, error) {
+	rows, err := store.queries.GetPendingSubscriptions(ctx, sqlc.GetPendingSubscriptionsParams{
+		AfterListingID:  afterListingID,
+		AfterUserID:     afterUserID,
+		HideBlacklisted: hideBlacklisted,
+		PageSize:        int32(limit),
+	})
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to retrieve pending subscriptions from database"))
+	}
+
+	subscriptions := make([]models.Subscription, 0, len(rows))
+	for _, row := range rows {
+		subscription, err := models.SubscriptionRowToSubscription(sqlc.GetSubscriptionRow(row))
+		if err != nil {
+			return nil, errors.Join(err, errors.New("failed to convert subscription row to models.Subscription struct"))
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+	return subscriptions, nil
+}
+
+func (store *PostgresStore) MarkSubscriptionNotified(ctx context.Context, listingID, userID string, lastCommentID uuid.UUID) error {
+	err := store.queries.MarkSubscriptionNotified(ctx, sqlc.MarkSubscriptionNotifiedParams{
+		ListingID:     listingID,
+		UserID:        userID,
+		LastCommentID: pgtype.UUID{Bytes: [16]byte(lastCommentID), Valid: true},
+	})
+	if err != nil {
+		return errors.Join(err, errors.New("failed to mark subscription notified in database"))
+	}
+	return nil
+}
+
+func (store *PostgresStore) FindBlacklistEntry(ctx context.Context, userIP, userID, username string) (*models.BlacklistEntry, error) {
+	row, err := store.queries.GetBlacklistMatch(ctx, sqlc.GetBlacklistMatchParams{
+		UserIp:   userIP,
+		UserID:   pgtype.Text{String: userID, Valid: userID != ""},
+		Username: pgtype.Text{String: username, Valid: username != ""},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to query blacklist"))
+	}
+
+	return models.BlacklistRowToEntry(row)
+}
+
+// toPgUUID converts a nullable uuid to the pgtype used by the sqlc queries.
+func toPgUUID(id uuid.NullUUID) pgtype.UUID {
+	return pgtype.UUID{Bytes: [16]byte(id.UUID), Valid: id.Valid}
+}
+
+// toNullUUID converts an optional uuid pointer to a nullable uuid.
+func toNullUUID(id *uuid.UUID) uuid.NullUUID {
+	if id == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: *id, Valid: true}
+}
@@ -0,0 +1,168 @@
+// The store package contains the CommentStore interface the API keeps comments in, along with its implementations.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned when the comment an operation refers to does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrEditWindowClosed is returned by EditComment when the comment was posted longer ago than the edit window.
+var ErrEditWindowClosed = errors.New("edit window closed")
+
+// Sort is the order in which the top-level comments of a listing are paged through.
+type Sort string
+
+const (
+	// SortNew orders comments newest first.
+	SortNew Sort = "new"
+	// SortTop orders comments by score (upvotes minus downvotes), highest first.
+	SortTop Sort = "top"
+	// SortControversial orders comments by how many votes they have and how evenly split they are, most
+	// controversial first. Comments with only upvotes or only downvotes are not controversial at all.
+	SortControversial Sort = "controversial"
+)
+
+// Cursor is a position in the sort order of a listing's top-level comments: a comment ID along with the sort key
+// the comment had when the cursor was taken, its score or controversy. Keeping the key means that votes cast since
+// don't move the cursor, and that the comment doesn't need to exist anymore. The key is unused when sorting by date,
+// since comment IDs sort by date.
+type Cursor struct {
+	Key       float64
+	CommentID uuid.UUID
+}
+
+// PageRequest describes which page of top-level comments to get for a listing.
+// Before is a cursor past which to get the next page in the sort order, and After a cursor before which to get
+// the previous page. At most one of them is set. Without either, the first page is returned.
+type PageRequest struct {
+	Limit           int
+	Sort            Sort
+	Before          *Cursor
+	After           *Cursor
+	HideBlacklisted bool
+}
+
+// Page is a page of top-level comments along with every reply below them.
+type Page struct {
+	// TopLevel holds the top-level comments of the page, in the requested sort order.
+	TopLevel []models.Comment
+	// Cursors holds the cursor of each top-level comment, in the same order.
+	Cursors []Cursor
+	// Replies holds every reply below the top-level comments, newest first.
+	Replies []models.Comment
+	// HasMore reports whether there are more top-level comments past the page, in the direction of the cursor.
+	HasMore bool
+}
+
+// ThreadInfo describes where a comment sits: the listing it belongs to and its depth (0 for top-level comments).
+// Deleted reports whether the comment itself was deleted.
+type ThreadInfo struct {
+	ListingID string
+	Depth     int
+	Deleted   bool
+}
+
+// ReportResult is the outcome of reporting a comment. Created is false if the reporter had already reported the
+// comment, in which case Report is their earlier report. Hidden reports whether this report got the comment hidden.
+type ReportResult struct {
+	Report  models.Report
+	Created bool
+	Hidden  bool
+}
+
+// SubscribeResult is the outcome of subscribing to a listing. Created is false if the user was already subscribed,
+// and EmailChanged reports whether the subscription has a different email than before, which needs verifying.
+type SubscribeResult struct {
+	Subscription models.Subscription
+	Created      bool
+	EmailChanged bool
+}
+
+// CommentStore is where the API keeps comments.
+type CommentStore interface {
+	// GetComments returns a page of top-level comments for a listing, with their replies. Deleted comments are
+	// included, since they are shown as tombstones when they have replies, but deleted top-level comments without
+	// any reply are left out.
+	GetComments(ctx context.Context, listingID string, page PageRequest) (*Page, error)
+
+	// GetThreadInfo returns the listing and depth of a comment, or ErrNotFound if it is hidden or in a hidden thread.
+	GetThreadInfo(ctx context.Context, commentID uuid.UUID) (*ThreadInfo, error)
+
+	// PostComment stores a new comment and returns it as stored, with its timestamp set. Stores with a webhook outbox
+	// queue the comment.created event of the comment along with it.
+	PostComment(ctx context.Context, comment models.Comment) (*models.Comment, error)
+
+	// GetComment returns a visible comment that wasn't deleted, or ErrNotFound.
+	GetComment(ctx context.Context, commentID uuid.UUID) (*models.Comment, error)
+
+	// EditComment replaces the text of a comment posted less than window ago, keeping the previous text as a
+	// revision, and returns the edited comment. An unchanged text leaves the comment as it is. It returns ErrNotFound,
+	// or ErrEditWindowClosed if the comment is older than the window.
+	EditComment(ctx context.Context, commentID uuid.UUID, commentText string, window time.Duration) (*models.Comment, error)
+
+	// GetCommentRevisions returns the previous versions of a comment's text, oldest first.
+	GetCommentRevisions(ctx context.Context, commentID uuid.UUID) ([]models.CommentRevision, error)
+
+	// DeleteComment soft-deletes a comment, recording who deleted it (models.DeletedByAuthor or
+	// models.DeletedByAdmin), or returns ErrNotFound if it doesn't exist or is already deleted.
+	DeleteComment(ctx context.Context, commentID uuid.UUID, deletedBy string) error
+
+	// PurgeDeletedComments permanently deletes the comments soft-deleted before the cutoff and returns how many.
+	// Those that still have replies are kept as tombstones, but their text, author and revisions are erased.
+	PurgeDeletedComments(ctx context.Context, deletedBefore time.Time) (int64, error)
+
+	// Vote records a user's vote on a visible comment that wasn't deleted: 1 for an upvote, -1 for a downvote, or 0
+	// to take the vote back. A user has at most one vote per comment, so voting again replaces the previous vote.
+	// It returns the comment's new score, or ErrNotFound.
+	Vote(ctx context.Context, commentID uuid.UUID, userID string, vote int) (int, error)
+
+	// GetCommentsSince returns up to limit visible comments on a listing, replies included, posted after the given
+	// comment, oldest first. Comments by blacklisted users are left out if hideBlacklisted is set.
+	GetCommentsSince(ctx context.Context, listingID string, since uuid.UUID, limit int, hideBlacklisted bool) ([]models.Comment, error)
+
+	// GetCommentCounts sums up the visible comments on each of the listings, leaving out the comments by
+	// blacklisted users if hideBlacklisted is set. Listings without any comment are left out of the map.
+	GetCommentCounts(ctx context.Context, listingIDs []string, hideBlacklisted bool) (map[string]models.ListingCommentCount, error)
+
+	// GetUserVotes returns the votes of a user on the given comments, keyed by comment ID. Comments the user didn't
+	// vote on are left out.
+	GetUserVotes(ctx context.Context, userID string, commentIDs []uuid.UUID) (map[uuid.UUID]int, error)
+
+	// ReportComment records a report of a visible comment that wasn't deleted, or returns ErrNotFound. Each reporter
+	// can only report a comment once. If hideThreshold is positive, the comment is hidden once it has that many
+	// open reports, not counting the ones of the comment filters (models.FilterReporterID).
+	ReportComment(ctx context.Context, report models.Report, hideThreshold int) (*ReportResult, error)
+
+	// Subscribe subscribes a user to a listing, or updates the email of their subscription. A new subscription is
+	// notified of the comments posted after subscription.LastCommentID, and an existing one keeps its progress.
+	// A changed email isn't verified anymore.
+	Subscribe(ctx context.Context, subscription models.Subscription) (*SubscribeResult, error)
+
+	// Unsubscribe deletes a user's subscription to a listing, or returns ErrNotFound.
+	Unsubscribe(ctx context.Context, listingID, userID string) error
+
+	// VerifySubscriptionEmail marks the email of a subscription as verified, or returns ErrNotFound if the
+	// subscription doesn't exist or has another email by now.
+	VerifySubscriptionEmail(ctx context.Context, listingID, userID, email string) error
+
+	// GetPendingSubscriptions returns up to limit subscriptions with visible comments by others than the subscriber
+	// since they were last notified, ordered by listing and user ID, starting after the given ones. If
+	// hideBlacklisted is set, comments by blacklisted authors don't count, like with GetCommentsSince.
+	GetPendingSubscriptions(ctx context.Context, afterListingID, afterUserID string, limit int, hideBlacklisted bool) ([]models.Subscription, error)
+
+	// MarkSubscriptionNotified records that a subscriber was notified of the comments up to lastCommentID.
+	MarkSubscriptionNotified(ctx context.Context, listingID, userID string, lastCommentID uuid.UUID) error
+
+	// FindBlacklistEntry returns a blacklist entry matching the IP, user ID, or username, or nil if there is none.
+	// Usernames match whatever their case.
+	// Empty arguments never match.
+	FindBlacklistEntry(ctx context.Context, userIP, userID, username string) (*models.BlacklistEntry, error)
+}
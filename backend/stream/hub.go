@@ -0,0 +1,120 @@
+// The stream package fans new comments out to the clients following a listing, for the comment streams of the
+// standalone server. The Hub keeps the subscriptions, and Listen feeds it from Postgres notifications.
+package stream
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// subscriptionBuffer is how many new comments a subscription holds before its client is considered too slow
+const subscriptionBuffer = 32
+
+// Subscription receives the IDs of the comments posted on a listing. C is closed when the subscription ends,
+// either because it was closed, because its client fell behind, or because the hub stopped. Clients that get cut
+// off resume from the last comment they received.
+type Subscription struct {
+	C <-chan uuid.UUID
+
+	hub       *Hub
+	listingID string
+	c         chan uuid.UUID
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (subscription *Subscription) Close() {
+	subscription.hub.mu.Lock()
+	defer subscription.hub.mu.Unlock()
+
+	subscription.hub.remove(subscription)
+}
+
+// Hub fans out the comments posted on each listing to the subscriptions to that listing. It is safe for
+// concurrent use.
+type Hub struct {
+	mu            sync.Mutex
+	subscriptions map[string]map[*Subscription]bool
+	closed        bool
+}
+
+// NewHub returns a Hub without any subscription.
+func NewHub() *Hub {
+	return &Hub{
+		subscriptions: map[string]map[*Subscription]bool{},
+	}
+}
+
+// Subscribe starts receiving the comments posted on a listing. If the hub was closed, the subscription is ended
+// right away.
+func (hub *Hub) Subscribe(listingID string) *Subscription {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	c := make(chan uuid.UUID, subscriptionBuffer)
+	subscription := &Subscription{C: c, hub: hub, listingID: listingID, c: c}
+	if hub.closed {
+		close(c)
+		return subscription
+	}
+
+	if hub.subscriptions[listingID] == nil {
+		hub.subscriptions[listingID] = map[*Subscription]bool{}
+	}
+	hub.subscriptions[listingID][subscription] = true
+	return subscription
+}
+
+// Publish sends a new comment to the subscriptions to its listing. It never blocks: the subscriptions that are
+// too far behind to take the comment are ended instead, so that their clients resume without missing it.
+func (hub *Hub) Publish(listingID string, commentID uuid.UUID) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for subscription := range hub.subscriptions[listingID] {
+		select {
+		case subscription.c <- commentID:
+		default:
+			hub.remove(subscription)
+		}
+	}
+}
+
+// Disconnect ends every subscription, but keeps the hub open for new ones. It is used when comments may have been
+// missed, so that the clients resume from the last comment they received.
+func (hub *Hub) Disconnect() {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for _, subscriptions := range hub.subscriptions {
+		for subscription := range subscriptions {
+			hub.remove(subscription)
+		}
+	}
+}
+
+// Close ends every subscription, and every new one right away.
+func (hub *Hub) Close() {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.closed = true
+	for _, subscriptions := range hub.subscriptions {
+		for subscription := range subscriptions {
+			hub.remove(subscription)
+		}
+	}
+}
+
+// remove ends a subscription if it is still running. hub.mu must be held.
+func (hub *Hub) remove(subscription *Subscription) {
+	subscriptions := hub.subscriptions[subscription.listingID]
+	if !subscriptions[subscription] {
+		return
+	}
+	delete(subscriptions, subscription)
+	if len(subscriptions) == 0 {
+		delete(hub.subscriptions, subscription.listingID)
+	}
+	close(subscription.c)
+}
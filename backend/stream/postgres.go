@@ -0,0 +1,89 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"zillow-commenter.com/m/logging"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Channel is the notification channel the comments table notifies of new comments on, with a JSON payload
+// holding their listing_id and comment_id
+const Channel = "comment_inserted"
+
+const (
+	// Delays between attempts to listen again after losing the connection, doubling up to the maximum
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// notification is the payload of the notifications on Channel
+type notification struct {
+	ListingID string    `json:"listing_id"`
+	CommentID uuid.UUID `json:"comment_id"`
+}
+
+// Listen publishes the comments Postgres notifies of to the hub until the context is done, then closes the hub.
+// It holds a connection of its own, outside the pool. When the connection is lost, the subscriptions are ended,
+// since comments may be missed until it is back, and it reconnects.
+func Listen(ctx context.Context, pool *pgxpool.Pool, hub *Hub) {
+	defer hub.Close()
+
+	delay := minReconnectDelay
+	for {
+		listening, err := listen(ctx, pool, hub)
+		if ctx.Err() != nil {
+			return
+		}
+		hub.Disconnect()
+		if listening {
+			delay = minReconnectDelay
+		}
+		slog.Error("lost the comment notifications, listening again", logging.Error(err), slog.Duration("delay", delay))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// listen listens on Channel until the connection fails or the context is done. listening reports whether it got
+// to listen at all.
+func listen(ctx context.Context, pool *pgxpool.Pool, hub *Hub) (listening bool, err error) {
+	pooledConn, err := pool.Acquire(ctx)
+	if err != nil {
+		return false, errors.Join(err, errors.New("failed to acquire a connection to listen on"))
+	}
+	// The connection stays subscribed to the channel, so it must not go back to the pool
+	conn := pooledConn.Hijack()
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "LISTEN "+Channel)
+	if err != nil {
+		return false, errors.Join(err, errors.New("failed to listen for comment notifications"))
+	}
+
+	for {
+		received, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, errors.Join(err, errors.New("failed to wait for comment notifications"))
+		}
+
+		var payload notification
+		err = json.Unmarshal([]byte(received.Payload), &payload)
+		if err != nil {
+			slog.Warn("ignored invalid comment notification", logging.Error(err))
+			continue
+		}
+		hub.Publish(payload.ListingID, payload.CommentID)
+	}
+}
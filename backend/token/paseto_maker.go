@@ -25,22 +25,88 @@ func NewPasetoMaker(key string) (*PasetoMaker, error) {
 	return maker, nil
 }
 
-func (maker *PasetoMaker) CreateToken(username string, duration time.Duration) (string, error) {
-	payload, err := NewPayload(username, duration)
+// CreateToken issues a new token bound to the given user ID, valid for the given duration.
+func (maker *PasetoMaker) CreateToken(userID string, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(userID, duration)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	token, err := maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, payload, nil
+}
+
+// RefreshToken issues a new token bound to the user ID of a valid one, valid for the given duration but no longer
+// than the given lifetime after the session started. It returns ErrExpiredToken once the session is that old.
+func (maker *PasetoMaker) RefreshToken(previous *Payload, duration, lifetime time.Duration) (string, *Payload, error) {
+	// Tokens issued before sessions were tracked start theirs when they were issued
+	sessionStartedAt := previous.SessionStartedAt
+	if sessionStartedAt.IsZero() {
+		sessionStartedAt = previous.IssuedAt
+	}
+	remaining := time.Until(sessionStartedAt.Add(lifetime))
+	if remaining <= 0 {
+		return "", nil, ErrExpiredToken
+	}
+
+	payload, err := NewPayload(previous.UserID, min(duration, remaining))
+	if err != nil {
+		return "", nil, err
+	}
+	payload.SessionStartedAt = sessionStartedAt
+	token, err := maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, payload, nil
 }
 
+// VerifyToken decrypts the token and checks that its payload is still valid.
 func (maker *PasetoMaker) VerifyToken(token string) (*Payload, error) {
 	payload := &Payload{}
 
-	err := maker.paseto.Decrypt(token, maker.symmetricKey, payload, nil)
+	// Session tokens are made without a footer, which the library encodes as null, so that the tokens made for
+	// another purpose can't be used as one
+	var footer string
+	err := maker.paseto.Decrypt(token, maker.symmetricKey, payload, &footer)
+	if err != nil || (footer != "" && footer != "null") {
+		return nil, ErrInvalidToken
+	}
+
+	err = payload.Valid()
 	if err != nil {
 		return nil, err
 	}
 
+	return payload, nil
+}
+
+// CreateSubscriptionToken issues a token for the given purpose (PurposeUnsubscribe or PurposeVerifyEmail) on a
+// listing subscription, valid for the given duration. The purpose goes in the token's footer, which is
+// authenticated, so that it can't be used for another purpose or as a session token.
+func (maker *PasetoMaker) CreateSubscriptionToken(purpose, listingID, userID, email string, duration time.Duration) (string, error) {
+	payload := &SubscriptionPayload{
+		ListingID: listingID,
+		UserID:    userID,
+		Email:     email,
+		ExpiredAt: time.Now().Add(duration),
+	}
+	return maker.paseto.Encrypt(maker.symmetricKey, payload, purpose)
+}
+
+// VerifySubscriptionToken decrypts a token made by CreateSubscriptionToken for the given purpose, and checks that
+// it hasn't expired.
+func (maker *PasetoMaker) VerifySubscriptionToken(purpose, token string) (*SubscriptionPayload, error) {
+	payload := &SubscriptionPayload{}
+
+	var footer string
+	err := maker.paseto.Decrypt(token, maker.symmetricKey, payload, &footer)
+	if err != nil || footer != purpose {
+		return nil, ErrInvalidToken
+	}
+
 	err = payload.Valid()
 	if err != nil {
 		return nil, err
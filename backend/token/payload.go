@@ -7,31 +7,71 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	ErrInvalidToken = errors.New("token is invalid")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Payload is the data carried inside a token. UserID is the V7 UUID handed out to the client when the token was issued.
+// SessionStartedAt is when the first token of the user ID was issued, which refreshed tokens keep.
 type Payload struct {
-	ID        uuid.UUID
-	Username  string
-	IssuedAt  time.Time
-	ExpiredAt time.Time
+	ID               uuid.UUID `json:"id"`
+	UserID           string    `json:"user_id"`
+	IssuedAt         time.Time `json:"issued_at"`
+	ExpiredAt        time.Time `json:"expired_at"`
+	SessionStartedAt time.Time `json:"session_started_at"`
 }
 
-func NewPayload(username string, duration time.Duration) (*Payload, error) {
+func NewPayload(userID string, duration time.Duration) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
 	payload := &Payload{
-		ID:        tokenID,
-		Username:  username,
-		IssuedAt:  time.Now(),
-		ExpiredAt: time.Now().Add(duration),
+		ID:               tokenID,
+		UserID:           userID,
+		IssuedAt:         now,
+		ExpiredAt:        now.Add(duration),
+		SessionStartedAt: now,
 	}
 	return payload, err
 }
 
 func (payload *Payload) Valid() error {
+	if payload.UserID == "" {
+		return ErrInvalidToken
+	}
+	if time.Now().After(payload.ExpiredAt) {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+// Purposes of the tokens made for listing subscriptions
+const (
+	// PurposeUnsubscribe tokens are sent along with the digests, to unsubscribe without a session token.
+	PurposeUnsubscribe = "unsubscribe"
+	// PurposeVerifyEmail tokens are sent to the email address of a subscription, to prove it belongs to the user.
+	PurposeVerifyEmail = "verify_email"
+)
+
+// SubscriptionPayload is the data carried inside a token made for a listing subscription. Email is only set in
+// PurposeVerifyEmail tokens, and is the address being verified.
+type SubscriptionPayload struct {
+	ListingID string    `json:"listing_id"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email,omitempty"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+func (payload *SubscriptionPayload) Valid() error {
+	if payload.ListingID == "" || payload.UserID == "" {
+		return ErrInvalidToken
+	}
 	if time.Now().After(payload.ExpiredAt) {
-		return errors.New("")
+		return ErrExpiredToken
 	}
 	return nil
 }
@@ -0,0 +1,329 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"zillow-commenter.com/m/db/postgres/sqlc"
+	"zillow-commenter.com/m/logging"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is attempted before it is given up
+	MaxAttempts = 10
+
+	// The delay before retrying a delivery doubles with every failed attempt, from baseRetryDelay up to
+	// maxRetryDelay, so that the last of MaxAttempts comes about 4 hours after the first
+	baseRetryDelay = 30 * time.Second
+	maxRetryDelay  = 6 * time.Hour
+
+	// requestTimeout is how long a target gets to respond
+	requestTimeout = 10 * time.Second
+
+	// claimLease is how long the deliveries claimed by an instance are left alone by the others. It must be longer
+	// than a request can take.
+	claimLease = time.Minute
+
+	// batchSize is how many deliveries an instance claims and sends at once
+	batchSize = 20
+
+	// pollInterval is how often the dispatcher looks for due deliveries, besides when this instance queues one
+	pollInterval = 5 * time.Second
+
+	// Deliveries that are done are kept for deliveryRetention, for the admin API to show, and deleted every
+	// pruneInterval
+	deliveryRetention = 7 * 24 * time.Hour
+	pruneInterval     = time.Hour
+
+	// maxErrorLength is how many characters of an attempt's error are recorded, matching the webhook_delivery_attempts
+	// table
+	maxErrorLength = 500
+
+	// userAgent is sent with every request, so that targets can tell webhooks apart
+	userAgent = "zillow-commenter-webhook/1"
+)
+
+// Statuses of a delivery
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Dispatcher delivers the events queued in the outbox. Any number of instances can deliver from the same outbox, each
+// delivery being claimed by one at a time.
+type Dispatcher struct {
+	pool   *pgxpool.Pool
+	client *http.Client
+
+	// wake is signaled when this instance queued a delivery, so that it goes out without waiting for the next poll
+	wake chan struct{}
+
+	// lastPruned is only used by Run
+	lastPruned time.Time
+}
+
+// NewDispatcher returns a Dispatcher working on the outbox of the database behind the given pool.
+func NewDispatcher(pool *pgxpool.Pool) *Dispatcher {
+	return &Dispatcher{
+		pool: pool,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// A redirect counts as a failure, so that the target's owner fixes the URL
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Enqueue queues an event for every webhook registered for its type, on its listing or on every listing, and
+// returns how many deliveries were queued. The queries should run in the transaction of the change that raised the
+// event, so that the event is queued if and only if the change is committed.
+func Enqueue(ctx context.Context, queries *sqlc.Queries, event Event) (int64, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, errors.Join(err, errors.New("failed to encode webhook event"))
+	}
+
+	queued, err := queries.EnqueueWebhookEvent(ctx, sqlc.EnqueueWebhookEventParams{
+		EventID:   pgtype.UUID{Bytes: [16]byte(event.ID), Valid: true},
+		EventType: event.Type,
+		Payload:   body,
+		ListingID: event.ListingID,
+	})
+	if err != nil {
+		return 0, errors.Join(err, errors.New("failed to queue webhook event"))
+	}
+	return queued, nil
+}
+
+// Wake makes Run look for due deliveries right away rather than at its next poll, e.g. once events were queued.
+func (dispatcher *Dispatcher) Wake() {
+	select {
+	case dispatcher.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers the due deliveries right away, then whenever this instance queues one or every pollInterval, until
+// the context is done. Failures are logged and retried at the next run.
+func (dispatcher *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := dispatcher.DeliverPending(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("failed to deliver webhooks", logging.Error(err))
+		}
+		dispatcher.pruneIfDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-dispatcher.wake:
+		}
+	}
+}
+
+// DeliverPending sends the deliveries that are due, batch after batch until none is left, and returns how many
+// were attempted. The outcome of each attempt is recorded with its delivery.
+func (dispatcher *Dispatcher) DeliverPending(ctx context.Context) (int, error) {
+	attempted := 0
+	for ctx.Err() == nil {
+		claimed, err := sqlc.New(dispatcher.pool).ClaimWebhookDeliveries(ctx, sqlc.ClaimWebhookDeliveriesParams{
+			LeaseSeconds: claimLease.Seconds(),
+			BatchSize:    batchSize,
+		})
+		if err != nil {
+			return attempted, errors.Join(err, errors.New("failed to claim webhook deliveries"))
+		}
+
+		// Claimed deliveries are sent even if the context ends meanwhile, so that their outcome is recorded
+		var wg sync.WaitGroup
+		for _, delivery := range claimed {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dispatcher.deliver(context.WithoutCancel(ctx), delivery)
+			}()
+		}
+		wg.Wait()
+		attempted += len(claimed)
+
+		if len(claimed) < batchSize {
+			break
+		}
+	}
+	return attempted, nil
+}
+
+// deliver sends a delivery to its webhook, and records the attempt and what comes next: nothing if it succeeded,
+// another attempt after a delay if it failed, or nothing either if it ran out of attempts.
+func (dispatcher *Dispatcher) deliver(ctx context.Context, delivery sqlc.ClaimWebhookDeliveriesRow) {
+	attempt := delivery.AttemptCount + 1
+	logger := slog.With(
+		slog.String("webhook_id", uuid.UUID(delivery.WebhookID.Bytes).String()),
+		slog.String("event_id", uuid.UUID(delivery.EventID.Bytes).String()),
+		slog.String("event_type", delivery.EventType),
+		slog.Int("attempt", int(attempt)),
+	)
+
+	started := time.Now()
+	statusCode, err := dispatcher.send(ctx, delivery)
+	duration := time.Since(started)
+
+	status := StatusDelivered
+	var delay time.Duration
+	var errorText string
+	switch {
+	case err == nil:
+		logger.Info("delivered webhook", slog.Int("status_code", statusCode))
+	case attempt >= MaxAttempts:
+		status = StatusFailed
+		errorText = err.Error()
+		logger.Error("gave up on webhook delivery", slog.Int("status_code", statusCode), logging.Error(err))
+	default:
+		status = StatusPending
+		delay = retryDelay(int(attempt))
+		errorText = err.Error()
+		logger.Warn("webhook delivery failed", slog.Int("status_code", statusCode), slog.Duration("retry_in", delay), logging.Error(err))
+	}
+	errorText = truncateError(errorText)
+
+	err = dispatcher.record(ctx, delivery, sqlc.CreateWebhookAttemptParams{
+		EventID:    delivery.EventID,
+		WebhookID:  delivery.WebhookID,
+		Attempt:    attempt,
+		StatusCode: pgtype.Int4{Int32: int32(statusCode), Valid: statusCode != 0},
+		Error:      errorText,
+		DurationMs: int32(duration.Milliseconds()),
+	}, status, delay)
+	if err != nil {
+		// The delivery is attempted again once its claim runs out
+		logger.Error("failed to record webhook attempt", logging.Error(err))
+	}
+}
+
+// send posts a delivery's event to its webhook, signed with the webhook's secret, and returns the status code of the
+// response, or 0 if there was none. Anything but a 2xx response is an error. Errors leave the URL out, since for some
+// services, e.g. Slack, its path is the secret, and they are recorded and logged.
+func (dispatcher *Dispatcher) send(ctx context.Context, delivery sqlc.ClaimWebhookDeliveriesRow) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.TargetUrl, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, withoutURL(err)
+	}
+
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set(HeaderEventID, uuid.UUID(delivery.EventID.Bytes).String())
+	request.Header.Set(HeaderEventType, delivery.EventType)
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return 0, withoutURL(err)
+	}
+	defer response.Body.Close()
+	// Read a bit of the body so that the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// withoutURL returns the error wrapped by a *url.Error, which names the URL, along with its operation.
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
+}
+
+// record saves an attempt along with the new status of its delivery.
+func (dispatcher *Dispatcher) record(ctx context.Context, delivery sqlc.ClaimWebhookDeliveriesRow, attempt sqlc.CreateWebhookAttemptParams, status string, delay time.Duration) error {
+	tx, err := dispatcher.pool.Begin(ctx)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to begin webhook attempt transaction"))
+	}
+	defer tx.Rollback(ctx)
+	queries := sqlc.New(tx)
+
+	err = queries.CreateWebhookAttempt(ctx, attempt)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to insert webhook attempt"))
+	}
+	err = queries.UpdateWebhookDelivery(ctx, sqlc.UpdateWebhookDeliveryParams{
+		Status:       status,
+		AttemptCount: attempt.Attempt,
+		DelaySeconds: delay.Seconds(),
+		EventID:      delivery.EventID,
+		WebhookID:    delivery.WebhookID,
+	})
+	if err != nil {
+		return errors.Join(err, errors.New("failed to update webhook delivery"))
+	}
+
+	return tx.Commit(ctx)
+}
+
+// truncateError cuts an attempt's error down to maxErrorLength characters. It counts runes rather than bytes, like
+// Postgres does, so that no character is split. Invalid UTF-8 and NUL bytes, which Postgres would refuse too, are
+// replaced. Were the attempt refused, its delivery would be retried forever.
+func truncateError(errorText string) string {
+	errorText = strings.ReplaceAll(strings.ToValidUTF8(errorText, "\uFFFD"), "\x00", "\uFFFD")
+	if utf8.RuneCountInString(errorText) <= maxErrorLength {
+		return errorText
+	}
+	return string([]rune(errorText)[:maxErrorLength])
+}
+
+// retryDelay returns how long to wait after the given failed attempt, with up to 10% of jitter so that the
+// deliveries that failed together aren't retried together.
+func retryDelay(attempt int) time.Duration {
+	delay := maxRetryDelay
+	if attempt < 20 {
+		delay = min(baseRetryDelay<<(attempt-1), maxRetryDelay)
+	}
+	return delay + rand.N(delay/10)
+}
+
+// pruneIfDue deletes the deliveries that have been done for longer than deliveryRetention, if this dispatcher hasn't
+// done so for pruneInterval. Failing to prune is only logged, since it doesn't affect deliveries.
+func (dispatcher *Dispatcher) pruneIfDue(ctx context.Context) {
+	now := time.Now()
+	if now.Sub(dispatcher.lastPruned) < pruneInterval {
+		return
+	}
+	dispatcher.lastPruned = now
+
+	_, err := sqlc.New(dispatcher.pool).DeleteFinishedWebhookDeliveries(ctx, pgtype.Timestamp{Time: now.Add(-deliveryRetention), Valid: true})
+	if err != nil && ctx.Err() == nil {
+		slog.Warn("failed to prune webhook deliveries", logging.Error(err))
+	}
+}
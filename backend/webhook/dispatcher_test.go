@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"zillow-commenter.com/m/db/postgres/sqlc"
+)
+
+func TestTruncateError(t *testing.T) {
+	tests := []struct {
+		name      string
+		errorText string
+		want      string
+	}{
+		{"short", "unexpected status 500", "unexpected status 500"},
+		{"ascii", strings.Repeat("a", maxErrorLength+10), strings.Repeat("a", maxErrorLength)},
+		{"multibyte", strings.Repeat("é", maxErrorLength+10), strings.Repeat("é", maxErrorLength)},
+		{"split rune", "a" + strings.Repeat("日", maxErrorLength), "a" + strings.Repeat("日", maxErrorLength-1)},
+		{"invalid utf-8", "bad \xff byte", "bad \uFFFD byte"},
+		{"nul", "bad \x00 byte", "bad \uFFFD byte"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := truncateError(test.errorText)
+			if got != test.want {
+				t.Errorf("truncateError() = %q, want %q", got, test.want)
+			}
+			if !utf8.ValidString(got) || utf8.RuneCountInString(got) > maxErrorLength {
+				t.Errorf("truncateError() = %q, want valid UTF-8 of at most %d characters", got, maxErrorLength)
+			}
+		})
+	}
+}
+
+func TestSendLeavesURLOutOfErrors(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	// Nothing listens on a port once its listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name      string
+		targetURL string
+		want      string
+	}{
+		{"error status", failing.URL + "/services/T000/B000/token-secret", "unexpected status 500"},
+		{"no connection", closedURL + "/services/T000/B000/token-secret", "connection refused"},
+		{"invalid URL", "http://example.com/token-secret/%zz", "invalid URL escape"},
+	}
+	dispatcher := NewDispatcher(nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := dispatcher.send(context.Background(), sqlc.ClaimWebhookDeliveriesRow{
+				TargetUrl: test.targetURL,
+				Secret:    "whsec_test",
+				Payload:   []byte("{}"),
+			})
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("send() error = %v, want one containing %q", err, test.want)
+			}
+			if strings.Contains(err.Error(), "token-secret") {
+				t.Errorf("send() error = %q, want it without the URL", err)
+			}
+		})
+	}
+}
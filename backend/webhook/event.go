@@ -0,0 +1,104 @@
+// The webhook package posts events, such as new comments, to the URLs registered by the integrations. Events are
+// queued in a Postgres outbox by Enqueue, in the transaction of the change that raised them, and delivered in the
+// background by a Dispatcher, which retries failed deliveries with exponential backoff and records every attempt.
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"zillow-commenter.com/m/api/models"
+
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	EventCommentCreated = "comment.created"
+)
+
+// eventVersions holds the version of the data of each event type. A version is bumped whenever a field of its data
+// changes in a way receivers could trip on; adding a field doesn't.
+var eventVersions = map[string]int{
+	EventCommentCreated: 1,
+}
+
+// EventTypes returns every event type that webhooks can be registered for.
+func EventTypes() []string {
+	return []string{EventCommentCreated}
+}
+
+// IsEventType reports whether webhooks can be registered for the given event type.
+func IsEventType(eventType string) bool {
+	_, ok := eventVersions[eventType]
+	return ok
+}
+
+// Event is the body of a webhook request. Every event type shares the envelope, and Data holds what is specific to
+// the type, in the given version of its schema. Timestamp is in microseconds since the epoch.
+type Event struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	Timestamp int64           `json:"timestamp"`
+	ListingID string          `json:"listing_id"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewEvent builds an event of the given type on a listing, with a new V7 ID.
+func NewEvent(eventType, listingID string, data any) (Event, error) {
+	version, ok := eventVersions[eventType]
+	if !ok {
+		return Event{}, errors.New("unknown event type " + eventType)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return Event{}, errors.Join(err, errors.New("failed to generate event UUID"))
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, errors.Join(err, errors.New("failed to encode event data"))
+	}
+
+	return Event{
+		ID:        id,
+		Type:      eventType,
+		Version:   version,
+		Timestamp: time.Now().UnixMicro(),
+		ListingID: listingID,
+		Data:      encoded,
+	}, nil
+}
+
+// Comment is a comment as sent in events. It is kept apart from the API's comment structs, so that the API can
+// change without changing the version of the events.
+type Comment struct {
+	ListingID   string     `json:"listing_id"`
+	CommentID   uuid.UUID  `json:"comment_id"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"`
+	Username    string     `json:"username"`
+	CommentText string     `json:"comment_text"`
+	Timestamp   int64      `json:"timestamp"`
+}
+
+// CommentCreated is the data of comment.created events, version 1.
+type CommentCreated struct {
+	Comment Comment `json:"comment"`
+}
+
+// NewCommentCreatedEvent builds the comment.created event of a new comment.
+func NewCommentCreatedEvent(comment models.Comment) (Event, error) {
+	return NewEvent(EventCommentCreated, comment.TargetListing, CommentCreated{
+		Comment: Comment{
+			ListingID:   comment.TargetListing,
+			CommentID:   comment.CommentID,
+			ParentID:    comment.ParentID,
+			Username:    comment.Username,
+			CommentText: comment.CommentText,
+			Timestamp:   comment.Timestamp,
+		},
+	})
+}
@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Headers of webhook requests
+const (
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderEventType = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// secretPrefix makes the secrets easy to recognize, e.g. by secret scanners
+const secretPrefix = "whsec_"
+
+// GenerateSecret returns a new random signing secret for a webhook.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(secret), nil
+}
+
+// Sign returns the signature of a request body sent at the given Unix time, as sent in the X-Webhook-Signature
+// header: "v1=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>", keyed with the webhook's secret.
+// Receivers should compute it the same way, compare it in constant time, and reject old timestamps to stop replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -15,40 +15,61 @@ setUserId();
 // Populate comments when the popup is opened
 populateComments();
 
-// Sets a unique user ID in localStorage if it doesn't exist
+// Sets a unique user ID and session token in localStorage if they don't exist,
+// and refreshes the token when it is close to expiring
 //
 // Note: The localstorage persists between browser sessions, and incognito mode
 function setUserId() {
-    let userId = window.localStorage.getItem('zillow_commenter_user_id');
-    if (!userId) {
-        getNewUserId((result, error=null) => {
-            if (error) {
-                // If there's an error retrieving the user ID, log it
-                console.error('Error retrieving user ID:', error);
-                //setUserId();
+    const userToken = getLocalUserToken();
+    if (!userToken) {
+        getNewUserToken(storeUserToken);
+        return;
+    }
+
+    // Refresh the token if it expires within the next week
+    const expiresAt = Number(window.localStorage.getItem('zillow_commenter_token_expires_at'));
+    const oneWeek = 7 * 24 * 60 * 60;
+    if (!expiresAt || expiresAt - Math.floor(Date.now() / 1000) < oneWeek) {
+        refreshUserToken(userToken, (result, error=null) => {
+            if (error || !result) {
+                // The token could not be refreshed (e.g. it already expired), so get a new identity
+                console.error('Error refreshing user token:', error);
+                getNewUserToken(storeUserToken);
                 return;
             }
-            if (result) {
-                // If a user ID is found, parse it and log it
-                const parsedResult = JSON.parse(result);
-                console.log('Retrieved user ID:', parsedResult.user_id);
-                window.localStorage.setItem('zillow_commenter_user_id', parsedResult.user_id);
-            } else {
-                // If no user ID is found, generate a new one
-                console.log('No user ID found, generating a new one.');
-                //setUserId();
-            }
+            storeUserToken(result);
         });
-        /* userId = "user_" + Math.random().toString(36).substring(2, 15);
-        window.localStorage.setItem('zillow_commenter_user_id', userId); */
     }
 }
 
+// Stores the user ID and token returned by the API in localStorage
+function storeUserToken(result, error=null) {
+    if (error) {
+        // If there's an error retrieving the token, log it
+        console.error('Error retrieving user token:', error);
+        return;
+    }
+    if (!result) {
+        console.log('No user token returned.');
+        return;
+    }
+    const parsedResult = JSON.parse(result);
+    console.log('Retrieved user ID:', parsedResult.user_id);
+    window.localStorage.setItem('zillow_commenter_user_id', parsedResult.user_id);
+    window.localStorage.setItem('zillow_commenter_user_token', parsedResult.token);
+    window.localStorage.setItem('zillow_commenter_token_expires_at', parsedResult.expires_at);
+}
+
 // Retrieves the user ID from localStorage
 function getLocalUserId() {
     return window.localStorage.getItem('zillow_commenter_user_id');
 }
 
+// Retrieves the user session token from localStorage
+function getLocalUserToken() {
+    return window.localStorage.getItem('zillow_commenter_user_token');
+}
+
 
 // Tab switching logic
 document.querySelectorAll('.tab').forEach(tab => {
@@ -120,7 +141,8 @@ function displayComments(result, error=null) {
     //console.log('Fetched comments:', result);
     if (result) {
         try {
-            comments = JSON.parse(result);
+            // The API returns a page of comments along with cursors to the neighbouring pages
+            comments = JSON.parse(result).comments;
             //console.log('Parsed comments:', comments);
         } catch (error) {
             console.error('Error parsing comments:', error);
@@ -199,8 +221,13 @@ function displayComments(result, error=null) {
             dateStr = dateObj.toLocaleDateString();
             }
         }
-        li.innerHTML = `<strong>${comment.username}</strong> <span class="comment-date">${dateStr}</span><br>${comment.comment_text}`;
+        const editedStr = comment.edited_at ? ' <span class="comment-date">(edited)</span>' : '';
+        li.innerHTML = `<strong>${comment.username}</strong> <span class="comment-date">${dateStr}</span>${editedStr}<br>${comment.comment_text}`;
         li.className = 'comment-item';
+        // Indent replies according to their depth in the thread
+        if (comment.depth) {
+            li.style.marginLeft = `${comment.depth * 16}px`;
+        }
         commentsListElement.appendChild(li);
     });
 }
@@ -369,10 +396,10 @@ async function postComment(commentObj, callbackFunc) {
     // Prepare form data for API
     var myHeaders = new Headers();
     myHeaders.append("Content-Type", "application/x-www-form-urlencoded");
+    myHeaders.append("Authorization", `Bearer ${getLocalUserToken()}`);
 
     var urlencoded = new URLSearchParams();
     urlencoded.append("listing_id", listingId);
-    urlencoded.append("user_id", getLocalUserId());
     urlencoded.append("username", commentObj.username);
     urlencoded.append("comment_text", commentObj.commentText);
 
@@ -390,19 +417,41 @@ async function postComment(commentObj, callbackFunc) {
         .catch(error => callbackFunc(null, error));
 }
 
-// getNewUserId retrieves a new V7 (Time-based) UUID from the API
-function getNewUserId(callbackFunc) {
+// getNewUserToken retrieves a new V7 (Time-based) user ID and a session token bound to it from the API
+function getNewUserToken(callbackFunc) {
     var requestOptions = {
-        method: 'GET',
+        method: 'POST',
         redirect: 'follow'
     };
 
-    fetch(`${API_URL}/user/user_id`, requestOptions)
+    fetch(`${API_URL}/user/token`, requestOptions)
         .then(response => response.text())
         .then(result => callbackFunc(result))
         .catch(error => callbackFunc(null, error));
 }
 
+// refreshUserToken exchanges a still-valid session token for a new one with the same user ID
+function refreshUserToken(userToken, callbackFunc) {
+    var myHeaders = new Headers();
+    myHeaders.append("Authorization", `Bearer ${userToken}`);
+
+    var requestOptions = {
+        method: 'POST',
+        headers: myHeaders,
+        redirect: 'follow'
+    };
+
+    fetch(`${API_URL}/user/token/refresh`, requestOptions)
+        .then(response => {
+            if (!response.ok) {
+                throw new Error(`Token refresh failed with status ${response.status}`);
+            }
+            return response.text();
+        })
+        .then(result => callbackFunc(result))
+        .catch(error => callbackFunc(null, error));
+}
+
 // Saves the current username to localStorage
 function saveUsername(username) {
     if (username && username.trim() !== '') {